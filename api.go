@@ -0,0 +1,238 @@
+package minilisp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The Go API. An Interpreter holds a global environment with the builtins
+// and standard library in it; Go code evaluates source in it, defines Go
+// values and functions for Lisp to use, and calls Lisp functions back:
+//
+//	interp := minilisp.New()
+//	interp.Define("greeting", "hello")
+//	interp.Define("shout", func(args ...any) (any, error) {
+//		return strings.ToUpper(args[0].(string)), nil
+//	})
+//	v, err := interp.Eval(ctx, `(shout greeting)`) // "HELLO"
+//
+// Values cross over as plain Go values, see fromGo and toGo.
+
+// Option configures an Interpreter made by New
+type Option func(*Interpreter)
+
+// WithoutStdlib starts the interpreter without the standard library, the
+// same as --no-stdlib
+func WithoutStdlib() Option {
+	return func(in *Interpreter) { in.noStdlib = true }
+}
+
+// WithStdlibDir reads std: files from dir rather than the built in copy,
+// the same as --stdlib-dir
+func WithStdlibDir(dir string) Option {
+	return func(in *Interpreter) { in.stdlibDir = dir }
+}
+
+// WithStdout sends what print and the REPL write to w instead of os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) { in.stdout = w }
+}
+
+// WithStderr sends warnings to w instead of os.Stderr
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) { in.stderr = w }
+}
+
+// WithColour turns colour in the REPL on or off. It's on unless NO_COLOR
+// is set.
+func WithColour(on bool) Option {
+	return func(in *Interpreter) { in.colour = on }
+}
+
+// New makes an interpreter with the builtins and, unless WithoutStdlib is
+// given, the standard library
+func New(opts ...Option) *Interpreter {
+	env := NewEnv(nil)
+	in := env.interp
+	for _, opt := range opts {
+		opt(in)
+	}
+	env.run.backend = in.backend
+
+	defineBuiltins(env)
+
+	// Bootstrap defmacro
+	eval(readStr("(define defmacro (macro (name params &rest body) `(define ,name (macro ,params ,@body))))"), env)
+
+	if !in.noStdlib {
+		loadStdLib(env)
+	}
+	return in
+}
+
+// EvalError is a Lisp error returned to Go, from Eval, Run or Call
+type EvalError struct {
+	Kind    string   // e.g. type-error, see the Err constants
+	Origin  string   // builtin or form that raised it, if known
+	Message string   // without the origin
+	Payload any      // extra data, converted like any other value
+	Pos     string   // file:line:col where it happened, if known
+	Trace   []string // lambdas and macros it unwound through, innermost first
+	expr    *Expr
+}
+
+func (e *EvalError) Error() string {
+	return errorMessage(e.toExpr())
+}
+
+// The error value e came from, or a new one for an Error made in Go, e.g.
+// returned from a Func as &minilisp.EvalError{Kind: "value-error", ...}
+func (e *EvalError) toExpr() *Expr {
+	if e.expr != nil {
+		return e.expr
+	}
+	payload, err := fromGo(e.Payload)
+	if err != nil {
+		payload = nilExpr
+	}
+	kind := e.Kind
+	if kind == "" {
+		kind = ErrGeneric
+	}
+	return makeError(kind, e.Origin, e.Message, payload)
+}
+
+func newError(err *Expr) *EvalError {
+	e := &EvalError{
+		Kind:    err.Kind,
+		Origin:  err.Origin,
+		Message: err.Str,
+		Payload: toGo(err.Payload),
+		Trace:   err.Trace,
+		expr:    err,
+	}
+	if err.Pos != nil {
+		e.Pos = err.Pos.String()
+	}
+	return e
+}
+
+// FormatError formats err the way the REPL prints it, with its position
+// and trace on a second line
+func FormatError(err error) string {
+	var lispErr *EvalError
+	if errors.As(err, &lispErr) {
+		return formatError(lispErr.toExpr())
+	}
+	return "Error: " + err.Error()
+}
+
+// Run fn, turning a Lisp error raised in it into an *EvalError
+func catchError(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError(recoverError(r))
+		}
+	}()
+	fn()
+	return nil
+}
+
+// Run fn as a new evaluation in ctx with the interpreter's limits. fn gets
+// the global environment as that evaluation sees it.
+func (in *Interpreter) withContext(ctx context.Context, fn func(env *Env)) error {
+	run, cancel := in.newEvaluation(ctx)
+	defer cancel()
+	env := in.env.withEvaluation(run)
+	return catchError(func() { fn(env) })
+}
+
+// Eval evaluates every form in src and returns the value of the last one.
+// It stops at the first error, or when ctx is done.
+func (in *Interpreter) Eval(ctx context.Context, src string) (any, error) {
+	var result *Expr = nilExpr
+	err := in.withContext(ctx, func(env *Env) {
+		for _, expr := range readSource(src, "<eval>") {
+			result = eval(expr, env)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toGo(result), nil
+}
+
+// Run evaluates every form in src like a script, reading it as file for
+// error positions and relative loads. An error in one form is passed to
+// report and the next form still runs. Errors that stop the whole script
+// are returned: a syntax error, which stops anything from running, and a
+// limit-error or cancel-error, since the rest would fail the same way.
+func (in *Interpreter) Run(ctx context.Context, src, file string, report func(error)) error {
+	var exprs []*Expr
+	if err := catchError(func() { exprs = readSource(src, file) }); err != nil {
+		return err
+	}
+	var stop error
+	in.withContext(ctx, func(env *Env) {
+		for _, expr := range exprs {
+			err := catchError(func() { eval(expr, env) })
+			var lispErr *EvalError
+			if errors.As(err, &lispErr) && (lispErr.Kind == ErrLimit || lispErr.Kind == ErrCancelled) {
+				stop = err
+				return
+			}
+			if err != nil {
+				report(err)
+			}
+		}
+	})
+	return stop
+}
+
+// Define binds name to value in the global environment. value can be
+// anything fromGo converts, including any Go func and struct.
+func (in *Interpreter) Define(name string, value any) error {
+	expr, err := fromGo(value)
+	if err != nil {
+		return fmt.Errorf("define %s: %w", name, err)
+	}
+	if expr.Type == Builtin && expr.Sig != nil && expr.Sig.Name == "" {
+		expr.Sig.Name = name
+		in.builtins[name] = expr
+	}
+	in.env.Define(name, expr)
+	return nil
+}
+
+// Call calls the Lisp function bound to name with args, converted from Go
+func (in *Interpreter) Call(ctx context.Context, name string, args ...any) (any, error) {
+	fn, ok := in.env.Lookup(name)
+	if !ok {
+		return nil, newError(errorf(ErrUnbound, "", "unbound symbol: %s", name))
+	}
+	exprs := make([]*Expr, len(args))
+	for i, arg := range args {
+		expr, err := fromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("call %s: argument %d: %w", name, i+1, err)
+		}
+		exprs[i] = expr
+	}
+
+	var result *Expr
+	err := in.withContext(ctx, func(env *Env) {
+		result = applyProc(env, fn, exprs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toGo(result), nil
+}
+
+// REPL runs the interactive prompt on the terminal until it's closed with
+// :quit or Ctrl+D, when it returns nil. The error is from the terminal.
+func (in *Interpreter) REPL() error {
+	return in.startREPL()
+}
@@ -0,0 +1,219 @@
+package minilisp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/crbroughton/minilisp"
+)
+
+func TestEvalConvertsResults(t *testing.T) {
+	interp := minilisp.New()
+	ctx := context.Background()
+
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{"(+ 1 2)", 3},
+		{"1.5", 1.5},
+		{`"hi"`, "hi"},
+		{"true", true},
+		{"nil", nil},
+		{":name", "name"},
+		{"'(1 \"two\" (3))", []any{1, "two", []any{3}}},
+		{"[1 2]", []any{1, 2}},
+		{`{:a 1 "b" [true]}`, map[string]any{"a": 1, "b": []any{true}}},
+		{"(* 10000000000 10000000000)", huge},
+		{"(/ 1 3)", big.NewRat(1, 3)},
+		{"(sum 1 2 3)", 6},
+		{"(define x 1) (+ x 1)", 2},
+	}
+
+	for _, tt := range tests {
+		got, err := interp.Eval(ctx, tt.input)
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	interp := minilisp.New()
+	ctx := context.Background()
+
+	_, err := interp.Eval(ctx, "(define f (lambda (x) (head x)))\n(f 1)")
+	var lispErr *minilisp.EvalError
+	if !errors.As(err, &lispErr) {
+		t.Fatalf("err = %v, want an *EvalError", err)
+	}
+	if lispErr.Kind != minilisp.ErrType || lispErr.Origin != "head" || lispErr.Message != "argument 1 must be a pair, got number 1" {
+		t.Errorf("err = %+v", lispErr)
+	}
+	if lispErr.Error() != "head: argument 1 must be a pair, got number 1" {
+		t.Errorf("Error() = %q", lispErr.Error())
+	}
+	if !reflect.DeepEqual(lispErr.Trace, []string{"f"}) {
+		t.Errorf("trace = %v, want [f]", lispErr.Trace)
+	}
+
+	_, err = interp.Eval(ctx, `(throw 'not-found "no such user" {:id 7})`)
+	if !errors.As(err, &lispErr) || lispErr.Kind != "not-found" || !reflect.DeepEqual(lispErr.Payload, map[string]any{"id": 7}) {
+		t.Errorf("err = %+v", err)
+	}
+
+	_, err = interp.Eval(ctx, "(+ 1")
+	if !errors.As(err, &lispErr) || lispErr.Kind != minilisp.ErrSyntax {
+		t.Errorf("err = %v, want a syntax-error", err)
+	}
+}
+
+func TestDefine(t *testing.T) {
+	interp := minilisp.New()
+	ctx := context.Background()
+
+	values := map[string]any{
+		"n":      int64(7),
+		"u":      uint8(200),
+		"f":      float32(0.5),
+		"s":      "text",
+		"ok":     true,
+		"nums":   []int{1, 2, 3},
+		"config": map[string]any{"port": 8080, "hosts": []string{"a", "b"}},
+		"none":   nil,
+		"m":      map[string]int{"c": 3, "d": 4, "e": 5, "a": 1, "b": 2},
+		"ids":    map[int]string{10: "x", 2: "y", -1: "z"},
+	}
+	for name, v := range values {
+		if err := interp.Define(name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{"(+ n u)", 207},
+		{"f", 0.5},
+		{"(string-upcase s)", "TEXT"},
+		{"ok", true},
+		{"(length nums)", 3},
+		{`(hash-get config "port")`, 8080},
+		{`(head (hash-get config "hosts"))`, "a"},
+		{"none", nil},
+		{"(hash-keys m)", []any{"a", "b", "c", "d", "e"}},
+		{"(hash-keys ids)", []any{-1, 2, 10}},
+	}
+	for _, tt := range tests {
+		got, err := interp.Eval(ctx, tt.input)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.input, got, err, tt.want)
+		}
+	}
+
+	if err := interp.Define("ch", make(chan int)); err == nil {
+		t.Error("defining a channel should fail")
+	}
+}
+
+func TestDefineFunc(t *testing.T) {
+	interp := minilisp.New()
+	ctx := context.Background()
+
+	interp.Define("shout", func(args ...any) (any, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("want a string, got %v", args[0])
+		}
+		return strings.ToUpper(s), nil
+	})
+	interp.Define("check", func(args ...any) (any, error) {
+		return nil, &minilisp.EvalError{Kind: minilisp.ErrValue, Origin: "check", Message: "bad value"}
+	})
+
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{`(shout "hi")`, "HI"},
+		{`(map shout '("a" "b"))`, []any{"A", "B"}},
+		{"(try (shout 1) (catch (e) (error-message e)))", "want a string, got 1"},
+		{"(try (shout 1) (catch (e) (error-origin e)))", "shout"},
+		{"(try (check) (catch (e value-error) (error-message e)))", "bad value"},
+	}
+	for _, tt := range tests {
+		got, err := interp.Eval(ctx, tt.input)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	interp := minilisp.New()
+	ctx := context.Background()
+	interp.Eval(ctx, `(define greet (lambda (name n) (string-append "hello " name (@string n))))`)
+
+	got, err := interp.Call(ctx, "greet", "ada", 1)
+	if err != nil || got != "hello ada1" {
+		t.Errorf("greet = %#v, %v", got, err)
+	}
+
+	// Lisp functions come back as values that can be passed in again
+	adder, err := interp.Eval(ctx, "(lambda (x) (+ x 1))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = interp.Call(ctx, "map", adder, []int{1, 2})
+	if err != nil || !reflect.DeepEqual(got, []any{2, 3}) {
+		t.Errorf("map = %#v, %v", got, err)
+	}
+
+	var lispErr *minilisp.EvalError
+	if _, err := interp.Call(ctx, "nope"); !errors.As(err, &lispErr) || lispErr.Kind != minilisp.ErrUnbound {
+		t.Errorf("calling nope = %v, want an unbound-error", err)
+	}
+	if _, err := interp.Call(ctx, "greet", "ada"); !errors.As(err, &lispErr) || lispErr.Kind != minilisp.ErrArity {
+		t.Errorf("greet with 1 argument = %v, want an arity-error", err)
+	}
+}
+
+func TestRunKeepsGoing(t *testing.T) {
+	interp := minilisp.New()
+	var errs []string
+	err := interp.Run(context.Background(), "(define a 1)\n(head nil)\n(define b 2)", "script.lisp", func(err error) {
+		errs = append(errs, minilisp.FormatError(err))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Error: head: argument 1 must be a pair, got nil\n  script.lisp:2:1"}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %q, want %q", errs, want)
+	}
+	if got, _ := interp.Eval(context.Background(), "(+ a b)"); got != 3 {
+		t.Errorf("(+ a b) = %v, want 3", got)
+	}
+}
+
+func TestWithoutStdlib(t *testing.T) {
+	interp := minilisp.New(minilisp.WithoutStdlib())
+	var lispErr *minilisp.EvalError
+	if _, err := interp.Eval(context.Background(), "(sum 1 2)"); !errors.As(err, &lispErr) || lispErr.Kind != minilisp.ErrUnbound {
+		t.Errorf("sum = %v, want an unbound-error", err)
+	}
+	if got, _ := interp.Eval(context.Background(), "(+ 1 2)"); got != 3 {
+		t.Errorf("(+ 1 2) = %v, want 3", got)
+	}
+}
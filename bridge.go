@@ -0,0 +1,509 @@
+package minilisp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The reflection bridge. Define takes any Go function, not just a Func,
+// and converts arguments and results to match its signature:
+//
+//	interp.Define("repeat", strings.Repeat)   // (repeat "ab" 3) → "ababab"
+//	interp.Define("atoi", strconv.Atoi)       // a returned error is raised
+//
+// A context.Context first parameter gets the context of the evaluation and
+// isn't passed from Lisp. Lisp functions can be passed where Go wants a
+// func.
+//
+// Structs, and pointers to them, become objects. Keywords read their
+// fields, and the object- builtins set fields and call methods, with Go
+// names written the Lisp way:
+//
+//	(:first-name user)                    ; user.FirstName
+//	(object-set! user :first-name "Ada")
+//	(object-call user :full-name)         ; user.FullName()
+
+var (
+	boolArg   = ArgType{"boolean", "a boolean", func(e *Expr) bool { return e.Type == Bool }}
+	seqArg    = ArgType{"list", "a list or vector", func(e *Expr) bool { return isList(e) || e.Type == Vector }}
+	objectArg = ArgType{"object", "an object", func(e *Expr) bool { return e.Type == Object }}
+	structArg = ArgType{"object", "an object or hash", func(e *Expr) bool { return e.Type == Object || e.Type == Hash }}
+	fieldArg  = ArgType{"key", "a keyword, symbol or string", func(e *Expr) bool {
+		return e.Type == Keyword || e.Type == Symbol || e.Type == String
+	}}
+)
+
+var (
+	contextType = reflect.TypeFor[context.Context]()
+	errorType   = reflect.TypeFor[error]()
+	exprType    = reflect.TypeFor[*Expr]()
+)
+
+// Wrap ptr, a pointer to a struct
+func makeObject(ptr reflect.Value) *Expr {
+	return &Expr{Type: Object, object: &object{Obj: ptr}}
+}
+
+// e.g. main.User
+func objectTypeName(obj *Expr) string {
+	return obj.Obj.Type().Elem().String()
+}
+
+// FirstName → first-name, UserID → user-id, HTTPServer → http-server
+func lispName(goName string) string {
+	runes := []rune(goName)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Does the Lisp name refer to the Go one? Case and dashes don't matter, so
+// :first-name, :firstname and :FirstName all mean FirstName.
+func namesMatch(lisp, goName string) bool {
+	return strings.EqualFold(strings.ReplaceAll(lisp, "-", ""), goName)
+}
+
+// The name in a field or method argument
+func fieldName(key *Expr) string {
+	if key.Type == String {
+		return key.Str
+	}
+	return key.Sym
+}
+
+// What a Lisp argument for a Go parameter of type t has to be, for the
+// signature check
+func argTypeFor(t reflect.Type) ArgType {
+	if t == exprType {
+		return anyArg
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolArg
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return integerArg
+	case reflect.Float32, reflect.Float64:
+		return numberArg
+	case reflect.String:
+		return stringArg
+	case reflect.Slice, reflect.Array:
+		return seqArg
+	case reflect.Map:
+		return hashArg
+	case reflect.Struct:
+		return structArg
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			return structArg
+		}
+	case reflect.Func:
+		return procArg
+	}
+	return anyArg
+}
+
+// The signature of a Go function of type t, leaving out a leading context
+func funcSignature(name string, t reflect.Type) *Signature {
+	first := 0
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		first = 1
+	}
+	var params []ArgType
+	for i := first; i < t.NumIn(); i++ {
+		params = append(params, argTypeFor(paramType(t, i)))
+	}
+
+	n := t.NumIn() - first
+	sig := &Signature{Name: name, Min: n, Max: n, Params: params, Doc: "Go function " + t.String() + "."}
+	if t.IsVariadic() {
+		sig.Min, sig.Max = n-1, -1
+	}
+	return sig
+}
+
+// The type of the i'th parameter, or what the variadic one takes each of
+func paramType(t reflect.Type, i int) reflect.Type {
+	if t.IsVariadic() && i >= t.NumIn()-1 {
+		return t.In(t.NumIn() - 1).Elem()
+	}
+	return t.In(i)
+}
+
+// Wrap fn, any Go func, as a builtin. The name is filled in when it's
+// defined.
+func reflectFunc(fn reflect.Value) *Expr {
+	sig := funcSignature("", fn.Type())
+	return &Expr{Type: Builtin, procedure: &procedure{Sig: sig, EnvFn: func(ctx context.Context, env *Env, args []*Expr) *Expr {
+		return callGo(ctx, env, sig.Name, fn, args)
+	}}}
+}
+
+// Call fn with Lisp arguments that have passed its signature check
+func callGo(ctx context.Context, env *Env, name string, fn reflect.Value, args []*Expr) *Expr {
+	t := fn.Type()
+	var in []reflect.Value
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	first := len(in)
+	for i, arg := range args {
+		pt := paramType(t, first+i)
+		v, ok := goValue(env, arg, pt)
+		if !ok {
+			panic(argError(name, i, "a Go "+pt.String(), arg))
+		}
+		in = append(in, v)
+	}
+	return goResults(name, fn.Call(in))
+}
+
+// Results of a Go call: nothing is nil, one is its value and more make a
+// list. A non-nil error at the end is raised instead.
+func goResults(name string, out []reflect.Value) *Expr {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			panic(goError(name, err))
+		}
+		out = out[:n-1]
+	}
+
+	results := make([]*Expr, len(out))
+	for i, v := range out {
+		results[i] = lispValue(name, v)
+	}
+	switch len(results) {
+	case 0:
+		return nilExpr
+	case 1:
+		return results[0]
+	}
+	return list(results...)
+}
+
+// A Go value as a Lisp one, raising a type-error if it can't be converted
+func lispValue(name string, v reflect.Value) *Expr {
+	if v.Kind() == reflect.Struct && v.CanAddr() {
+		return makeObject(v.Addr())
+	}
+	expr, err := fromGo(v.Interface())
+	if err != nil {
+		panic(errorf(ErrType, name, "%v", err))
+	}
+	return expr
+}
+
+// Convert arg to a Go value of type t, or false if it can't be
+func goValue(env *Env, arg *Expr, t reflect.Type) (reflect.Value, bool) {
+	if t == exprType {
+		return reflect.ValueOf(arg), true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if arg.Type == Bool {
+			return reflect.ValueOf(arg == trueExpr).Convert(t), true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v := reflect.New(t).Elem()
+		if arg.Type == Number && !v.OverflowInt(int64(arg.Num)) {
+			v.SetInt(int64(arg.Num))
+			return v, true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v := reflect.New(t).Elem()
+		if arg.Type == Number && arg.Num >= 0 && !v.OverflowUint(uint64(arg.Num)) {
+			v.SetUint(uint64(arg.Num))
+			return v, true
+		}
+	case reflect.Float32, reflect.Float64:
+		if isNumber(arg) {
+			return reflect.ValueOf(toFloat(arg)).Convert(t), true
+		}
+	case reflect.String:
+		if arg.Type == String {
+			return reflect.ValueOf(arg.Str).Convert(t), true
+		}
+	case reflect.Slice:
+		return goSlice(env, arg, t)
+	case reflect.Map:
+		return goMap(env, arg, t)
+	case reflect.Struct:
+		if arg.Type == Object && arg.Obj.Type().Elem() == t {
+			return arg.Obj.Elem(), true
+		}
+		if arg.Type == Hash {
+			ptr := reflect.New(t)
+			if setFields(env, ptr.Elem(), arg) {
+				return ptr.Elem(), true
+			}
+		}
+	case reflect.Pointer:
+		if arg == nilExpr {
+			return reflect.Zero(t), true
+		}
+		if arg.Type == Object && arg.Obj.Type() == t {
+			return arg.Obj, true
+		}
+		if t.Elem().Kind() == reflect.Struct && arg.Type == Hash {
+			ptr := reflect.New(t.Elem())
+			if setFields(env, ptr.Elem(), arg) {
+				return ptr, true
+			}
+		}
+	case reflect.Func:
+		if isProc(arg) {
+			return lispFunc(env, arg, t), true
+		}
+	case reflect.Interface:
+		if arg == nilExpr {
+			return reflect.Zero(t), true
+		}
+		v := reflect.ValueOf(toGo(arg))
+		if v.Type().AssignableTo(t) {
+			return v, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func goSlice(env *Env, arg *Expr, t reflect.Type) (reflect.Value, bool) {
+	var items []*Expr
+	switch {
+	case arg.Type == Vector:
+		items = arg.Items
+	case isList(arg):
+		items = listToSlice(arg)
+	default:
+		return reflect.Value{}, false
+	}
+
+	s := reflect.MakeSlice(t, len(items), len(items))
+	for i, item := range items {
+		v, ok := goValue(env, item, t.Elem())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		s.Index(i).Set(v)
+	}
+	return s, true
+}
+
+// A hash as a Go map. Keyword keys become strings for string keyed maps.
+func goMap(env *Env, arg *Expr, t reflect.Type) (reflect.Value, bool) {
+	if arg.Type != Hash {
+		return reflect.Value{}, false
+	}
+	m := reflect.MakeMapWithSize(t, arg.HashTable.Len())
+	for _, entry := range arg.HashTable.Entries() {
+		key := entry.Key
+		if key.Type == Keyword && t.Key().Kind() == reflect.String {
+			key = makeStr(key.Sym)
+		}
+		k, ok := goValue(env, key, t.Key())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		v, ok := goValue(env, entry.Val, t.Elem())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		m.SetMapIndex(k, v)
+	}
+	return m, true
+}
+
+// Fill the fields of a struct from a hash, e.g. {:first-name "Ada"}. Keys
+// that aren't fields are an error.
+func setFields(env *Env, v reflect.Value, hash *Expr) bool {
+	for _, entry := range hash.HashTable.Entries() {
+		if !fieldArg.ok(entry.Key) {
+			return false
+		}
+		field, ok := findField(v, fieldName(entry.Key))
+		if !ok {
+			return false
+		}
+		val, ok := goValue(env, entry.Val, field.Type())
+		if !ok {
+			return false
+		}
+		field.Set(val)
+	}
+	return true
+}
+
+// A Go func of type t that calls a Lisp function. Its results are
+// converted to t's. A Lisp error comes back as an *EvalError when t ends in
+// an error result, and is otherwise raised through the Go code that called
+// it.
+//
+// Go code can keep the func and call it after the evaluation that made it
+// has finished, or from another goroutine, so each call is an evaluation
+// of its own with the interpreter's limits. It runs in the func's
+// context.Context argument, if it takes one first, which isn't passed on.
+func lispFunc(env *Env, fn *Expr, t reflect.Type) reflect.Value {
+	n := t.NumOut()
+	returnsError := n > 0 && t.Out(n-1) == errorType
+	takesContext := t.NumIn() > 0 && t.In(0) == contextType
+	interp := env.interpreter()
+
+	return reflect.MakeFunc(t, func(in []reflect.Value) (out []reflect.Value) {
+		out = make([]reflect.Value, n)
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		if returnsError {
+			defer func() {
+				if r := recover(); r != nil {
+					var err error = newError(recoverError(r))
+					out[0] = reflect.Zero(t.Out(0))
+					out[n-1] = reflect.ValueOf(&err).Elem()
+				}
+			}()
+		}
+
+		ctx := context.Background()
+		if takesContext {
+			if c, ok := in[0].Interface().(context.Context); ok && c != nil {
+				ctx = c
+			}
+			in = in[1:]
+		}
+		run, cancel := interp.newEvaluation(ctx)
+		defer cancel()
+		env := interp.env.withEvaluation(run)
+
+		args := make([]*Expr, len(in))
+		for i, v := range in {
+			args[i] = lispValue(frameName(fn), v)
+		}
+		result := applyProc(env, fn, args)
+
+		if n > 0 && t.Out(0) != errorType {
+			v, ok := goValue(env, result, t.Out(0))
+			if !ok {
+				panic(errorf(ErrType, frameName(fn), "result must be a Go %s, got %s", t.Out(0), describeArg(result)))
+			}
+			out[0] = v
+		}
+		return out
+	})
+}
+
+// The exported field of the struct v that name refers to
+func findField(v reflect.Value, name string) (reflect.Value, bool) {
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if f.IsExported() && namesMatch(name, f.Name) {
+			return v.FieldByIndex(f.Index), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// The method of the object that name refers to
+func findMethod(obj *Expr, name string) (reflect.Value, string, bool) {
+	t := obj.Obj.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		if m := t.Method(i); namesMatch(name, m.Name) {
+			return obj.Obj.Method(i), m.Name, true
+		}
+	}
+	return reflect.Value{}, "", false
+}
+
+func noSuchField(origin string, obj *Expr, name string) *Expr {
+	return errorf(ErrValue, origin, "%s has no field %s", objectTypeName(obj), name)
+}
+
+// Read a field, for keywords and object-get. Struct fields come back as
+// objects sharing the parent's memory, so setting their fields sticks.
+func objectField(origin string, obj *Expr, name string) *Expr {
+	field, ok := findField(obj.Obj.Elem(), name)
+	if !ok {
+		panic(noSuchField(origin, obj, name))
+	}
+	return lispValue(origin, field)
+}
+
+// (object? x)
+func builtinObjectP(args []*Expr) *Expr {
+	return makeBool(args[0].Type == Object)
+}
+
+// (object-get obj :field)
+func builtinObjectGet(args []*Expr) *Expr {
+	return objectField("object-get", args[0], fieldName(args[1]))
+}
+
+// (object-set! obj :field value)
+func builtinObjectSet(ctx context.Context, env *Env, args []*Expr) *Expr {
+	obj, name := args[0], fieldName(args[1])
+	field, ok := findField(obj.Obj.Elem(), name)
+	if !ok {
+		panic(noSuchField("object-set!", obj, name))
+	}
+	v, ok := goValue(env, args[2], field.Type())
+	if !ok {
+		panic(argError("object-set!", 2, "a Go "+field.Type().String(), args[2]))
+	}
+	field.Set(v)
+	return args[2]
+}
+
+// (object-call obj :method args...)
+func builtinObjectCall(ctx context.Context, env *Env, args []*Expr) *Expr {
+	obj, name := args[0], fieldName(args[1])
+	method, goName, ok := findMethod(obj, name)
+	if !ok {
+		panic(errorf(ErrValue, "object-call", "%s has no method %s", objectTypeName(obj), name))
+	}
+	sig := funcSignature(objectTypeName(obj)+"."+goName, method.Type())
+	sig.check(args[2:])
+	return callGo(ctx, env, sig.Name, method, args[2:])
+}
+
+// (object-fields obj) → (:first-name :last-name)
+func builtinObjectFields(args []*Expr) *Expr {
+	var names []*Expr
+	for _, f := range reflect.VisibleFields(args[0].Obj.Type().Elem()) {
+		if f.IsExported() && !f.Anonymous {
+			names = append(names, makeKeyword(lispName(f.Name)))
+		}
+	}
+	return list(names...)
+}
+
+// (object-methods obj) → (:full-name :greet)
+func builtinObjectMethods(args []*Expr) *Expr {
+	t := args[0].Obj.Type()
+	names := make([]string, t.NumMethod())
+	for i := range names {
+		names[i] = lispName(t.Method(i).Name)
+	}
+	sort.Strings(names)
+
+	items := make([]*Expr, len(names))
+	for i, name := range names {
+		items[i] = makeKeyword(name)
+	}
+	return list(items...)
+}
+
+// How an object prints, e.g. <object main.User>
+func printObject(obj *Expr) string {
+	return fmt.Sprintf("<object %s>", objectTypeName(obj))
+}
@@ -0,0 +1,283 @@
+package minilisp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type address struct {
+	City     string
+	PostCode string
+}
+
+type user struct {
+	FirstName string
+	LastName  string
+	Age       int
+	Tags      []string
+	Home      address
+	password  string
+}
+
+func (u *user) FullName() string {
+	return u.FirstName + " " + u.LastName
+}
+
+func (u *user) Birthday() {
+	u.Age++
+}
+
+func (u *user) Greet(greeting string, times int) (string, error) {
+	if times < 1 {
+		return "", fmt.Errorf("times must be positive")
+	}
+	return strings.Repeat(greeting+" "+u.FirstName+"! ", times), nil
+}
+
+func setupBridgeEnv(t *testing.T) *Interpreter {
+	interp := New(WithoutStdlib())
+	defs := map[string]any{
+		"repeat": strings.Repeat,
+		"atoi":   strconv.Atoi,
+		"sum-ints": func(xs ...int) int {
+			n := 0
+			for _, x := range xs {
+				n += x
+			}
+			return n
+		},
+		"half":     func(x float64) float64 { return x / 2 },
+		"split":    func(s, sep string) []string { return strings.Split(s, sep) },
+		"count":    func(m map[string]int) int { return len(m) },
+		"divmod":   func(a, b int) (int, int) { return a / b, a % b },
+		"small":    func(n int8) int8 { return n },
+		"ada":      &user{FirstName: "Ada", LastName: "Lovelace", Age: 36, Tags: []string{"maths"}, Home: address{City: "London"}},
+		"new-user": func(u user) *user { return &u },
+		"apply-go": func(f func(int) int, n int) int { return f(n) },
+		"sort-by": func(xs []int, less func(a, b int) bool) []int {
+			sort.Slice(xs, func(i, j int) bool { return less(xs[i], xs[j]) })
+			return xs
+		},
+		"deadline?": func(ctx context.Context) bool { _, ok := ctx.Deadline(); return ok },
+		"fail":      func() error { return errors.New("it broke") },
+		"try-go": func(f func(int) (int, error), n int) string {
+			v, err := f(n)
+			if err != nil {
+				return "caught " + err.Error()
+			}
+			return strconv.Itoa(v)
+		},
+		"pass-error": func(f func(int) (int, error), n int) (int, error) { return f(n) },
+	}
+	for name, v := range defs {
+		if err := interp.Define(name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return interp
+}
+
+func TestReflectFuncs(t *testing.T) {
+	interp := setupBridgeEnv(t)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`(repeat "ab" 3)`, `"ababab"`},
+		{`(atoi "42")`, "42"},
+		{"(sum-ints)", "0"},
+		{"(sum-ints 1 2 3)", "6"},
+		{"(half 3)", "1.5"},
+		{`(split "a,b" ",")`, `("a" "b")`},
+		{`(count {"a" 1 :b 2})`, "2"},
+		{"(divmod 7 2)", "(3 1)"},
+		{"(apply-go (lambda (x) (* x 10)) 4)", "40"},
+		{"(try-go (lambda (x) (+ x 1)) 4)", `"5"`},
+		{"(try-go (lambda (x) (quotient x 0)) 4)", `"caught quotient: division by zero"`},
+		{"(try-go (lambda (x) \"no\") 4)", `"caught lambda: result must be a Go int, got string \"no\""`},
+		{"(sort-by [2 3 1] (lambda (a b) (< a b)))", "(1 2 3)"},
+		{"(deadline?)", "false"},
+		{`(try (atoi "x") (catch (e) (error-origin e)))`, `"atoi"`},
+		{"(doc repeat)", `"Go function func(string, int) string."`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), interp.env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestReflectFuncErrors(t *testing.T) {
+	interp := setupBridgeEnv(t)
+
+	tests := []struct {
+		input string
+		kind  string
+		msg   string
+	}{
+		{`(repeat "ab")`, ErrArity, "repeat: expects 2 arguments"},
+		{`(repeat 1 2)`, ErrType, "repeat: argument 1 must be a string, got number 1"},
+		{`(atoi "x")`, ErrGeneric, `atoi: strconv.Atoi: parsing "x": invalid syntax`},
+		{"(fail)", ErrGeneric, "fail: it broke"},
+		{"(small 300)", ErrType, "small: argument 1 must be a Go int8, got number 300"},
+		{`(split ["a" 1] ",")`, ErrType, `split: argument 1 must be a string, got vector ["a" 1]`},
+		{`(sum-ints 1 "2")`, ErrType, `sum-ints: argument 2 must be an integer, got string "2"`},
+		{`(apply-go (lambda (x) "no") 1)`, ErrType, `lambda: result must be a Go int, got string "no"`},
+		{`(pass-error (lambda (x) (throw 'value-error "bad")) 1)`, ErrValue, "bad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				err := recoverError(recover())
+				if err.Kind != tt.kind || errorMessage(err) != tt.msg {
+					t.Errorf("%s = %s %q, want %s %q", tt.input, err.Kind, errorMessage(err), tt.kind, tt.msg)
+				}
+			}()
+			eval(readStr(tt.input), interp.env)
+		})
+	}
+}
+
+func TestObjects(t *testing.T) {
+	interp := setupBridgeEnv(t)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(object? ada)", "true"},
+		{"(object? {})", "false"},
+		{"ada", "<object minilisp.user>"},
+		{"(:first-name ada)", `"Ada"`},
+		{"(:FirstName ada)", `"Ada"`},
+		{`(object-get ada "age")`, "36"},
+		{"(:tags ada)", `("maths")`},
+		{"(:missing ada 0)", "0"},
+		{"(object-call ada :full-name)", `"Ada Lovelace"`},
+		{`(object-call ada :greet "Hi" 2)`, `"Hi Ada! Hi Ada! "`},
+		{"(begin (object-call ada :birthday) (:age ada))", "37"},
+		{`(begin (object-set! ada :last-name "King") (object-call ada :full-name))`, `"Ada King"`},
+		// Struct fields share memory with their parent
+		{`(begin (object-set! (:home ada) :city "Marylebone") (:city (:home ada)))`, `"Marylebone"`},
+		{"(object-fields ada)", "(:first-name :last-name :age :tags :home)"},
+		{"(object-methods ada)", "(:birthday :full-name :greet)"},
+		{"(= ada ada)", "true"},
+		// Hashes fill in struct arguments
+		{`(object-call (new-user {:first-name "Grace" :last-name "Hopper"}) :full-name)`, `"Grace Hopper"`},
+		{`(json-stringify (new-user {:age 1}))`, `"{\"FirstName\":\"\",\"LastName\":\"\",\"Age\":1,\"Tags\":null,\"Home\":{\"City\":\"\",\"PostCode\":\"\"}}"`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), interp.env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	// Changes made from Lisp are seen by Go
+	u, _ := interp.Call(context.Background(), "new-user", map[string]any{"first-name": "Alan"})
+	if got := u.(*user).FirstName; got != "Alan" {
+		t.Errorf("FirstName = %q, want Alan", got)
+	}
+}
+
+func TestObjectErrors(t *testing.T) {
+	interp := setupBridgeEnv(t)
+
+	tests := []struct {
+		input string
+		kind  string
+		msg   string
+	}{
+		{"(:password ada)", ErrValue, ":password: minilisp.user has no field password"},
+		{"(object-get ada :nope)", ErrValue, "object-get: minilisp.user has no field nope"},
+		{"(object-call ada :nope)", ErrValue, "object-call: minilisp.user has no method nope"},
+		{`(object-call ada :greet "Hi")`, ErrArity, "minilisp.user.Greet: expects 2 arguments"},
+		{`(object-call ada :greet "Hi" 0)`, ErrGeneric, "minilisp.user.Greet: times must be positive"},
+		{`(object-set! ada :age "old")`, ErrType, `object-set!: argument 3 must be a Go int, got string "old"`},
+		{"(object-get {} :a)", ErrType, "object-get: argument 1 must be an object, got hash {}"},
+		{`(new-user {:nope 1})`, ErrType, "new-user: argument 1 must be a Go minilisp.user, got hash {:nope 1}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				err := recoverError(recover())
+				if err.Kind != tt.kind || errorMessage(err) != tt.msg {
+					t.Errorf("%s = %s %q, want %s %q", tt.input, err.Kind, errorMessage(err), tt.kind, tt.msg)
+				}
+			}()
+			eval(readStr(tt.input), interp.env)
+		})
+	}
+}
+
+func TestLispName(t *testing.T) {
+	tests := map[string]string{
+		"FirstName":  "first-name",
+		"ID":         "id",
+		"UserID":     "user-id",
+		"HTTPServer": "http-server",
+		"Age2":       "age2",
+		"V2Api":      "v2-api",
+	}
+	for goName, want := range tests {
+		if got := lispName(goName); got != want {
+			t.Errorf("lispName(%s) = %s, want %s", goName, got, want)
+		}
+	}
+}
+
+func TestLispFuncOutlivesEvaluation(t *testing.T) {
+	interp := New(WithoutStdlib(), WithLimits(Limits{Steps: 1000}))
+	var double func(int) int
+	var wait func(context.Context, int) (int, error)
+	defs := map[string]any{
+		"keep":      func(f func(int) int) { double = f },
+		"keep-wait": func(f func(context.Context, int) (int, error)) { wait = f },
+	}
+	for name, v := range defs {
+		if err := interp.Define(name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := interp.Eval(ctx, `(keep (lambda (n) (* n 2))) (keep-wait (lambda (n) (define (loop i) (loop (+ i 1))) (loop n)))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// each call gets its own steps, so these add up to more than the limit
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := double(21); got != 42 {
+					t.Errorf("double(21) = %d, want 42", got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	waitCtx, stop := context.WithCancel(context.Background())
+	stop()
+	_, err = wait(waitCtx, 0)
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) || evalErr.Kind != ErrCancelled {
+		t.Errorf("wait on a cancelled context = %v, want a cancel-error", err)
+	}
+}
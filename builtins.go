@@ -0,0 +1,428 @@
+package minilisp
+
+import (
+	"sort"
+	"strings"
+)
+
+// Every builtin is registered here with its signature, which is checked
+// before each call, so the builtins themselves can index their arguments
+// without checking the count. The same table feeds the REPL's :help, :doc
+// and tab completion.
+
+// What an argument has to be
+type ArgType struct {
+	Name string // as shown in usage, e.g. number
+	desc string // as used in errors, e.g. a number
+	ok   func(*Expr) bool
+}
+
+var (
+	anyArg        = ArgType{"any", "anything", func(*Expr) bool { return true }}
+	numberArg     = ArgType{"number", "a number", isNumber}
+	integerArg    = ArgType{"integer", "an integer", func(e *Expr) bool { return e.Type == Number || e.Type == BigInt }}
+	stringArg     = ArgType{"string", "a string", func(e *Expr) bool { return e.Type == String }}
+	symbolArg     = ArgType{"symbol", "a symbol", func(e *Expr) bool { return e.Type == Symbol }}
+	pairArg       = ArgType{"pair", "a pair", func(e *Expr) bool { return e.Type == Pair }}
+	listArg       = ArgType{"list", "a list", isList}
+	vectorArg     = ArgType{"vector", "a vector", func(e *Expr) bool { return e.Type == Vector }}
+	hashArg       = ArgType{"hash", "a hash", func(e *Expr) bool { return e.Type == Hash }}
+	keyArg        = ArgType{"key", "a hash key", func(e *Expr) bool { _, ok := hashKey(e); return ok }}
+	procArg       = ArgType{"function", "a function", isProc}
+	errorValueArg = ArgType{"error", "an error", func(e *Expr) bool { return e.Type == Error }}
+)
+
+// A proper list: nil, or pairs ending in nil
+func isList(e *Expr) bool {
+	for ; e.Type == Pair; e = e.Tail {
+	}
+	return e == nilExpr
+}
+
+// Can applyProc call it?
+func isProc(e *Expr) bool {
+	switch e.Type {
+	case Builtin, Lambda, Keyword:
+		return true
+	}
+	return false
+}
+
+// How many arguments a builtin takes and what they have to be. Params
+// holds the type of each argument, the last one also covering any
+// arguments after it.
+type Signature struct {
+	Name   string
+	Min    int
+	Max    int // -1 for no limit
+	Params []ArgType
+	Doc    string
+}
+
+// Panic with an arity-error or type-error unless args fit the signature
+func (s *Signature) check(args []*Expr) {
+	argCount(s.Name, args, s.Min, s.Max)
+	if len(s.Params) == 0 {
+		return
+	}
+	for i, arg := range args {
+		checkArg(s.Name, i, s.Params[min(i, len(s.Params)-1)], arg)
+	}
+}
+
+// How to call the builtin, e.g. (substring string integer [integer])
+func (s *Signature) Usage() string {
+	parts := []string{s.Name}
+	n := max(s.Max, s.Min)
+	if s.Max < 0 {
+		n = max(len(s.Params), s.Min)
+	}
+	for i := 0; i < n; i++ {
+		part := s.Params[min(i, len(s.Params)-1)].Name
+		switch {
+		case s.Max < 0 && i == n-1:
+			part += "..."
+		case i >= s.Min:
+			part = "[" + part + "]"
+		}
+		parts = append(parts, part)
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func argCount(name string, args []*Expr, min, max int) {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		switch {
+		case min == max:
+			panic(errorf(ErrArity, name, "expects %d argument%s", min, plural(min)))
+		case max < 0:
+			panic(errorf(ErrArity, name, "expects at least %d argument%s", min, plural(min)))
+		default:
+			panic(errorf(ErrArity, name, "expects %d to %d arguments", min, max))
+		}
+	}
+}
+
+// Panic with a type-error unless arg is of type t. i is the 0-based index
+// of the argument, reported 1-based.
+func checkArg(name string, i int, t ArgType, arg *Expr) {
+	if !t.ok(arg) {
+		panic(argError(name, i, t.desc, arg))
+	}
+}
+
+// e.g. +: argument 2 must be a number, got string "x"
+func argError(name string, i int, want string, arg *Expr) *Expr {
+	return errorf(ErrType, name, "argument %d must be %s, got %s", i+1, want, describeArg(arg))
+}
+
+// Longest value shown in a type error before it's cut short
+const maxArgDescription = 40
+
+// An argument's type and, for data, its value
+func describeArg(arg *Expr) string {
+	typ := strings.ToLower(string(arg.Type))
+	switch arg.Type {
+	case Nil:
+		return "nil"
+	case Builtin, Lambda, Macro:
+		return typ
+	case Object:
+		return typ + " " + objectTypeName(arg)
+	}
+
+	s := []rune(printExpr(arg))
+	if len(s) > maxArgDescription {
+		s = append(s[:maxArgDescription-3], []rune("...")...)
+	}
+	return typ + " " + string(s)
+}
+
+type builtinDef struct {
+	Signature
+	fn         func([]*Expr) *Expr
+	envFn      EnvBuiltinFunc
+	capability Capability // what a sandbox has to allow for it to run
+}
+
+func newBuiltin(name string, min, max int, fn func([]*Expr) *Expr, params ...ArgType) builtinDef {
+	return builtinDef{Signature: Signature{Name: name, Min: min, Max: max, Params: params}, fn: fn}
+}
+
+func newEnvBuiltin(name string, min, max int, fn EnvBuiltinFunc, params ...ArgType) builtinDef {
+	return builtinDef{Signature: Signature{Name: name, Min: min, Max: max, Params: params}, envFn: fn}
+}
+
+func (def builtinDef) doc(doc string) builtinDef {
+	def.Doc = doc
+	return def
+}
+
+func (def builtinDef) needs(c Capability) builtinDef {
+	def.capability = c
+	return def
+}
+
+var builtinDefs = []builtinDef{
+	newBuiltin("+", 0, -1, builtinAdd, numberArg).
+		doc("Sum of the numbers, 0 if there are none."),
+	newBuiltin("-", 0, -1, builtinSub, numberArg).
+		doc("Subtracts the rest of the numbers from the first."),
+	newBuiltin("*", 0, -1, builtinMul, numberArg).
+		doc("Product of the numbers, 1 if there are none."),
+	newBuiltin("/", 1, -1, builtinDiv, numberArg).
+		doc("Divides the first number by the rest, exactly: (/ 7 2) is 7/2. With one number, its reciprocal."),
+	newBuiltin("=", 2, 2, builtinEq, anyArg).
+		doc("True if the two values are equal. Numbers compare by value and lists, vectors and hashes by contents."),
+	newBuiltin("!=", 2, 2, builtinNotEq, anyArg).
+		doc("True if the two values aren't equal."),
+	newBuiltin("<", 2, 2, builtinLt, numberArg).
+		doc("True if the first number is less than the second."),
+	newBuiltin("<=", 2, 2, builtinEqualOrLt, numberArg).
+		doc("True if the first number is less than or equal to the second."),
+	newBuiltin(">", 2, 2, builtinGt, numberArg).
+		doc("True if the first number is greater than the second."),
+	newBuiltin(">=", 2, 2, builtinEqualOrGt, numberArg).
+		doc("True if the first number is greater than or equal to the second."),
+	newBuiltin("quotient", 2, 2, builtinQuotient, integerArg).
+		doc("Integer division, rounding towards zero."),
+	newBuiltin("remainder", 2, 2, builtinRemainder, integerArg).
+		doc("Remainder of integer division, with the sign of the dividend."),
+	newBuiltin("modulo", 2, 2, builtinModulo, integerArg).
+		doc("Remainder of integer division, with the sign of the divisor."),
+	newBuiltin("floor", 1, 1, builtinFloor, numberArg).
+		doc("Largest integer not greater than the number."),
+	newBuiltin("ceiling", 1, 1, builtinCeiling, numberArg).
+		doc("Smallest integer not less than the number."),
+	newBuiltin("round", 1, 1, builtinRound, numberArg).
+		doc("Nearest integer to the number."),
+
+	newBuiltin("pair", 2, 2, builtinPair, anyArg).
+		doc("A new pair of head and tail, putting head on the front of the list tail."),
+	newBuiltin("list", 0, -1, builtinList, anyArg).
+		doc("A list of the arguments."),
+	newBuiltin("head", 1, 1, builtinHead, pairArg).
+		doc("First element of a list."),
+	newBuiltin("tail", 1, 1, builtinTail, pairArg).
+		doc("Everything after the first element of a list."),
+	newBuiltin("null?", 1, 1, builtinNullP, anyArg).
+		doc("True if the value is nil, the empty list."),
+	newBuiltin("length", 1, 1, builtinLength, listArg).
+		doc("Number of elements in a list."),
+	newEnvBuiltin("append", 0, -1, builtinAppend, listArg).
+		doc("The lists joined together. The last one is shared, not copied."),
+	newBuiltin("reverse", 1, 1, builtinReverse, listArg).
+		doc("The list in reverse order."),
+	newBuiltin("nth", 2, 2, builtinNth, listArg, integerArg).
+		doc("Element i of a list, counting from 0."),
+	newEnvBuiltin("apply", 2, -1, builtinApply, procArg, anyArg).
+		doc("Calls the function with the elements of the last argument, after any arguments in between."),
+	newEnvBuiltin("map", 2, -1, builtinMap, procArg, listArg).
+		doc("List of the function applied to each element. With more lists, takes one element from each."),
+	newEnvBuiltin("for-each", 2, -1, builtinForEach, procArg, listArg).
+		doc("Calls the function on each element, like map, for side effects. Returns nil."),
+	newEnvBuiltin("filter", 2, 2, builtinFilter, procArg, listArg).
+		doc("The elements the function returns true for."),
+	newEnvBuiltin("reduce", 2, 3, builtinReduce, procArg, anyArg, listArg).
+		doc("Combines the elements with the function from the left, starting from init or the first element."),
+	newEnvBuiltin("fold-left", 3, 3, builtinFoldLeft, procArg, anyArg, listArg).
+		doc("Calls (f acc x) for each element from the left, starting with init."),
+	newEnvBuiltin("fold-right", 3, 3, builtinFoldRight, procArg, anyArg, listArg).
+		doc("Calls (f x acc) for each element from the right, starting with init."),
+	newEnvBuiltin("range", 1, 3, builtinRange, integerArg).
+		doc("Integers from start (default 0) up to but not including end, by step (default 1)."),
+	newBuiltin("take", 2, 2, builtinTake, listArg, integerArg).
+		doc("The first n elements of a list."),
+	newBuiltin("drop", 2, 2, builtinDrop, listArg, integerArg).
+		doc("The list without its first n elements."),
+	newBuiltin("zip", 1, -1, builtinZip, listArg).
+		doc("List of lists of the nth element of each list, as long as the shortest."),
+	newEnvBuiltin("sort", 1, 2, builtinSort, listArg, procArg).
+		doc("The list sorted, by a less-than function if given. Numbers and strings sort without one."),
+	newBuiltin("member", 2, 2, builtinMember, anyArg, listArg).
+		doc("The rest of the list from the first element equal to x, or nil."),
+	newBuiltin("assoc", 2, 2, builtinAssoc, anyArg, listArg).
+		doc("The first (key value ...) entry whose key equals key, or nil."),
+	newBuiltin("flatten", 1, 1, builtinFlatten, listArg).
+		doc("Elements of nested lists in one list."),
+	newEnvBuiltin("any?", 2, 2, builtinAnyP, procArg, listArg).
+		doc("True if the function returns true for any element."),
+	newEnvBuiltin("every?", 2, 2, builtinEveryP, procArg, listArg).
+		doc("True if the function returns true for every element."),
+	newEnvBuiltin("find", 2, 2, builtinFind, procArg, listArg).
+		doc("The first element the function returns true for, or nil."),
+
+	newBuiltin("vector", 0, -1, builtinVector, anyArg).
+		doc("A vector of the arguments."),
+	newBuiltin("vector?", 1, 1, builtinVectorP, anyArg).
+		doc("True if the value is a vector."),
+	newBuiltin("vector-length", 1, 1, builtinVectorLength, vectorArg).
+		doc("Number of elements in a vector."),
+	newBuiltin("vector-ref", 2, 2, builtinVectorRef, vectorArg, integerArg).
+		doc("Element i of a vector, counting from 0."),
+	newBuiltin("vector-set!", 3, 3, builtinVectorSet, vectorArg, integerArg, anyArg).
+		doc("Sets element i of a vector in place and returns the vector."),
+	newEnvBuiltin("vector-push", 2, -1, builtinVectorPush, vectorArg, anyArg).
+		doc("Adds values to the end of a vector in place and returns the vector."),
+	newBuiltin("vector-slice", 2, 3, builtinVectorSlice, vectorArg, integerArg).
+		doc("A new vector of the elements from start up to end, or the end of the vector."),
+	newBuiltin("vector->list", 1, 1, builtinVectorToList, vectorArg).
+		doc("A list of the vector's elements."),
+	newEnvBuiltin("list->vector", 1, 1, builtinListToVector, listArg).
+		doc("A vector of the list's elements."),
+
+	newBuiltin("hash", 0, -1, builtinHash, anyArg).
+		doc("A hash of alternating keys and values."),
+	newBuiltin("hash-get", 2, 2, builtinHashGet, hashArg, keyArg).
+		doc("Value stored under key, or nil."),
+	newEnvBuiltin("hash-set", 3, 3, builtinHashSet, hashArg, keyArg, anyArg).
+		doc("Stores value under key in place and returns the hash."),
+	newBuiltin("hash-keys", 1, 1, builtinHashKeys, hashArg).
+		doc("List of the keys, in the order they were added."),
+	newBuiltin("hash-values", 1, 1, builtinHashValues, hashArg).
+		doc("List of the values, in the order their keys were added."),
+	newBuiltin("hash-has?", 2, 2, builtinHashHasP, hashArg, keyArg).
+		doc("True if the hash has key."),
+	newBuiltin("hash-delete", 2, 2, builtinHashDelete, hashArg, keyArg).
+		doc("Removes key in place and returns the hash."),
+	newBuiltin("hash-count", 1, 1, builtinHashCount, hashArg).
+		doc("Number of keys in the hash."),
+	newBuiltin("hash-merge", 1, -1, builtinHashMerge, hashArg).
+		doc("A new hash with the entries of all the hashes, later ones winning."),
+	newEnvBuiltin("hash-update", 3, 4, builtinHashUpdate, hashArg, keyArg, procArg, anyArg).
+		doc("Sets key to the function applied to its current value, or default, and returns the hash."),
+	newBuiltin("hash->list", 1, 1, builtinHashToList, hashArg).
+		doc("List of (key value) lists, in the order keys were added."),
+	newBuiltin("keyword", 1, 1, builtinKeyword, anyArg).
+		doc("The keyword with the name of a string, symbol or keyword."),
+
+	newBuiltin("object?", 1, 1, builtinObjectP, anyArg).
+		doc("Whether the value is a Go object."),
+	newBuiltin("object-get", 2, 2, builtinObjectGet, objectArg, fieldArg).
+		doc("Value of the object's field, e.g. (object-get user :first-name)."),
+	newEnvBuiltin("object-set!", 3, 3, builtinObjectSet, objectArg, fieldArg, anyArg).
+		doc("Sets the object's field in place and returns the value."),
+	newEnvBuiltin("object-call", 2, -1, builtinObjectCall, objectArg, fieldArg, anyArg).
+		doc("Calls a method of the object with the rest of the arguments."),
+	newBuiltin("object-fields", 1, 1, builtinObjectFields, objectArg).
+		doc("The object's fields as keywords."),
+	newBuiltin("object-methods", 1, 1, builtinObjectMethods, objectArg).
+		doc("The object's methods as keywords, sorted."),
+
+	newEnvBuiltin("string-append", 0, -1, builtinStringAppend, stringArg).
+		doc("The strings joined together."),
+	newEnvBuiltin("string-join", 2, 2, builtinStringJoin, listArg, anyArg).
+		doc("The list's elements joined into a string with the separator between them."),
+	newBuiltin("string-length", 1, 1, builtinStringLength, stringArg).
+		doc("Number of characters in a string."),
+	newBuiltin("substring", 2, 3, builtinSubstring, stringArg, integerArg).
+		doc("Characters from start up to end, or the end of the string."),
+	newBuiltin("string-split", 2, 2, builtinStringSplit, stringArg).
+		doc("List of the parts of the string between each separator."),
+	newBuiltin("string-index", 2, 2, builtinStringIndex, stringArg).
+		doc("Index of the first place the second string appears in the first, or nil."),
+	newEnvBuiltin("string-replace", 3, 3, builtinStringReplace, stringArg).
+		doc("The string with every old replaced by new."),
+	newBuiltin("string-upcase", 1, 1, builtinStringUpcase, stringArg).
+		doc("The string in upper case."),
+	newBuiltin("string-downcase", 1, 1, builtinStringDowncase, stringArg).
+		doc("The string in lower case."),
+	newBuiltin("string-trim", 1, 1, builtinStringTrim, stringArg).
+		doc("The string without leading and trailing whitespace."),
+	newBuiltin("string-contains?", 2, 2, builtinStringContainsP, stringArg).
+		doc("True if the second string appears in the first."),
+	newEnvBuiltin("string->list", 1, 1, builtinStringToList, stringArg).
+		doc("List of the string's characters, as one character strings."),
+	newBuiltin("html-escape", 1, 1, builtinHtmlEscape, stringArg).
+		doc("The string with <, >, &, ' and \" escaped for HTML."),
+
+	newBuiltin("number?", 1, 1, builtinNumberP, anyArg).
+		doc("True if the value is a number."),
+	newBuiltin("integer?", 1, 1, builtinIntegerP, anyArg).
+		doc("True if the value is an integer."),
+	newBuiltin("rational?", 1, 1, builtinRationalP, anyArg).
+		doc("True if the value is an integer or exact fraction."),
+	newBuiltin("float?", 1, 1, builtinFloatP, anyArg).
+		doc("True if the value is a float."),
+	newBuiltin("string?", 1, 1, builtinStringP, anyArg).
+		doc("True if the value is a string."),
+	newBuiltin("symbol?", 1, 1, builtinSymbolP, anyArg).
+		doc("True if the value is a symbol."),
+	newBuiltin("keyword?", 1, 1, builtinKeywordP, anyArg).
+		doc("True if the value is a keyword."),
+	newBuiltin("list?", 1, 1, builtinListP, anyArg).
+		doc("True if the value is a non-empty list."),
+	newBuiltin("bool?", 1, 1, builtinBoolP, anyArg).
+		doc("True if the value is true or false."),
+
+	newBuiltin("@json", 1, 2, builtinJsonParse, stringArg, symbolArg).
+		doc("Parses JSON text. Arrays become lists, or vectors with 'vector."),
+	newBuiltin("@string", 1, 1, builtinToString, anyArg).
+		doc("The value as a string."),
+	newBuiltin("@number", 1, 1, builtinToNumber, anyArg).
+		doc("Parses a string as a number."),
+	newBuiltin("@float", 1, 1, builtinToFloat, numberArg).
+		doc("The number as a float."),
+	newBuiltin("json-stringify", 1, 1, builtinJsonStringify, anyArg).
+		doc("The value as JSON text."),
+
+	newEnvBuiltin("print", 1, 1, builtinPrint, anyArg).
+		doc("Prints the value on its own line and returns it."),
+	newEnvBuiltin("fetch", 1, 1, builtinFetch, stringArg).
+		doc("Body of an HTTP GET of the URL.").
+		needs(CapNetClient),
+	newEnvBuiltin("http-server", 2, 2, builtinHttpServer, integerArg, procArg).
+		doc("Serves HTTP on the port, calling the handler with a request hash for each request.").
+		needs(CapNetServer),
+	newEnvBuiltin("gensym", 0, 1, builtinGensym, anyArg).
+		doc("A new symbol that can't clash with any other, starting with the prefix if given."),
+	newEnvBuiltin("doc", 1, 1, builtinDoc, anyArg).
+		doc("The docstring of a function, or of the binding of a quoted name. nil if it has none."),
+
+	newBuiltin("error", 2, 3, builtinError, symbolArg, stringArg, anyArg).
+		doc("A new error value of the kind, with a message and optional payload."),
+	newBuiltin("error?", 1, 1, builtinErrorP, anyArg).
+		doc("True if the value is an error."),
+	newBuiltin("error-kind", 1, 1, builtinErrorKind, errorValueArg).
+		doc("The error's kind, a symbol like type-error."),
+	newBuiltin("error-message", 1, 1, builtinErrorMessage, errorValueArg).
+		doc("The error's message."),
+	newBuiltin("error-payload", 1, 1, builtinErrorPayload, errorValueArg).
+		doc("The error's payload, or nil."),
+	newBuiltin("error-origin", 1, 1, builtinErrorOrigin, errorValueArg).
+		doc("Name of the builtin or form that raised the error, or nil."),
+}
+
+// Define every builtin in env
+func defineBuiltins(env *Env) {
+	in := env.interpreter()
+	for i := range builtinDefs {
+		def := &builtinDefs[i]
+		fn := &Expr{Type: Builtin, procedure: &procedure{Fn: def.fn, EnvFn: def.envFn, Sig: &def.Signature}}
+		if def.capability != "" && !in.sandbox.allows(def.capability) {
+			fn.Fn, fn.EnvFn = deniedBuiltin(def.Name, def.capability), nil
+		}
+		env.Define(def.Name, fn)
+		in.builtins[def.Name] = fn
+	}
+}
+
+// The registered signature for a builtin name
+func lookupSignature(name string) (*Signature, bool) {
+	for i := range builtinDefs {
+		if builtinDefs[i].Name == name {
+			return &builtinDefs[i].Signature, true
+		}
+	}
+	return nil, false
+}
+
+// Names of all builtins, sorted
+func builtinNames() []string {
+	names := make([]string, len(builtinDefs))
+	for i, def := range builtinDefs {
+		names[i] = def.Name
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,155 @@
+package minilisp
+
+import "testing"
+
+func TestSignatureErrors(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		kind  string
+		msg   string
+	}{
+		{"(head)", ErrArity, "head: expects 1 argument"},
+		{"(< 1)", ErrArity, "<: expects 2 arguments"},
+		{"(pair 1)", ErrArity, "pair: expects 2 arguments"},
+		{"(/)", ErrArity, "/: expects at least 1 argument"},
+		{"(substring \"abc\")", ErrArity, "substring: expects 2 to 3 arguments"},
+		{`(+ 1 "x")`, ErrType, `+: argument 2 must be a number, got string "x"`},
+		{"(head nil)", ErrType, "head: argument 1 must be a pair, got nil"},
+		{"(< 1 'a)", ErrType, "<: argument 2 must be a number, got symbol a"},
+		{"(map 1 '(1))", ErrType, "map: argument 1 must be a function, got number 1"},
+		{"(length (pair 1 2))", ErrType, "length: argument 1 must be a list, got pair (1 . 2)"},
+		{"(vector-ref [1] :a)", ErrType, "vector-ref: argument 2 must be an integer, got keyword :a"},
+		{"(hash-get {} [1])", ErrType, "hash-get: argument 2 must be a hash key, got vector [1]"},
+		{"(error-kind 1)", ErrType, "error-kind: argument 1 must be an error, got number 1"},
+		{"(string-length (lambda (x) x))", ErrType, "string-length: argument 1 must be a string, got lambda"},
+		{`(string-upcase "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" 1)`, ErrArity, "string-upcase: expects 1 argument"},
+		{`(string-upcase 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa)`, ErrType, "string-upcase: argument 1 must be a string, got symbol aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				err := recoverError(r)
+				if err.Kind != tt.kind || errorMessage(err) != tt.msg {
+					t.Errorf("%s = %s %q, want %s %q", tt.input, err.Kind, errorMessage(err), tt.kind, tt.msg)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+// Whatever they're called with, builtins should raise Lisp errors rather
+// than crash with a Go panic like index out of range
+func TestBuiltinsNeverPanicInGo(t *testing.T) {
+	env := setupFullEnv()
+	// Fresh values for every call, as some builtins mutate their arguments
+	values := []func() *Expr{
+		func() *Expr { return nilExpr },
+		func() *Expr { return makeNum(1) },
+		func() *Expr { return makeStr("x") },
+		func() *Expr { return list(makeNum(1)) },
+		func() *Expr { return makeHash() },
+		func() *Expr { return makeVector(nil) },
+	}
+	skip := map[string]bool{"print": true, "fetch": true, "http-server": true}
+
+	var call func(fn *Expr, args []*Expr, n int)
+	call = func(fn *Expr, args []*Expr, n int) {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := r.(*Expr); !ok {
+						t.Errorf("%s with %d arguments panicked in Go: %v", fn.Sig.Name, len(args), r)
+					}
+				}
+			}()
+			applyProc(env, fn, args)
+		}()
+		if n == 0 {
+			return
+		}
+		for _, v := range values {
+			call(fn, append(append([]*Expr{}, args...), v()), n-1)
+		}
+	}
+
+	for _, name := range builtinNames() {
+		if skip[name] {
+			continue
+		}
+		fn, _ := env.Lookup(name)
+		call(fn, nil, 3)
+	}
+}
+
+func TestSignatureUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"+", "(+ number...)"},
+		{"head", "(head pair)"},
+		{"hash-get", "(hash-get hash key)"},
+		{"substring", "(substring string integer [integer])"},
+		{"hash-update", "(hash-update hash key function [any])"},
+		{"map", "(map function list...)"},
+		{"gensym", "(gensym [any])"},
+	}
+
+	for _, tt := range tests {
+		sig, ok := lookupSignature(tt.name)
+		if !ok {
+			t.Fatalf("%s isn't registered", tt.name)
+		}
+		if got := sig.Usage(); got != tt.want {
+			t.Errorf("usage of %s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStdLibRunsWithSignatures(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr("(define defmacro (macro (name params &rest body) `(define ,name (macro ,params (begin ,@body)))))"), env)
+	loadStdLib(env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(sum 1 2 3)", "6"},
+		{"(factorial 5)", "120"},
+		{"(unwrap (ok 1))", "1"},
+		{"(-> 1 (+ 2) (* 3))", "9"},
+		{`(html-escape "<b>")`, `"&lt;b&gt;"`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEveryBuiltinHasADistinctName(t *testing.T) {
+	seen := map[string]bool{}
+	for _, def := range builtinDefs {
+		if seen[def.Name] {
+			t.Errorf("%s is registered twice", def.Name)
+		}
+		seen[def.Name] = true
+		if (def.fn == nil) == (def.envFn == nil) {
+			t.Errorf("%s needs exactly one of fn and envFn", def.Name)
+		}
+	}
+	if len(seen) == 0 {
+		t.Fatal("no builtins registered")
+	}
+}
@@ -0,0 +1,92 @@
+// The minilisp command: a REPL, or runs Lisp piped to it
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/crbroughton/minilisp"
+)
+
+// Read all input from stdin (for piped input)
+func readAllInput() string {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// e.g. "a, b" → [a b]
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func main() {
+	noStdlib := flag.Bool("no-stdlib", false, "start without the standard library")
+	stdlibDir := flag.String("stdlib-dir", os.Getenv("MINILISP_STDLIB"), "read std: files from `dir` instead of the built in copy")
+	timeout := flag.Duration("timeout", 0, "stop piped input, or each REPL line, after this long, e.g. 5s")
+	sandbox := flag.Bool("sandbox", false, "only let scripts do what --allow lists")
+	allow := flag.String("allow", "", "comma separated `capabilities` sandboxed scripts have: fs-read, fs-write, net-client, net-server, process")
+	loadRoot := flag.String("load-root", "", "only let sandboxed scripts load files under `dir`")
+	fetchHosts := flag.String("fetch-hosts", "", "comma separated `hosts` sandboxed scripts can fetch from, e.g. api.github.com,*.example.com")
+	treeWalker := flag.Bool("tree-walker", false, "evaluate with the tree walker rather than compiling to bytecode")
+	flag.Parse()
+
+	var opts []minilisp.Option
+	if *noStdlib {
+		opts = append(opts, minilisp.WithoutStdlib())
+	}
+	if *stdlibDir != "" {
+		opts = append(opts, minilisp.WithStdlibDir(*stdlibDir))
+	}
+	if *timeout > 0 {
+		opts = append(opts, minilisp.WithLimits(minilisp.Limits{Timeout: *timeout}))
+	}
+	if *treeWalker {
+		opts = append(opts, minilisp.WithBackend(minilisp.TreeWalker))
+	}
+	if *sandbox || *allow != "" || *loadRoot != "" || *fetchHosts != "" {
+		s := minilisp.Sandbox{LoadRoot: *loadRoot, FetchHosts: splitList(*fetchHosts)}
+		for _, name := range splitList(*allow) {
+			c, err := minilisp.ParseCapability(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "minilisp: --allow:", err)
+				os.Exit(2)
+			}
+			s.Allow = append(s.Allow, c)
+		}
+		opts = append(opts, minilisp.WithSandbox(s))
+	}
+	interp := minilisp.New(opts...)
+
+	// Check if input is from pipe/file or interactive
+	stat, _ := os.Stdin.Stat()
+	if (stat.Mode() & os.ModeCharDevice) == 0 {
+		// Piped input - read all at once, and keep going past errors.
+		// Results aren't printed unless using print.
+		input := readAllInput()
+		err := interp.Run(context.Background(), input, "<stdin>", func(err error) {
+			fmt.Println(minilisp.FormatError(err))
+		})
+		if err != nil {
+			fmt.Println(minilisp.FormatError(err))
+			os.Exit(1)
+		}
+	} else if err := interp.REPL(); err != nil {
+		fmt.Fprintln(os.Stderr, "minilisp:", err)
+		os.Exit(1)
+	}
+}
@@ -1,9 +1,6 @@
-package main
+package minilisp
 
-import (
-	"fmt"
-	"os"
-)
+import "fmt"
 
 const (
 	colourReset  = "\033[0m"
@@ -16,49 +13,43 @@ const (
 	colourGray   = "\033[37m"
 )
 
-var useColours = true
-
-func init() {
-	if os.Getenv("NO_COLOR") != "" {
-		useColours = false
-	}
-}
-
-func colourise(colour, text string) string {
-	if !useColours {
+func (in *Interpreter) colourise(colour, text string) string {
+	if !in.colour {
 		return text
 	}
 	return colour + text + colourReset
 }
 
-func printResult(expr *Expr) {
-	output := printExprColoured(expr)
-	fmt.Println("=>", output)
+func (in *Interpreter) printResult(expr *Expr) {
+	output := in.printExprColoured(expr)
+	fmt.Fprintln(in.stdout, "=>", output)
 }
 
-func printExprColoured(e *Expr) string {
+func (in *Interpreter) printExprColoured(e *Expr) string {
 	if e == nil || e == nilExpr {
-		return colourise(colourGray, "nil")
+		return in.colourise(colourGray, "nil")
 	}
 	if e == trueExpr {
-		return colourise(colourGreen, "true")
+		return in.colourise(colourGreen, "true")
 	}
 	if e == falseExpr {
-		return colourise(colourRed, "false")
+		return in.colourise(colourRed, "false")
 	}
 
 	switch e.Type {
-	case Number:
-		return colourise(colourCyan, printExpr(e))
+	case Number, Float, BigInt, Rational:
+		return in.colourise(colourCyan, printExpr(e))
 	case String:
-		return colourise(colourYellow, printExpr(e))
-	case Symbol:
-		return colourise(colourPurple, printExpr(e))
-	case Builtin, Lambda, Macro:
-		return colourise(colourBlue, printExpr(e))
+		return in.colourise(colourYellow, printExpr(e))
+	case Symbol, Keyword:
+		return in.colourise(colourPurple, printExpr(e))
+	case Builtin, Lambda, Macro, Object:
+		return in.colourise(colourBlue, printExpr(e))
 	case Hash:
-		return colourise(colourGreen, printExpr(e))
-	case Pair:
+		return in.colourise(colourGreen, printExpr(e))
+	case Error:
+		return in.colourise(colourRed, printExpr(e))
+	case Pair, Vector:
 		// For lists, colourise the structure but not individual elements
 		return printExpr(e)
 	default:
@@ -0,0 +1,684 @@
+package minilisp
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The bytecode compiler. A form is compiled the first time it runs, once
+// the macros it uses have been defined, into code for the VM in vm.go.
+// The code does exactly what eval does to the form, down to where errors
+// point and the frames in their traces, but finds locals by position
+// rather than by name.
+//
+// Lambda parameters, let bindings and defines at the top of a body each
+// get a slot in their environment (see scope), so a local is found by
+// counting frames out and indexing rather than hashing its name in every
+// frame on the way. Globals, and names the compiler can't see like those
+// defined by load or a define inside an if, are looked up by name as
+// before.
+//
+// Lambda bodies are compiled when the lambda is first called. Macro calls
+// are expanded every time they run, like eval does, but the code for the
+// last expansion is kept, so a cond in a loop is only compiled again if
+// the macro gives back a different form.
+//
+// Malformed special forms compile to code raising the error eval would,
+// so they only fail if they run.
+
+type opcode uint8
+
+const (
+	opConst     opcode = iota // push consts[a]
+	opLocal                   // push slot b of the environment a frames out
+	opGlobal                  // push symbol consts[a], looked up by name past b frames with slots
+	opSetLocal                // set slot b of the environment a frames out to the top value
+	opSetGlobal               // set symbol consts[a] to the top value
+	opDefine                  // define symbol consts[a] as the top value, with docstring consts[b]
+	opShadow                  // warn if defining symbol consts[b] in define form consts[a] hides an outer one
+	opPop                     // drop the top value
+	opJump                    // go to a
+	opJumpFalse               // pop a value and go to a if it's false or nil
+	opAnd                     // go to a if the top value is false or nil, else pop it
+	opOr                      // go to a if the top value is true, else pop it
+	opNot                     // replace the top value with whether it's false or nil
+	opVector                  // replace the top a values with a vector of them
+	opClosure                 // push a lambda made from protos[a]
+	opMacro                   // if the top value is a macro, run macros[a] expanded in place, then go to b
+	opCall                    // call the function under the top a values with them
+	opTailCall                // the same, replacing this frame
+	opReturn                  // return the top value from this frame
+	opEnter                   // go into a new environment with the names in scopes[a]
+	opBind                    // bind the top b values to binds[a], binds[a+1]...
+	opLeave                   // go back out a environments
+	opNamedLet                // start the loop named[a] with its inits on the stack, replacing this frame if b is 1
+	opForm                    // push the value of form consts[a], evaluated by the same Go code as eval
+	opRaise                   // raise a copy of the error consts[a]
+)
+
+type instr struct {
+	op   opcode
+	a, b int32
+}
+
+// Compiled code for a form or lambda body
+type code struct {
+	instrs []instr
+	pos    []*Position // where each instruction's form was read, nil if it wasn't
+	outer  []*Position // where a lambda called by each instruction points errors with no position of their own
+	consts []*Expr
+	protos []*proto
+	scopes []*scope
+	binds  []binding
+	named  []*namedLet
+	macros []*macroSite
+}
+
+// The names of an environment's slots, and of the slots of the
+// environments around it as far out as the compiler could see. An
+// environment made by compiled code for a scope is always inside one
+// made for the scope's parent.
+type scope struct {
+	names  []string
+	parent *scope
+}
+
+// The slot for name, or -1. A nil scope has no slots.
+func (s *scope) index(name string) int {
+	if s == nil {
+		return -1
+	}
+	for i, n := range s.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// A lambda expression, shared by every lambda made by evaluating it. Its
+// body is compiled on the first call.
+type proto struct {
+	params *Expr
+	body   *Expr
+	doc    string
+	parent *scope // of the environment the lambda is made in
+
+	once   sync.Once
+	scope  *scope
+	code   *code
+	simple bool // the params are all distinct plain names, so args go straight into slots
+	arity  int
+}
+
+// One pattern of a let, let* or letrec
+type binding struct {
+	pattern *Expr
+	slot    int // for a plain name, or -1 to bind the pattern by name
+	origin  string
+}
+
+// A named let: the loop lambda, and the scope of the environment holding
+// its name
+type namedLet struct {
+	scope *scope
+	proto *proto
+	name  string
+	n     int // inits
+}
+
+// A call that might turn out to be a macro call
+type macroSite struct {
+	form      *Expr
+	scope     *scope
+	forms     []*Position // see compiler
+	tail      bool
+	expansion atomic.Pointer[expansion]
+}
+
+type expansion struct {
+	macro *Expr
+	form  *Expr
+	code  *code
+}
+
+// Code for a form and the scope it was compiled for
+type compiledForm struct {
+	scope *scope
+	code  *code
+}
+
+// Most forms compiled for eval an evaluation keeps at once. Forms made to
+// pass to eval would otherwise be kept until it ends.
+const maxCompiledForms = 1024
+
+// The code for evaluating e in env, compiled the first time the evaluation
+// runs it. Forms inside try, quasiquote and the like are run by eval each
+// time round a loop, so the evaluation keeps what it compiled.
+func compileForm(e *Expr, env *Env) *code {
+	run := env.evaluation()
+	if cf, ok := run.compiled[e]; ok && cf.scope == env.scope {
+		return cf.code
+	}
+	c := newCompiler(env.scope, env, []*Position{nil})
+	c.expr(e, true)
+	c.emit(opReturn, 0, 0)
+	if run.compiled == nil || len(run.compiled) >= maxCompiledForms {
+		run.compiled = make(map[*Expr]compiledForm)
+	}
+	run.compiled[e] = compiledForm{env.scope, c.code}
+	return c.code
+}
+
+// The proto fn runs, made for it if it's a lambda eval made
+func protoOf(fn *Expr) *proto {
+	if p := fn.proto.Load(); p != nil {
+		return p
+	}
+	p := &proto{params: fn.Params, body: fn.Body, doc: fn.Doc, parent: fn.Env.scope}
+	if !fn.proto.CompareAndSwap(nil, p) {
+		p = fn.proto.Load()
+	}
+	return p
+}
+
+// The compiled body, compiling it on the first call. env is where the
+// lambda was made, for telling macros from special forms.
+func (p *proto) compiled(env *Env) *code {
+	p.once.Do(func() {
+		names := paramNames(p.params)
+		p.simple, p.arity = simpleParams(p.params)
+		p.scope = &scope{names: definedNames(p.body, names), parent: p.parent}
+
+		c := newCompiler(p.scope, env, []*Position{nil})
+		c.expr(p.body, true)
+		c.emit(opReturn, 0, 0)
+		p.code = c.code
+	})
+	return p.code
+}
+
+// Expand the macro call at the site with m, reusing the code for the
+// last expansion if m gave back the same form
+func (s *macroSite) expand(m *Expr, env *Env) *code {
+	expanded := expandMacro(env, m, s.form)
+	inheritPos(expanded, s.form.Pos)
+	if e := s.expansion.Load(); e != nil && e.macro == m && sameForm(e.form, expanded) {
+		return e.code
+	}
+
+	c := newCompiler(s.scope, env, append([]*Position(nil), s.forms...))
+	c.expr(expanded, true)
+	c.emit(opReturn, 0, 0)
+	s.expansion.Store(&expansion{m, expanded, c.code})
+	return c.code
+}
+
+// Would a and b compile to the same code? Pairs must have been read from
+// the same place, as errors point there, and anything that isn't a
+// symbol, keyword, string or number must be the very same value.
+func sameForm(a, b *Expr) bool {
+	for a.Type == Pair && b.Type == Pair {
+		if a.Pos != b.Pos || !sameForm(a.Head, b.Head) {
+			return false
+		}
+		a, b = a.Tail, b.Tail
+	}
+	if a == b {
+		return true
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case Symbol, Keyword:
+		return a.Sym == b.Sym
+	case String:
+		return a.Str == b.Str
+	case Number:
+		return a.Num == b.Num
+	case Float:
+		return a.Float == b.Float
+	case Vector:
+		if len(a.Items) != len(b.Items) {
+			return false
+		}
+		for i := range a.Items {
+			if !sameForm(a.Items[i], b.Items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func addName(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// The names a pattern binds, added to names
+func patternNames(pat *Expr, names []string) []string {
+	switch {
+	case pat.Type == Symbol:
+		if pat.Sym != "_" && pat.Sym != "&rest" {
+			names = addName(names, pat.Sym)
+		}
+	case pat.Type == Pair && pat.Head.Type == Symbol && pat.Head.Sym == "hash":
+		for p := pat.Tail; p.Type == Pair && p.Tail.Type == Pair; p = p.Tail.Tail {
+			names = patternNames(p.Tail.Head, names)
+		}
+	case pat.Type == Pair:
+		for ; pat.Type == Pair; pat = pat.Tail {
+			names = patternNames(pat.Head, names)
+		}
+	}
+	return names
+}
+
+func paramNames(params *Expr) []string {
+	var names []string
+	for ; params.Type == Pair; params = params.Tail {
+		names = patternNames(params.Head, names)
+	}
+	return names
+}
+
+// Are params plain names with no duplicates, _ or &rest? They're bound to
+// the first slots in order.
+func simpleParams(params *Expr) (bool, int) {
+	var seen []string
+	for ; params.Type == Pair; params = params.Tail {
+		p := params.Head
+		if p.Type != Symbol || p.Sym == "_" || p.Sym == "&rest" || len(addName(seen, p.Sym)) == len(seen) {
+			return false, 0
+		}
+		seen = append(seen, p.Sym)
+	}
+	return params == nilExpr, len(seen)
+}
+
+// Names defined at the top of a body, added to names, so they get slots
+// in the body's environment
+func definedNames(body *Expr, names []string) []string {
+	if body.Type != Pair || body.Head.Type != Symbol {
+		return names
+	}
+	switch body.Head.Sym {
+	case "define":
+		if body.Tail.Type == Pair && body.Tail.Head.Type == Symbol {
+			names = addName(names, body.Tail.Head.Sym)
+		}
+	case "begin":
+		for f := body.Tail; f.Type == Pair; f = f.Tail {
+			names = definedNames(f.Head, names)
+		}
+	}
+	return names
+}
+
+var specialForms = map[string]bool{
+	"quote": true, "quasiquote": true, "unquote": true, "unquote-splicing": true,
+	"if": true, "not": true, "and": true, "or": true, "define": true, "set!": true,
+	"macro": true, "syntax-rules": true, "macroexpand-1": true, "macroexpand": true,
+	"lambda": true, "let": true, "let*": true, "letrec": true, "begin": true,
+	"load": true, "import": true, "module": true, "try": true, "throw": true,
+}
+
+type compiler struct {
+	code  *code
+	scope *scope
+	env   *Env // where the code runs, for telling macros from special forms
+
+	// The positions of the forms eval would be evaluating at this point,
+	// one per nested call of eval, innermost last. An error points at the
+	// innermost one that has a position.
+	forms []*Position
+}
+
+func newCompiler(s *scope, env *Env, forms []*Position) *compiler {
+	return &compiler{code: &code{}, scope: s, env: env, forms: forms}
+}
+
+func firstPos(forms []*Position) *Position {
+	for i := len(forms) - 1; i >= 0; i-- {
+		if forms[i] != nil {
+			return forms[i]
+		}
+	}
+	return nil
+}
+
+func (c *compiler) emit(op opcode, a, b int) int {
+	c.code.instrs = append(c.code.instrs, instr{op, int32(a), int32(b)})
+	c.code.pos = append(c.code.pos, firstPos(c.forms))
+	c.code.outer = append(c.code.outer, firstPos(c.forms[:len(c.forms)-1]))
+	return len(c.code.instrs) - 1
+}
+
+// Point the jump at i here
+func (c *compiler) patch(i int) {
+	c.code.instrs[i].a = int32(len(c.code.instrs))
+}
+
+func (c *compiler) constant(e *Expr) int {
+	c.code.consts = append(c.code.consts, e)
+	return len(c.code.consts) - 1
+}
+
+// Find name in the scopes, returning how many frames out and its slot.
+// If it isn't there, depth is the number of frames with slots.
+func (c *compiler) resolve(name string) (depth, slot int, ok bool) {
+	for s := c.scope; s != nil; s = s.parent {
+		if i := s.index(name); i >= 0 {
+			return depth, i, true
+		}
+		depth++
+	}
+	return depth, -1, false
+}
+
+// Compile x, leaving its value on the stack. In tail position it may
+// return from the frame instead, and whatever compiles the last form in
+// tail position emits the opReturn after it.
+func (c *compiler) expr(x *Expr, tail bool) {
+	top := len(c.forms) - 1
+	switch {
+	case x.Type != Pair && !tail:
+		c.atom(x)
+	case !tail:
+		// eval calls itself for the form
+		c.forms = append(c.forms, x.Pos)
+		c.pair(x, false)
+		c.forms = c.forms[:top+1]
+	default:
+		// eval's loop carries on with the form in place of the last one
+		saved := c.forms[top]
+		c.forms[top] = x.Pos
+		if x.Type == Pair {
+			c.pair(x, true)
+		} else {
+			c.atom(x)
+		}
+		c.forms[top] = saved
+	}
+}
+
+func (c *compiler) atom(x *Expr) {
+	switch x.Type {
+	case Symbol:
+		if depth, slot, ok := c.resolve(x.Sym); ok {
+			c.emit(opLocal, depth, slot)
+		} else {
+			c.emit(opGlobal, c.constant(x), depth)
+		}
+	case Vector:
+		for _, item := range x.Items {
+			c.expr(item, false)
+		}
+		c.emit(opVector, len(x.Items), 0)
+	default:
+		c.emit(opConst, c.constant(x), 0)
+	}
+}
+
+func (c *compiler) pair(x *Expr, tail bool) {
+	if op := x.Head; op.Type == Symbol && specialForms[op.Sym] && !c.isMacro(op.Sym) {
+		c.special(x, tail)
+		return
+	}
+	c.call(x, tail)
+}
+
+// Is name a macro here? Special forms can be overridden by one.
+func (c *compiler) isMacro(name string) bool {
+	if _, _, ok := c.resolve(name); ok {
+		return false
+	}
+	val, ok := c.env.Lookup(name)
+	return ok && val.Type == Macro
+}
+
+// (op args...): a function call, or a macro call if op turns out to be one
+func (c *compiler) call(x *Expr, tail bool) {
+	op := x.Head
+	c.expr(op, false)
+	check := -1
+	if op.Type == Symbol {
+		c.code.macros = append(c.code.macros, &macroSite{
+			form:  x,
+			scope: c.scope,
+			forms: append([]*Position(nil), c.forms...),
+			tail:  tail,
+		})
+		check = c.emit(opMacro, len(c.code.macros)-1, 0)
+	}
+
+	n := 0
+	for args := x.Tail; args != nilExpr && args.Type == Pair; args = args.Tail {
+		c.expr(args.Head, false)
+		n++
+	}
+	if tail {
+		c.emit(opTailCall, n, 0)
+	} else {
+		c.emit(opCall, n, 0)
+	}
+	if check >= 0 {
+		c.code.instrs[check].b = int32(len(c.code.instrs))
+	}
+}
+
+func (c *compiler) special(x *Expr, tail bool) {
+	// Syntax errors are raised when the form runs, like eval does
+	mark, s, depth, top := len(c.code.instrs), c.scope, len(c.forms), c.forms[len(c.forms)-1]
+	defer func() {
+		if r := recover(); r != nil {
+			c.code.instrs = c.code.instrs[:mark]
+			c.code.pos = c.code.pos[:mark]
+			c.code.outer = c.code.outer[:mark]
+			c.scope = s
+			c.forms = c.forms[:depth]
+			c.forms[depth-1] = top
+			c.emit(opRaise, c.constant(recoverError(r)), 0)
+		}
+	}()
+
+	op, args := x.Head, x.Tail
+	switch op.Sym {
+	case "quote":
+		c.emit(opConst, c.constant(args.Head), 0)
+	case "quasiquote", "macro", "syntax-rules", "macroexpand-1", "macroexpand",
+		"load", "import", "module", "try", "throw":
+		c.emit(opForm, c.constant(x), 0)
+	case "unquote", "unquote-splicing":
+		panic(errorf(ErrSyntax, op.Sym, "not inside a quasiquote"))
+	case "if":
+		c.expr(args.Head, false)
+		jumpElse := c.emit(opJumpFalse, 0, 0)
+		c.expr(args.Tail.Head, tail)
+		jumpEnd := -1
+		if tail {
+			c.emit(opReturn, 0, 0)
+		} else {
+			jumpEnd = c.emit(opJump, 0, 0)
+		}
+		c.patch(jumpElse)
+		if args.Tail.Tail != nilExpr {
+			c.expr(args.Tail.Tail.Head, tail)
+		} else {
+			c.emit(opConst, c.constant(nilExpr), 0)
+		}
+		if jumpEnd >= 0 {
+			c.patch(jumpEnd)
+		}
+	case "not":
+		c.expr(args.Head, false)
+		c.emit(opNot, 0, 0)
+	case "and", "or":
+		if args == nilExpr {
+			c.emit(opConst, c.constant(makeBool(op.Sym == "and")), 0)
+			return
+		}
+		jump := opAnd
+		if op.Sym == "or" {
+			jump = opOr
+		}
+		var jumps []int
+		for ; args.Tail != nilExpr; args = args.Tail {
+			c.expr(args.Head, false)
+			jumps = append(jumps, c.emit(jump, 0, 0))
+		}
+		c.expr(args.Head, tail)
+		for _, j := range jumps {
+			c.patch(j)
+		}
+	case "define":
+		sym := args.Head
+		if sym.Type != Symbol {
+			panic(errorf(ErrSyntax, "define", "name must be a symbol, got %s", printExpr(sym)))
+		}
+		c.emit(opShadow, c.constant(x), c.constant(sym))
+		doc, value := splitDoc(args.Tail)
+		c.expr(value.Head, false)
+		c.emit(opDefine, c.constant(sym), c.constant(makeStr(doc)))
+	case "set!":
+		sym := args.Head
+		if sym.Type != Symbol {
+			panic(errorf(ErrSyntax, "set!", "name must be a symbol, got %s", printExpr(sym)))
+		}
+		c.expr(args.Tail.Head, false)
+		if depth, slot, ok := c.resolve(sym.Sym); ok {
+			c.emit(opSetLocal, depth, slot)
+		} else {
+			c.emit(opSetGlobal, c.constant(sym), 0)
+		}
+	case "lambda":
+		doc, body := splitDoc(args.Tail)
+		c.code.protos = append(c.code.protos, &proto{params: args.Head, body: implicitBegin(body), doc: doc, parent: c.scope})
+		c.emit(opClosure, len(c.code.protos)-1, 0)
+	case "let", "let*", "letrec":
+		c.let(op.Sym, args, tail)
+	case "begin":
+		if args == nilExpr {
+			c.emit(opConst, c.constant(nilExpr), 0)
+			return
+		}
+		for ; args.Tail != nilExpr; args = args.Tail {
+			c.expr(args.Head, false)
+			c.emit(opPop, 0, 0)
+		}
+		c.expr(args.Head, tail)
+	}
+}
+
+// Go into a new environment with slots for names
+func (c *compiler) enter(names []string) {
+	c.scope = &scope{names: names, parent: c.scope}
+	c.code.scopes = append(c.code.scopes, c.scope)
+	c.emit(opEnter, len(c.code.scopes)-1, 0)
+}
+
+// Bind the values of bindings, which are on the stack, in the current
+// environment
+func (c *compiler) bind(kind string, bindings []*Expr) {
+	first := len(c.code.binds)
+	for _, b := range bindings {
+		slot := -1
+		if b.Head.Type == Symbol && b.Head.Sym != "_" {
+			slot = c.scope.index(b.Head.Sym)
+		}
+		c.code.binds = append(c.code.binds, binding{b.Head, slot, kind})
+	}
+	c.emit(opBind, first, len(bindings))
+}
+
+// The same environments as evalLet makes
+func (c *compiler) let(kind string, args *Expr, tail bool) {
+	if args == nilExpr {
+		panic(errorf(ErrSyntax, kind, "expects bindings and a body"))
+	}
+	if kind == "let" && args.Head.Type == Symbol {
+		c.namedLet(args, tail)
+		return
+	}
+
+	bindings := letBindings(kind, args.Head)
+	body := implicitBegin(args.Tail)
+	outer := c.scope
+	frames := 1
+
+	var names []string
+	for _, b := range bindings {
+		names = patternNames(b.Head, names)
+	}
+
+	switch kind {
+	case "let":
+		for _, b := range bindings {
+			c.expr(b.Tail.Head, false)
+		}
+		c.enter(definedNames(body, names))
+		c.bind(kind, bindings)
+	case "let*":
+		if len(bindings) == 0 {
+			c.enter(definedNames(body, nil))
+		} else {
+			c.enter(nil)
+		}
+		for i, b := range bindings {
+			c.expr(b.Tail.Head, false)
+			names := patternNames(b.Head, nil)
+			if i == len(bindings)-1 {
+				names = definedNames(body, names)
+			}
+			c.enter(names)
+			c.bind(kind, bindings[i:i+1])
+			frames++
+		}
+	default:
+		c.enter(definedNames(body, names))
+		for i, b := range bindings {
+			c.expr(b.Tail.Head, false)
+			c.bind(kind, bindings[i:i+1])
+		}
+	}
+
+	c.expr(body, tail)
+	if !tail {
+		c.emit(opLeave, frames, 0)
+	}
+	c.scope = outer
+}
+
+func (c *compiler) namedLet(args *Expr, tail bool) {
+	name := args.Head
+	if args.Tail == nilExpr {
+		panic(errorf(ErrSyntax, "let", "named let expects bindings and a body"))
+	}
+	bindings := letBindings("let", args.Tail.Head)
+
+	var params []*Expr
+	for _, b := range bindings {
+		params = append(params, b.Head)
+		c.expr(b.Tail.Head, false)
+	}
+
+	loop := &scope{names: []string{name.Sym}, parent: c.scope}
+	c.code.named = append(c.code.named, &namedLet{
+		scope: loop,
+		proto: &proto{params: list(params...), body: implicitBegin(args.Tail.Tail), parent: loop},
+		name:  name.Sym,
+		n:     len(bindings),
+	})
+	isTail := 0
+	if tail {
+		isTail = 1
+	}
+	c.emit(opNamedLet, len(c.code.named)-1, isTail)
+}
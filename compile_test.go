@@ -0,0 +1,70 @@
+package minilisp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlotNames(t *testing.T) {
+	tests := []struct {
+		params string
+		body   string
+		names  string
+		simple bool
+	}{
+		{"(a b)", "(+ a b)", "a b", true},
+		{"(a &rest more)", "a", "a more", false},
+		{"((x y) _ {\"k\" v})", "x", "x y v", false},
+		{"(a a)", "a", "a", false},
+		{"(a)", "(begin (define b 1) (if a (define c 2)) (begin (define d 3)))", "a b d", true},
+	}
+
+	for _, tt := range tests {
+		p := &proto{params: readStr(tt.params), body: readStr(tt.body)}
+		p.compiled(NewEnv(nil))
+		if got := strings.Join(p.scope.names, " "); got != tt.names || p.simple != tt.simple {
+			t.Errorf("%s %s: names %q simple %v, want %q %v", tt.params, tt.body, got, p.simple, tt.names, tt.simple)
+		}
+	}
+}
+
+func TestCompileLocals(t *testing.T) {
+	env := NewEnv(nil)
+	fn := eval(readStr("(lambda (x) (let ((y 1)) (+ x y z)))"), env)
+	c := protoOf(fn).compiled(env)
+
+	// x is one frame out and y in the let's frame, z is global
+	var ops []string
+	for _, in := range c.instrs {
+		switch in.op {
+		case opLocal:
+			ops = append(ops, "local", string(rune('0'+in.a)))
+		case opGlobal:
+			ops = append(ops, "global")
+		}
+	}
+	if got := strings.Join(ops, " "); got != "global local 1 local 0 global" {
+		t.Errorf("lookups = %s", got)
+	}
+}
+
+func TestSyntaxErrorsRaisedWhenRun(t *testing.T) {
+	env := NewEnv(nil)
+	if got := eval(readStr("(if false (define 1 2) 3)"), env); got.Num != 3 {
+		t.Errorf("got %s, want 3", printExpr(got))
+	}
+
+	// A fresh error each time it runs
+	form := readStr("(define 1 2)")
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() {
+				err := recoverError(recover())
+				if errorMessage(err) != "define: name must be a symbol, got 1" || err.Pos != form.Pos {
+					t.Errorf("err = %q at %v", errorMessage(err), err.Pos)
+				}
+			}()
+			eval(form, env)
+		}()
+	}
+}
@@ -1,43 +1,125 @@
-package main
+package minilisp
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"reflect"
+	"sync/atomic"
+)
 
 type ExprType string
 
 const (
-	Nil     ExprType = "Nil"
-	Bool    ExprType = "Bool"
-	Number  ExprType = "Number"
-	String  ExprType = "String"
-	Symbol  ExprType = "Symbol"
-	Pair    ExprType = "Pair"
-	Hash    ExprType = "Hash"
-	Builtin ExprType = "Builtin"
-	Lambda  ExprType = "Lambda"
-	Macro   ExprType = "Macro"
+	Nil      ExprType = "Nil"
+	Bool     ExprType = "Bool"
+	Number   ExprType = "Number"
+	Float    ExprType = "Float"
+	BigInt   ExprType = "BigInt"
+	Rational ExprType = "Rational"
+	String   ExprType = "String"
+	Symbol   ExprType = "Symbol"
+	Keyword  ExprType = "Keyword"
+	Pair     ExprType = "Pair"
+	Vector   ExprType = "Vector"
+	Hash     ExprType = "Hash"
+	Builtin  ExprType = "Builtin"
+	Lambda   ExprType = "Lambda"
+	Macro    ExprType = "Macro"
+	Error    ExprType = "Error"
+	Object   ExprType = "Object"
 )
 
 type Expr struct {
 	Type      ExprType
 	Num       int
+	Float     float64
+	Big       *big.Int
+	Rat       *big.Rat
 	Sym       string
 	Str       string
 	Head      *Expr
 	Tail      *Expr
-	HashTable map[string]*Expr
-	Fn        func([]*Expr) *Expr
-	Params    *Expr
-	Body      *Expr
-	Env       *Env
+	Items     []*Expr // elements of a vector
+	HashTable *HashTable
+	Pos       *Position   // where a pair was read, or where an error happened
+	counted   atomic.Bool // already counted towards an evaluation's Limits
+	*errorInfo
+	*procedure
+	*object
+}
+
+// What an Error carries besides its message in Str
+type errorInfo struct {
+	Kind    string   // error kind, e.g. type-error
+	Origin  string   // builtin or form that raised the error
+	Payload *Expr    // extra error data, usually a hash
+	Trace   []string // lambda and macro frames an error unwound through
+}
+
+// A Go struct wrapped by an Object
+type object struct {
+	Obj reflect.Value // pointer to the struct
+}
+
+// What a builtin, lambda or macro runs. Kept out of Expr itself so pairs
+// and numbers don't carry it.
+type procedure struct {
+	Fn     func([]*Expr) *Expr
+	EnvFn  EnvBuiltinFunc // set instead of Fn by makeEnvBuiltin
+	Sig    *Signature     // checked before a registered builtin is called
+	Params *Expr
+	Body   *Expr
+	Env    *Env
+	Rules  *Expr                 // (pattern template) clauses of a syntax-rules macro
+	Name   string                // name a lambda or macro was defined under
+	Doc    string                // a lambda or macro's docstring
+	proto  atomic.Pointer[proto] // what the VM runs for a lambda
 }
 
+// nil, true and false are compared by identity. They're never modified, so
+// every interpreter can share them.
 var nilExpr = &Expr{Type: Nil}
 var trueExpr = &Expr{Type: Bool}
 var falseExpr = &Expr{Type: Bool}
 
+// true or false. Only false and nil are falsy, everything else is truthy.
+func makeBool(b bool) *Expr {
+	if b {
+		return trueExpr
+	}
+	return falseExpr
+}
+
+func isTruthy(e *Expr) bool {
+	return e != nilExpr && e != falseExpr
+}
+
 // Basic construtors for the various types
 func makeNum(n int) *Expr {
 	return &Expr{Type: Number, Num: n}
 }
 
+func makeFloat(f float64) *Expr {
+	return &Expr{Type: Float, Float: f}
+}
+
+// Big ints that fit in an int are stored as plain numbers
+func makeBigInt(b *big.Int) *Expr {
+	if b.IsInt64() && b.Int64() >= math.MinInt && b.Int64() <= math.MaxInt {
+		return makeNum(int(b.Int64()))
+	}
+	return &Expr{Type: BigInt, Big: b}
+}
+
+// Rationals with a denominator of 1 are stored as integers
+func makeRat(r *big.Rat) *Expr {
+	if r.IsInt() {
+		return makeBigInt(new(big.Int).Set(r.Num()))
+	}
+	return &Expr{Type: Rational, Rat: r}
+}
+
 func makeStr(s string) *Expr {
 	return &Expr{Type: String, Str: s}
 }
@@ -55,16 +137,34 @@ func makeSym(s string) *Expr {
 	return &Expr{Type: Symbol, Sym: s}
 }
 
+// :name, stored without the colon
+func makeKeyword(name string) *Expr {
+	return &Expr{Type: Keyword, Sym: name}
+}
+
 func pair(head, tail *Expr) *Expr {
 	return &Expr{Type: Pair, Head: head, Tail: tail}
 }
 
+func makeVector(items []*Expr) *Expr {
+	return &Expr{Type: Vector, Items: items}
+}
+
 func makeBuiltin(fn func([]*Expr) *Expr) *Expr {
-	return &Expr{Type: Builtin, Fn: fn}
+	return &Expr{Type: Builtin, procedure: &procedure{Fn: fn}}
+}
+
+// A builtin that needs more than its arguments: the environment it was
+// called from, and the context of the evaluation so it can stop early when
+// that's cancelled
+type EnvBuiltinFunc func(ctx context.Context, env *Env, args []*Expr) *Expr
+
+func makeEnvBuiltin(fn EnvBuiltinFunc) *Expr {
+	return &Expr{Type: Builtin, procedure: &procedure{EnvFn: fn}}
 }
 
 func makeLambda(params, body *Expr, env *Env, typ ExprType) *Expr {
-	return &Expr{Type: typ, Params: params, Body: body, Env: env}
+	return &Expr{Type: typ, procedure: &procedure{Params: params, Body: body, Env: env}}
 }
 
 // some helpers Ill need for lists
@@ -91,35 +191,34 @@ func listToSlice(e *Expr) []*Expr {
 func makeHash() *Expr {
 	return &Expr{
 		Type:      Hash,
-		HashTable: make(map[string]*Expr),
+		HashTable: newHashTable(),
 	}
 }
 
-// Set the hash key-values
+// Set a string key, for building hashes from Go
 func hashSet(hash *Expr, key string, value *Expr) {
 	if hash.Type != Hash {
-		panic("hashSet: not a hash")
+		panic(errorf(ErrType, "hashSet", "not a hash"))
 	}
-	hash.HashTable[key] = value
+	hash.HashTable.Set(makeStr(key), value)
 }
 
-// Get hash values by key
+// Get the value of a string key
 func hashGet(hash *Expr, key string) (*Expr, bool) {
 	if hash.Type != Hash {
-		panic("hashGet: not a hash")
+		panic(errorf(ErrType, "hashGet", "not a hash"))
 	}
-	val, ok := hash.HashTable[key]
-	return val, ok
+	return hash.HashTable.Get(makeStr(key))
 }
 
-// Get all keys from a hash
-func hashKeys(hash *Expr) []string {
+// Get all keys from a hash, in insertion order
+func hashKeys(hash *Expr) []*Expr {
 	if hash.Type != Hash {
-		panic("hashKeys: not a hash")
+		panic(errorf(ErrType, "hashKeys", "not a hash"))
 	}
-	keys := make([]string, 0, len(hash.HashTable))
-	for k := range hash.HashTable {
-		keys = append(keys, k)
+	keys := make([]*Expr, 0, hash.HashTable.Len())
+	for _, e := range hash.HashTable.Entries() {
+		keys = append(keys, e.Key)
 	}
 	return keys
 }
@@ -1,6 +1,9 @@
-package main
+package minilisp
 
-import "testing"
+import (
+	"testing"
+	"unsafe"
+)
 
 func TestMakeHash(t *testing.T) {
 	hash := makeHash()
@@ -71,3 +74,11 @@ func TestHashOverwrite(t *testing.T) {
 		t.Errorf("x = %v, want 20", val.Num)
 	}
 }
+
+// Pairs are most of what gets allocated, so fields only some types need
+// go behind a pointer (see procedure) rather than growing every Expr
+func TestExprSize(t *testing.T) {
+	if size := unsafe.Sizeof(Expr{}); size > 168 {
+		t.Errorf("Expr is %d bytes, want at most 168", size)
+	}
+}
@@ -0,0 +1,124 @@
+package minilisp
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Docstrings. A lambda or macro whose body starts with a string and has
+// more after it is documented by that string:
+//
+//	(define greet (lambda (name) "Say hello to name." (print name)))
+//
+// define takes one too, before the value, which also documents bindings
+// that aren't functions. Builtins get theirs from the registry.
+
+// Split a leading docstring off a lambda or macro body. A string on its
+// own is the body's value, not documentation.
+func splitDoc(body *Expr) (string, *Expr) {
+	if body.Type == Pair && body.Head.Type == String && body.Tail != nilExpr {
+		return body.Head.Str, body.Tail
+	}
+	return "", body
+}
+
+// The documentation a value carries itself
+func docOf(val *Expr) string {
+	switch val.Type {
+	case Lambda, Macro:
+		return val.Doc
+	case Builtin:
+		if val.Sig != nil {
+			return val.Sig.Doc
+		}
+	}
+	return ""
+}
+
+// The documentation for a name bound in env: the docstring given to define,
+// or else the one carried by the value
+func lookupDoc(env *Env, name string) (string, bool) {
+	val, ok := env.Lookup(name)
+	if !ok {
+		return "", false
+	}
+	if doc, ok := env.Doc(name); ok {
+		return doc, true
+	}
+	return docOf(val), true
+}
+
+// (doc f) returns f's docstring, or nil. (doc 'name) looks name up, so it
+// also finds docs given to define for values that aren't functions.
+func builtinDoc(ctx context.Context, env *Env, args []*Expr) *Expr {
+	doc := docOf(args[0])
+	if args[0].Type == Symbol {
+		var ok bool
+		if doc, ok = lookupDoc(env, args[0].Sym); !ok {
+			panic(errorf(ErrUnbound, "doc", "unbound symbol: %s", args[0].Sym))
+		}
+	}
+	if doc == "" {
+		return nilExpr
+	}
+	return makeStr(doc)
+}
+
+// How to call val when it's bound to name, e.g. (greet name) or
+// (hash-get hash key). Values that aren't functions show their type.
+func callSignature(name string, val *Expr) string {
+	switch val.Type {
+	case Builtin:
+		if val.Sig != nil {
+			return val.Sig.Usage()
+		}
+	case Lambda, Macro:
+		if val.Rules != nil {
+			return "(" + name + " ...)"
+		}
+		return printExpr(pair(makeSym(name), val.Params))
+	}
+	return "<" + strings.ToLower(string(val.Type)) + ">"
+}
+
+// Every name visible from env, sorted
+func visibleNames(env *Env) []string {
+	seen := map[string]bool{}
+	for e := env; e != nil; e = e.parent {
+		for name := range e.bindings {
+			seen[name] = true
+		}
+		if e.scope != nil {
+			for i, name := range e.scope.names {
+				if e.slots[i] != nil {
+					seen[name] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		// Gensyms bound for macros' module names (see moduleRef)
+		if strings.Contains(name, "#") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names visible from env whose name or documentation contains text,
+// ignoring case
+func apropos(env *Env, text string) []string {
+	text = strings.ToLower(text)
+	var matches []string
+	for _, name := range visibleNames(env) {
+		doc, _ := lookupDoc(env, name)
+		if strings.Contains(strings.ToLower(name), text) || strings.Contains(strings.ToLower(doc), text) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,114 @@
+package minilisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDocstrings(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(define greet (lambda (name) "Say hello to name." (string-append "hello " name)))`), env)
+	eval(readStr(`(define pi "Near enough." 3.14)`), env)
+	eval(readStr(`(define answer (lambda () "42"))`), env)
+	eval(readStr(`(defmacro unless (test &rest body) "Run body when test is false." (list 'if test nil (pair 'begin body)))`), env)
+	eval(readStr(`(define square "Multiply x by itself." (lambda (x) (* x x)))`), env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(doc greet)", `"Say hello to name."`},
+		{`(greet "ada")`, `"hello ada"`},
+		{"(doc 'pi)", `"Near enough."`},
+		{"(doc pi)", "nil"},
+		// A lone string is what the lambda returns, not its docstring
+		{"(doc answer)", "nil"},
+		{"(answer)", `"42"`},
+		{"(doc 'unless)", `"Run body when test is false."`},
+		{"(unless false 1 2)", "2"},
+		{"(doc 'square)", `"Multiply x by itself."`},
+		{"(doc square)", "nil"},
+		{"(doc head)", `"First element of a list."`},
+		{"(doc (lambda (x) \"Identity.\" x))", `"Identity."`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRedefiningDropsTheDocstring(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(define x "The old x." 1)`), env)
+	eval(readStr(`(define x 2)`), env)
+
+	if got := printExpr(eval(readStr("(doc 'x)"), env)); got != "nil" {
+		t.Errorf("(doc 'x) = %s, want nil", got)
+	}
+}
+
+func TestDocOfUnboundName(t *testing.T) {
+	env := setupFullEnv()
+
+	defer func() {
+		if err := recoverError(recover()); err.Kind != ErrUnbound {
+			t.Errorf("kind = %s, want unbound-error", err.Kind)
+		}
+	}()
+	eval(readStr("(doc 'nope)"), env)
+}
+
+func TestEveryBuiltinIsDocumented(t *testing.T) {
+	for _, def := range builtinDefs {
+		if def.Doc == "" {
+			t.Errorf("%s has no doc", def.Name)
+		}
+	}
+}
+
+func TestCallSignature(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(define greet (lambda (name &rest more) name))`), env)
+	eval(readStr(`(define nothing (lambda () nil))`), env)
+	eval(readStr(`(define identity (syntax-rules () ((_ x) x)))`), env)
+	eval(readStr(`(define n 1)`), env)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"greet", "(greet name &rest more)"},
+		{"nothing", "(nothing)"},
+		{"defmacro", "(defmacro name params &rest body)"},
+		{"identity", "(identity ...)"},
+		{"hash-get", "(hash-get hash key)"},
+		{"n", "<number>"},
+	}
+
+	for _, tt := range tests {
+		val, _ := env.Lookup(tt.name)
+		if got := callSignature(tt.name, val); got != tt.want {
+			t.Errorf("callSignature(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApropos(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(define shout (lambda (s) "Upper case S, loudly." (string-upcase s)))`), env)
+
+	got := apropos(env, "UPPER CASE")
+	want := []string{"shout", "string-upcase"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("apropos = %v, want %v", got, want)
+	}
+
+	got = apropos(env, "vector-")
+	want = []string{"vector->list", "vector-length", "vector-push", "vector-ref", "vector-set!", "vector-slice"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("apropos = %v, want %v", got, want)
+	}
+}
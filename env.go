@@ -1,31 +1,150 @@
-package main
+package minilisp
+
+import "context"
 
 type Env struct {
 	bindings map[string]*Expr
 	parent   *Env
+	scope    *scope            // names of the slots, for environments made by compiled code
+	slots    []*Expr           // values of the names in scope, nil until bound
+	run      *evaluation       // set where an evaluation starts: the global environment and lambda calls
+	docs     map[string]string // docstrings given to define
+	module   *Module           // set on the top level environment of an imported module
+	interp   *Interpreter      // only set on the global environment
 }
 
+// A new environment inside parent, or a global one with an interpreter of
+// its own if parent is nil
 func NewEnv(parent *Env) *Env {
-	return &Env{
+	env := &Env{
 		bindings: make(map[string]*Expr),
 		parent:   parent,
 	}
+	if parent == nil {
+		env.docs = make(map[string]string)
+		env.interp = newInterpreter(env)
+		env.run = &evaluation{ctx: context.Background(), backend: env.interp.backend}
+	}
+	return env
+}
+
+// The global environment e as seen by one evaluation: the same bindings
+// and docstrings, but with run as its evaluation, so evaluations going on
+// at once don't share a context, limits or counts
+func (e *Env) withEvaluation(run *evaluation) *Env {
+	view := *e
+	view.run = run
+	return &view
+}
+
+// A new environment inside parent with a slot for each name in s. The
+// bindings map is only made if something is defined that isn't in s.
+func newFrame(parent *Env, s *scope) *Env {
+	return &Env{parent: parent, scope: s, slots: make([]*Expr, len(s.names))}
 }
 
 func (e *Env) Define(sym string, val *Expr) {
-	e.bindings[sym] = val
+	if i := e.scope.index(sym); i >= 0 {
+		e.slots[i] = val
+	} else {
+		if e.bindings == nil {
+			e.bindings = make(map[string]*Expr)
+		}
+		e.bindings[sym] = val
+	}
+	delete(e.docs, sym)
 }
 
-func (e *Env) Lookup(sym string) (*Expr, bool) {
-	if val, ok := e.bindings[sym]; ok {
-		return val, true
+// The binding of sym in this frame only
+func (e *Env) local(sym string) (*Expr, bool) {
+	if i := e.scope.index(sym); i >= 0 && e.slots[i] != nil {
+		return e.slots[i], true
+	}
+	val, ok := e.bindings[sym]
+	return val, ok
+}
+
+// Document the binding of sym in this frame
+func (e *Env) SetDoc(sym, doc string) {
+	if e.docs == nil {
+		e.docs = make(map[string]string)
+	}
+	e.docs[sym] = doc
+}
+
+// The docstring define gave the nearest binding of sym, if any
+func (e *Env) Doc(sym string) (string, bool) {
+	for env := e; env != nil; env = env.parent {
+		if _, ok := env.local(sym); ok {
+			doc, ok := env.docs[sym]
+			return doc, ok
+		}
+	}
+	return "", false
+}
+
+// Update an existing binding in the nearest frame that has one. Returns
+// false if sym isn't bound anywhere.
+func (e *Env) Set(sym string, val *Expr) bool {
+	for env := e; env != nil; env = env.parent {
+		if i := env.scope.index(sym); i >= 0 && env.slots[i] != nil {
+			env.slots[i] = val
+			return true
+		}
+		if _, ok := env.bindings[sym]; ok {
+			env.bindings[sym] = val
+			return true
+		}
+	}
+	return false
+}
+
+// Would defining sym here hide a binding from an enclosing scope?
+func (e *Env) Shadows(sym string) bool {
+	if _, ok := e.local(sym); ok || e.parent == nil {
+		return false
 	}
+	_, ok := e.parent.Lookup(sym)
+	return ok
+}
 
-	// recursively check the parent
-	if e.parent != nil {
-		return e.parent.Lookup(sym)
+func (e *Env) Lookup(sym string) (*Expr, bool) {
+	for env := e; env != nil; env = env.parent {
+		if val, ok := env.local(sym); ok {
+			return val, true
+		}
 	}
 
 	// didnt find
 	return nil, false
 }
+
+// The interpreter the global environment above e belongs to
+func (e *Env) interpreter() *Interpreter {
+	for e.parent != nil {
+		e = e.parent
+	}
+	return e.interp
+}
+
+// Start a new evaluation in e and the environments under it, running in
+// ctx with the interpreter's limits. A Timeout is left to ctx.
+func (e *Env) SetContext(ctx context.Context) {
+	in := e.interpreter()
+	e.run = &evaluation{ctx: ctx, limits: in.limits, backend: in.backend}
+}
+
+// The context of the evaluation e is part of, Background unless one was
+// set. Builtins made with makeEnvBuiltin get this.
+func (e *Env) Context() context.Context {
+	return e.evaluation().ctx
+}
+
+// The evaluation set on the nearest enclosing environment. The global
+// environment always has one.
+func (e *Env) evaluation() *evaluation {
+	for e.run == nil {
+		e = e.parent
+	}
+	return e.run
+}
@@ -1,6 +1,9 @@
-package main
+package minilisp
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestNewEnv(t *testing.T) {
 	env := NewEnv(nil)
@@ -100,3 +103,60 @@ func TestEnvRedefineSameScope(t *testing.T) {
 		t.Errorf("x = %v, want 20", val)
 	}
 }
+
+func TestEnvSet(t *testing.T) {
+	parent := NewEnv(nil)
+	parent.Define("x", makeNum(1))
+	child := NewEnv(parent)
+
+	if !child.Set("x", makeNum(2)) {
+		t.Fatal("Set should find x in the parent")
+	}
+	if _, ok := child.bindings["x"]; ok {
+		t.Error("Set should update the parent's binding, not add one to the child")
+	}
+	if val, _ := parent.Lookup("x"); val.Num != 2 {
+		t.Errorf("parent x = %v, want 2", val.Num)
+	}
+
+	if child.Set("missing", makeNum(1)) {
+		t.Error("Set should return false for an unbound symbol")
+	}
+}
+
+func TestEnvShadows(t *testing.T) {
+	parent := NewEnv(nil)
+	parent.Define("x", makeNum(1))
+	child := NewEnv(parent)
+
+	if !child.Shadows("x") {
+		t.Error("defining x in the child would shadow the parent's x")
+	}
+	if child.Shadows("y") {
+		t.Error("y isn't bound anywhere, so nothing is shadowed")
+	}
+	if parent.Shadows("x") {
+		t.Error("redefining in the global env doesn't shadow")
+	}
+
+	child.Define("x", makeNum(2))
+	if child.Shadows("x") {
+		t.Error("redefining in the same frame doesn't shadow")
+	}
+}
+
+func TestEnvContext(t *testing.T) {
+	global := NewEnv(nil)
+	inner := NewEnv(NewEnv(global))
+
+	if inner.Context() != context.Background() {
+		t.Error("Context without one set should be Background")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	global.SetContext(ctx)
+	if inner.Context() != ctx {
+		t.Error("inner environment should see the global environment's context")
+	}
+}
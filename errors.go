@@ -0,0 +1,282 @@
+package minilisp
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Error kinds raised by the interpreter and builtins. Lisp code matches
+// on these in (catch (e kind...) ...) clauses.
+const (
+	ErrGeneric    = "error"
+	ErrType       = "type-error"
+	ErrArity      = "arity-error"
+	ErrValue      = "value-error"
+	ErrArith      = "arithmetic-error"
+	ErrUnbound    = "unbound-error"
+	ErrSyntax     = "syntax-error"
+	ErrIO         = "io-error"
+	ErrHTTP       = "http-error"
+	ErrJSON       = "json-error"
+	ErrImport     = "import-error"
+	ErrRuntime    = "runtime-error"
+	ErrLimit      = "limit-error"      // a Limit was reached, see limits.go
+	ErrCancelled  = "cancel-error"     // the evaluation's context was cancelled
+	ErrCapability = "capability-error" // the sandbox doesn't allow it
+)
+
+// Creates an error value. origin is the builtin or form that raised it
+// and payload is an optional hash of extra data (nil for none).
+func makeError(kind, origin, message string, payload *Expr) *Expr {
+	if payload == nil {
+		payload = nilExpr
+	}
+	return &Expr{Type: Error, Str: message, errorInfo: &errorInfo{Kind: kind, Origin: origin, Payload: payload}}
+}
+
+// Creates an error with a formatted message. Raise it with panic, which
+// unwinds to the nearest try form or to the top level loop.
+func errorf(kind, origin, format string, args ...interface{}) *Expr {
+	return makeError(kind, origin, fmt.Sprintf(format, args...), nil)
+}
+
+// Convert whatever was recovered from a panic into an error value, so Go
+// runtime failures can be caught from Lisp just like thrown errors.
+func recoverError(r interface{}) *Expr {
+	switch v := r.(type) {
+	case *Expr:
+		if v.Type == Error {
+			return v
+		}
+		return makeError(ErrGeneric, "", printExpr(v), v)
+	case runtime.Error:
+		return makeError(ErrRuntime, "", v.Error(), nil)
+	case error:
+		return makeError(ErrGeneric, "", v.Error(), nil)
+	case string:
+		return makeError(ErrGeneric, "", v, nil)
+	default:
+		return makeError(ErrGeneric, "", fmt.Sprint(v), nil)
+	}
+}
+
+// Human readable message, prefixed with the origin when there is one
+func errorMessage(e *Expr) string {
+	if e.Origin != "" {
+		return e.Origin + ": " + e.Str
+	}
+	return e.Str
+}
+
+// Format a recovered panic value for the REPL and piped input loops,
+// followed by the trace on its own line when there is one
+func formatError(r interface{}) string {
+	err := recoverError(r)
+	msg := "Error: " + errorMessage(err)
+	if trace := formatTrace(err); trace != "" {
+		msg += "\n  " + trace
+	}
+	return msg
+}
+
+// Where the error happened and the frames it unwound through, innermost
+// first, e.g. handler.lisp:42:7 in counter-handler <- router <- http-server
+func formatTrace(err *Expr) string {
+	loc := ""
+	if err.Pos != nil {
+		loc = err.Pos.String()
+	}
+	if len(err.Trace) == 0 {
+		return loc
+	}
+
+	frames := strings.Join(err.Trace, " <- ")
+	if loc == "" {
+		return "in " + frames
+	}
+	return loc + " in " + frames
+}
+
+// Record where an error happened and which lambdas or macros it unwound
+// through, given in call order. Called from a deferred recover, the result
+// is then re-raised.
+func annotateError(r interface{}, form *Expr, callees ...*Expr) *Expr {
+	err := recoverError(r)
+	if err.Pos == nil && form != nil && form.Pos != nil {
+		err.Pos = form.Pos
+	}
+	for i := len(callees) - 1; i >= 0; i-- {
+		err.Trace = append(err.Trace, frameName(callees[i]))
+	}
+	return err
+}
+
+// Name shown for a lambda or macro in a trace
+func frameName(fn *Expr) string {
+	if fn.Name != "" {
+		return fn.Name
+	}
+	return strings.ToLower(string(fn.Type))
+}
+
+// Does the error match any of the kinds listed in a catch clause?
+// An empty list catches everything that can be caught.
+func errorMatches(err *Expr, kinds []*Expr) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if k.Type == Symbol && (k.Sym == err.Kind || k.Sym == ErrGeneric) {
+			return true
+		}
+	}
+	return false
+}
+
+// (try body... (catch (e kind...) handler...) (finally cleanup...))
+func evalTry(args *Expr, env *Env) *Expr {
+	var body, catches []*Expr
+	var finally *Expr
+
+	for _, form := range listToSlice(args) {
+		if form.Type == Pair && form.Head.Type == Symbol {
+			switch form.Head.Sym {
+			case "catch":
+				if form.Tail == nilExpr || form.Tail.Head.Type != Pair {
+					panic(errorf(ErrSyntax, "try", "catch expects a binding list, e.g. (catch (e) ...)"))
+				}
+				catches = append(catches, form)
+				continue
+			case "finally":
+				finally = form
+				continue
+			}
+		}
+		if len(catches) > 0 || finally != nil {
+			panic(errorf(ErrSyntax, "try", "body expressions must come before catch and finally"))
+		}
+		body = append(body, form)
+	}
+
+	if finally != nil {
+		defer evalBody(finally.Tail, env)
+	}
+
+	result, caught := evalProtected(body, env)
+	if caught == nil {
+		return result
+	}
+	// Catching these would let code carry on past its limits or after
+	// it's been cancelled, so they only run finally on the way out
+	if caught.Kind == ErrLimit || caught.Kind == ErrCancelled {
+		panic(caught)
+	}
+
+	for _, clause := range catches {
+		binding := listToSlice(clause.Tail.Head)
+		if !errorMatches(caught, binding[1:]) {
+			continue
+		}
+		handlerEnv := NewEnv(env)
+		handlerEnv.Define(binding[0].Sym, caught)
+		return evalBody(clause.Tail.Tail, handlerEnv)
+	}
+
+	// Nothing matched, keep unwinding
+	panic(caught)
+}
+
+// Evaluate body expressions, returning the error instead of unwinding
+func evalProtected(body []*Expr, env *Env) (result *Expr, caught *Expr) {
+	defer func() {
+		if r := recover(); r != nil {
+			caught = recoverError(r)
+		}
+	}()
+
+	result = nilExpr
+	for _, expr := range body {
+		result = eval(expr, env)
+	}
+	return result, nil
+}
+
+// Evaluate a list of expressions in order, returning the last result
+func evalBody(body *Expr, env *Env) *Expr {
+	var result *Expr = nilExpr
+	for body != nilExpr {
+		result = eval(body.Head, env)
+		body = body.Tail
+	}
+	return result
+}
+
+// (throw "message"), (throw 'kind "message" [payload]) or (throw err)
+func evalThrow(args *Expr, env *Env) *Expr {
+	vals := evalList(args, env)
+	if len(vals) == 0 {
+		panic(errorf(ErrArity, "throw", "expects at least 1 argument"))
+	}
+
+	// A copy, so rethrowing a caught error starts a fresh trace rather
+	// than adding to the one it already has
+	first := vals[0]
+	if first.Type == Error && len(vals) == 1 {
+		panic(makeError(first.Kind, first.Origin, first.Str, first.Payload))
+	}
+	if first.Type == String && len(vals) == 1 {
+		panic(makeError(ErrGeneric, "", first.Str, nil))
+	}
+
+	panic(errorFromArgs("throw", vals))
+}
+
+// Build an error from (kind message [payload]) arguments
+func errorFromArgs(name string, args []*Expr) *Expr {
+	if len(args) < 2 || len(args) > 3 {
+		panic(errorf(ErrArity, name, "expects (kind message [payload])"))
+	}
+	if args[0].Type != Symbol {
+		panic(errorf(ErrType, name, "kind must be a symbol"))
+	}
+	if args[1].Type != String {
+		panic(errorf(ErrType, name, "message must be a string"))
+	}
+
+	payload := nilExpr
+	if len(args) == 3 {
+		payload = args[2]
+	}
+	return makeError(args[0].Sym, "", args[1].Str, payload)
+}
+
+// Error builtins
+
+func builtinError(args []*Expr) *Expr {
+	return errorFromArgs("error", args)
+}
+
+func builtinErrorP(args []*Expr) *Expr {
+	return makeBool(args[0].Type == Error)
+}
+
+func builtinErrorKind(args []*Expr) *Expr {
+	return makeSym(args[0].Kind)
+}
+
+func builtinErrorMessage(args []*Expr) *Expr {
+	return makeStr(args[0].Str)
+}
+
+func builtinErrorPayload(args []*Expr) *Expr {
+	return args[0].Payload
+}
+
+func builtinErrorOrigin(args []*Expr) *Expr {
+	err := args[0]
+	if err.Origin == "" {
+		return nilExpr
+	}
+	return makeStr(err.Origin)
+}
@@ -0,0 +1,330 @@
+package minilisp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Run on both backends, see runOnBackends
+func TestErrors(t *testing.T) {
+	runOnBackends(t, []backendTest{
+		{"TryWithoutError", testTryWithoutError},
+		{"TryCatchesBuiltinErrors", testTryCatchesBuiltinErrors},
+		{"CatchMatchesKind", testCatchMatchesKind},
+		{"UnmatchedCatchRethrows", testUnmatchedCatchRethrows},
+		{"Throw", testThrow},
+		{"NestedTryRethrow", testNestedTryRethrow},
+		{"FinallyAlwaysRuns", testFinallyAlwaysRuns},
+		{"CatchGoRuntimeError", testCatchGoRuntimeError},
+		{"ErrorValues", testErrorValues},
+		{"FetchHttpErrorPayload", testFetchHttpErrorPayload},
+		{"FormatError", testFormatError},
+		{"ErrorTrace", testErrorTrace},
+		{"RethrowStartsFreshTrace", testRethrowStartsFreshTrace},
+		{"ErrorTraceFromMacroExpansion", testErrorTraceFromMacroExpansion},
+		{"ErrorTraceInMacroBody", testErrorTraceInMacroBody},
+		{"FormatErrorWithTrace", testFormatErrorWithTrace},
+	})
+}
+
+func testTryWithoutError(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	result := eval(readStr(`(try (+ 1 2) (catch (e) 0))`), env)
+	if result.Num != 3 {
+		t.Errorf("try without error = %v, want 3", printExpr(result))
+	}
+}
+
+func testTryCatchesBuiltinErrors(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`(try (@json "{bad") (catch (e) (error-kind e)))`, "json-error"},
+		{`(try (hash-get (hash) '(1)) (catch (e) (error-kind e)))`, "type-error"},
+		{`(try (hash-get (hash)) (catch (e) (error-kind e)))`, "arity-error"},
+		{`(try undefined-thing (catch (e) (error-kind e)))`, "unbound-error"},
+		{`(try (load "nonexistent.lisp") (catch (e) (error-kind e)))`, "io-error"},
+		{`(try (hash-get (hash) '(1)) (catch (e) (error-origin e)))`, `"hash-get"`},
+		{`(try (hash-get (hash) '(1)) (catch (e) (error-message e)))`, `"argument 2 must be a hash key, got pair (1)"`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testCatchMatchesKind(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	code := `(try (@json "{bad")
+		(catch (e type-error) "type")
+		(catch (e json-error io-error) "json")
+		(catch (e) "other"))`
+	result := eval(readStr(code), env)
+	if result.Str != "json" {
+		t.Errorf("catch by kind = %q, want \"json\"", result.Str)
+	}
+}
+
+func testUnmatchedCatchRethrows(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("unmatched error should keep unwinding")
+		}
+		if err := recoverError(r); err.Kind != ErrJSON {
+			t.Errorf("rethrown kind = %s, want json-error", err.Kind)
+		}
+	}()
+
+	eval(readStr(`(try (@json "{bad") (catch (e type-error) "type"))`), env)
+}
+
+func testThrow(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`(try (throw "boom") (catch (e) (error-message e)))`, `"boom"`},
+		{`(try (throw "boom") (catch (e) (error-kind e)))`, "error"},
+		{`(try (throw 'not-found "missing") (catch (e not-found) (error-message e)))`, `"missing"`},
+		{`(try (throw 'bad "x" (hash "code" 7)) (catch (e) (hash-get (error-payload e) "code")))`, "7"},
+		{`(try (throw (error 'custom "made")) (catch (e custom) (error-message e)))`, `"made"`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testNestedTryRethrow(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	code := `(try
+		(try (throw 'inner "first")
+			(catch (e) (throw 'outer (string-append "wrapped " (error-message e)))))
+		(catch (e outer) (error-message e)))`
+	result := eval(readStr(code), env)
+	if result.Str != "wrapped first" {
+		t.Errorf("nested rethrow = %q, want \"wrapped first\"", result.Str)
+	}
+}
+
+func testFinallyAlwaysRuns(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	// finally runs on success and the try value is kept
+	result := eval(readStr(`(try (define cleaned 0) 42 (finally (define cleaned 1)))`), env)
+	if result.Num != 42 {
+		t.Errorf("try value = %v, want 42", printExpr(result))
+	}
+	if val, _ := env.Lookup("cleaned"); val.Num != 1 {
+		t.Error("finally should run when body succeeds")
+	}
+
+	// finally runs when the error is caught
+	eval(readStr(`(try (throw "x") (catch (e) nil) (finally (define cleaned 2)))`), env)
+	if val, _ := env.Lookup("cleaned"); val.Num != 2 {
+		t.Error("finally should run when error is caught")
+	}
+
+	// finally runs when the error escapes
+	func() {
+		defer func() { recover() }()
+		eval(readStr(`(try (throw "x") (finally (define cleaned 3)))`), env)
+	}()
+	if val, _ := env.Lookup("cleaned"); val.Num != 3 {
+		t.Error("finally should run when error escapes")
+	}
+}
+
+func testCatchGoRuntimeError(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+	// Without its signature check, head of a number is a Go nil dereference
+	env.Define("head", makeBuiltin(builtinHead))
+
+	result := eval(readStr(`(try (+ (head 5) 1) (catch (e) (error-kind e)))`), env)
+	if printExpr(result) != "runtime-error" {
+		t.Errorf("runtime error kind = %s, want runtime-error", printExpr(result))
+	}
+}
+
+func testErrorValues(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	result := eval(readStr(`(error 'io-error "disk full")`), env)
+	if result.Type != Error {
+		t.Fatalf("error type = %v, want Error", result.Type)
+	}
+	if got := printExpr(result); got != "#<io-error: disk full>" {
+		t.Errorf("printExpr(error) = %q", got)
+	}
+
+	if builtinErrorP([]*Expr{result}) != trueExpr {
+		t.Error("error? should be true for an error")
+	}
+	if builtinErrorP([]*Expr{makeStr("x")}) != falseExpr {
+		t.Error("error? should be false for a string")
+	}
+}
+
+func testFetchHttpErrorPayload(t *testing.T, backend Backend) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer server.Close()
+
+	env := setupFullEnv(WithBackend(backend))
+	env.Define("url", makeStr(server.URL))
+
+	code := `(try (fetch url) (catch (e http-error) (hash-get (error-payload e) "status")))`
+	result := eval(readStr(code), env)
+	if result.Num != 404 {
+		t.Errorf("http-error status = %v, want 404", printExpr(result))
+	}
+}
+
+func testFormatError(t *testing.T, backend Backend) {
+	tests := []struct {
+		input interface{}
+		want  string
+	}{
+		{errorf(ErrArity, "hash-get", "expects 2 arguments"), "Error: hash-get: expects 2 arguments"},
+		{errorf(ErrUnbound, "", "unbound symbol: x"), "Error: unbound symbol: x"},
+		{"plain string", "Error: plain string"},
+	}
+
+	for _, tt := range tests {
+		if got := formatError(tt.input); got != tt.want {
+			t.Errorf("formatError(%v) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testErrorTrace(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	program := `(define counter-handler
+  (lambda (request)
+    (+ 1
+       (hash-get request))))
+
+(define router
+  (lambda (request)
+    (counter-handler request)))
+
+(router (hash))`
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("router should fail")
+		}
+		want := "handler.lisp:4:8 in counter-handler <- router"
+		if got := formatTrace(recoverError(r)); got != want {
+			t.Errorf("trace = %q, want %q", got, want)
+		}
+	}()
+
+	for _, expr := range readSource(program, "handler.lisp") {
+		eval(expr, env)
+	}
+}
+
+func testRethrowStartsFreshTrace(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	program := `(define f (lambda (e) (throw e)))
+(define saved (try (hash-get) (catch (e) e)))
+(define traces
+  (map (lambda (i) (try (f saved) (catch (e) e))) (list 1 2 3)))`
+
+	for _, expr := range readSource(program, "rethrow.lisp") {
+		eval(expr, env)
+	}
+	traces, _ := env.Lookup("traces")
+	for _, err := range listToSlice(traces) {
+		if got := formatTrace(err); got != "rethrow.lisp:1:23 in f" {
+			t.Errorf("trace = %q", got)
+		}
+	}
+	if saved, _ := env.Lookup("saved"); len(saved.Trace) != 0 {
+		t.Errorf("saved error trace changed to %v", saved.Trace)
+	}
+}
+
+func testErrorTraceFromMacroExpansion(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	// The pairs built by the macro have no source position of their own,
+	// so errors inside the expansion point at the macro call
+	program := `(define get-one (macro (h) (pair 'hash-get (pair h nil))))
+(define f
+  (lambda ()
+    (get-one (hash))))
+(f)`
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("f should fail")
+		}
+		err := recoverError(r)
+		want := "macro.lisp:4:5 in f"
+		if got := formatTrace(err); got != want {
+			t.Errorf("trace = %q, want %q", got, want)
+		}
+	}()
+
+	for _, expr := range readSource(program, "macro.lisp") {
+		eval(expr, env)
+	}
+}
+
+func testErrorTraceInMacroBody(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	program := `(define broken (macro (x) (undefined-helper x)))
+(broken 1)`
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("broken macro should fail")
+		}
+		want := "macro.lisp:1:27 in broken"
+		if got := formatTrace(recoverError(r)); got != want {
+			t.Errorf("trace = %q, want %q", got, want)
+		}
+	}()
+
+	for _, expr := range readSource(program, "macro.lisp") {
+		eval(expr, env)
+	}
+}
+
+func testFormatErrorWithTrace(t *testing.T, backend Backend) {
+	err := errorf(ErrArity, "", "not enough arguments")
+	err.Pos = &Position{File: "app.lisp", Line: 3, Col: 7}
+	err.Trace = []string{"inner", "outer"}
+
+	want := "Error: not enough arguments\n  app.lisp:3:7 in inner <- outer"
+	if got := formatError(err); got != want {
+		t.Errorf("formatError = %q, want %q", got, want)
+	}
+}
@@ -1,9 +1,6 @@
-package main
+package minilisp
 
-import (
-	"fmt"
-	"os"
-)
+import "strings"
 
 // Evaluate a list of expressions
 func evalList(list *Expr, env *Env) []*Expr {
@@ -15,28 +12,25 @@ func evalList(list *Expr, env *Env) []*Expr {
 	return result
 }
 
-func macroexpand(e *Expr, env *Env) *Expr {
-	if e == nilExpr || e.Type != Pair {
-		return e
-	}
-
-	op := e.Head
-	if op.Type != Symbol {
-		return e
-	}
+// Bind a lambda or macro's parameters to args in a new environment
+// created under the one it closed over. The call carries on the evaluation
+// of env, the environment it was called from.
+func bindParams(env *Env, fn *Expr, args []*Expr) *Env {
+	newEnv := NewEnv(fn.Env)
+	newEnv.run = env.evaluation()
+	bindArgs(newEnv, fn, args)
+	return newEnv
+}
 
-	// Look up the operator
-	val, ok := env.Lookup(op.Sym)
-	if !ok || val.Type != Macro {
-		return e
+// Bind fn's parameters to args in newEnv
+func bindArgs(newEnv *Env, fn *Expr, args []*Expr) {
+	// Lambda errors have historically had no prefix, macro ones do
+	origin := ""
+	if fn.Type == Macro {
+		origin = "macro"
 	}
 
-	// Apply macro to unevaluated arguments
-	args := listToSlice(e.Tail)
-	newEnv := NewEnv(val.Env)
-
-	// Bind parameters to unevaluated arguments
-	params := val.Params
+	params := fn.Params
 	i := 0
 	for params != nilExpr {
 		// Check for &rest parameter
@@ -44,52 +38,290 @@ func macroexpand(e *Expr, env *Env) *Expr {
 			// Next param gets all remaining args as a list
 			params = params.Tail
 			if params == nilExpr {
-				panic("macro: &rest requires a parameter name")
+				panic(errorf(ErrSyntax, strings.ToLower(string(fn.Type)), "&rest requires a parameter name"))
 			}
 			// Build a list from remaining args
 			restList := nilExpr
 			for j := len(args) - 1; j >= i; j-- {
 				restList = pair(args[j], restList)
 			}
-			newEnv.Define(params.Head.Sym, restList)
-			break
+			newEnv.run.allocated(restList)
+			bindPattern(newEnv, params.Head, restList, origin)
+			return
 		}
 
 		if i >= len(args) {
-			panic("macro: not enough arguments")
+			panic(errorf(ErrArity, origin, "not enough arguments"))
 		}
-		newEnv.Define(params.Head.Sym, args[i])
+		bindPattern(newEnv, params.Head, args[i], origin)
 		params = params.Tail
 		i++
 	}
 
-	if i < len(args) && params == nilExpr {
-		panic("macro: too many arguments")
+	if i < len(args) {
+		panic(errorf(ErrArity, origin, "too many arguments"))
 	}
+}
 
-	// Evaluate macro body to get new code
-	expanded := eval(val.Body, newEnv)
+// Apply fn to arguments that are already evaluated. Builtins and keywords
+// return their result. Lambdas aren't run here: their body is returned with
+// a new environment binding the arguments, so eval can run it as a tail
+// call. env is the environment of the call, for builtins that want it.
+func applyTail(env *Env, fn *Expr, args []*Expr) (result, body *Expr, bodyEnv *Env) {
+	switch fn.Type {
+	case Builtin:
+		return callBuiltin(env, fn, args), nil, nil
+	case Keyword:
+		return keywordGet(fn, args), nil, nil
+	case Lambda:
+		return nil, fn.Body, bindParams(env, fn, args)
+	default:
+		panic(errorf(ErrType, "", "not a function: %s", printExpr(fn)))
+	}
+}
 
-	// Recursively expand the result
-	return macroexpand(expanded, env)
+// Call builtin fn, counting what it made towards the evaluation's limits
+func callBuiltin(env *Env, fn *Expr, args []*Expr) *Expr {
+	if fn.Sig != nil {
+		fn.Sig.check(args)
+	}
+	var result *Expr
+	if fn.EnvFn != nil {
+		result = fn.EnvFn(env.Context(), env, args)
+	} else {
+		result = fn.Fn(args)
+	}
+	env.evaluation().allocated(result)
+	return result
 }
 
-func eval(e *Expr, env *Env) *Expr {
+// Call fn with arguments that are already evaluated. This is how apply,
+// http-server and builtins that take a function (map, filter, sort...)
+// call it.
+func applyProc(env *Env, fn *Expr, args []*Expr) *Expr {
+	if fn.Type == Lambda && env.evaluation().backend == BytecodeVM {
+		return callCompiled(env, fn, args)
+	}
+	if fn.Type == Lambda {
+		defer func() {
+			if r := recover(); r != nil {
+				panic(annotateError(r, nil, fn))
+			}
+		}()
+	}
+
+	result, body, bodyEnv := applyTail(env, fn, args)
+	if body != nil {
+		return eval(body, bodyEnv)
+	}
+	return result
+}
+
+// Expand e once if it is a macro call, reporting whether it was
+func macroexpand1(e *Expr, env *Env) (*Expr, bool) {
+	if e == nilExpr || e.Type != Pair {
+		return e, false
+	}
+
+	op := e.Head
+	if op.Type != Symbol {
+		return e, false
+	}
+
+	// Look up the operator
+	val, ok := env.Lookup(op.Sym)
+	if !ok || val.Type != Macro {
+		return e, false
+	}
+
+	expanded := expandMacro(env, val, e)
+	inheritPos(expanded, e.Pos)
+	return expanded, true
+}
+
+// Expand e until it is no longer a macro call
+func macroexpand(e *Expr, env *Env) *Expr {
+	for {
+		expanded, ok := macroexpand1(e, env)
+		if !ok {
+			return e
+		}
+		e = expanded
+	}
+}
+
+// Expand a call to macro m in env, recording the macro as a frame if it
+// fails
+func expandMacro(env *Env, m *Expr, form *Expr) *Expr {
+	defer func() {
+		if r := recover(); r != nil {
+			panic(annotateError(r, nil, m))
+		}
+	}()
+
+	if m.Rules != nil {
+		return expandSyntaxRules(env, m, form)
+	}
+
+	// Bind parameters to unevaluated arguments and evaluate the macro
+	// body to get new code
+	return eval(m.Body, bindParams(env, m, listToSlice(form.Tail)))
+}
+
+// Give pairs built by a macro the position of the macro call, so errors
+// in expanded code point at the call site
+func inheritPos(e *Expr, pos *Position) {
+	if pos == nil {
+		return
+	}
+	for e.Type == Pair && e.Pos == nil {
+		e.Pos = pos
+		inheritPos(e.Head, pos)
+		e = e.Tail
+	}
+}
+
+// Most tail-called lambdas remembered per eval frame for error traces
+const maxTailFrames = 16
+
+// Remember fn for the trace, collapsing a lambda calling itself in a loop
+// and dropping the oldest frames once there are too many
+func recordTailCall(callees []*Expr, fn *Expr) []*Expr {
+	if n := len(callees); n > 0 && callees[n-1] == fn {
+		return callees
+	}
+	if len(callees) == maxTailFrames {
+		callees = append(callees[:0], callees[1:]...)
+	}
+	return append(callees, fn)
+}
+
+// Atoms: symbols are looked up, vector literals evaluate their elements
+// into a new vector and everything else evaluates to itself
+func evalAtom(e *Expr, env *Env) *Expr {
 	switch e.Type {
-	// these types are self-evaluating
-	case Nil, Bool, Number:
-		return e
 	case Symbol:
 		val, ok := env.Lookup(e.Sym)
 		if !ok {
-			panic(fmt.Sprintf("unbound symbol: %s", e.Sym))
+			panic(errorf(ErrUnbound, "", "unbound symbol: %s", e.Sym))
 		}
 		return val
-	// Head | tail support
-	case Pair:
+	case Vector:
+		items := make([]*Expr, len(e.Items))
+		for i, item := range e.Items {
+			items[i] = eval(item, env)
+		}
+		return makeVector(items)
+	}
+	return e
+}
+
+// Special forms whose work the tree walker and the VM share
+func evalForm(form *Expr, env *Env) *Expr {
+	args := form.Tail
+	switch form.Head.Sym {
+	case "quasiquote":
+		result := quasiquote(args.Head, env, 1)
+		env.evaluation().allocated(result)
+		return result
+	case "macro":
+		params := args.Head
+		doc, body := splitDoc(args.Tail)
+		m := makeLambda(params, implicitBegin(body), env, Macro)
+		m.Doc = doc
+		return m
+	case "syntax-rules":
+		return makeSyntaxRules(args, env)
+	case "macroexpand-1":
+		expanded, _ := macroexpand1(eval(args.Head, env), env)
+		return expanded
+	case "macroexpand":
+		return macroexpand(eval(args.Head, env), env)
+	case "load":
+		return evalLoad(args, form, env)
+	case "import":
+		return evalImport(args, form, env)
+	case "module":
+		return evalModule(args, env)
+	case "try":
+		return evalTry(args, env)
+	default:
+		return evalThrow(args, env)
+	}
+}
+
+// (load "filepath.lisp") evaluates every form in the file in env
+func evalLoad(args *Expr, form *Expr, env *Env) *Expr {
+	if args == nilExpr {
+		panic(errorf(ErrArity, "load", "missing filepath argument"))
+	}
+
+	// Evaluate the filepath argument (could be a variable)
+	filepath := eval(args.Head, env)
+
+	if filepath.Type != String {
+		panic(errorf(ErrType, "load", "argument must be a string"))
+	}
+
+	// Relative paths are found like imports, starting next to the file
+	// the load is in
+	in := env.interpreter()
+	path, ok := in.resolvePath(filepath.Str, form.Pos)
+	if !ok {
+		path = filepath.Str
+	}
+	in.checkRead("load", path)
+	content, err := readSourceFile(path)
+	if err != nil {
+		panic(errorf(ErrIO, "load", "cannot read file %s: %v", filepath.Str, err))
+	}
+
+	exprs := readSource(string(content), path)
+
+	var result *Expr = nilExpr
+	for _, expr := range exprs {
+		result = eval(expr, env)
+	}
+
+	return result
+}
+
+// eval runs as a loop rather than recursing for expressions in tail
+// position (the branches of if, the last expression of begin and a
+// lambda's body), so tail calls run in constant Go stack. Unless the
+// interpreter uses the tree walker, pairs are compiled and run on the VM
+// instead (see compile.go).
+func eval(e *Expr, env *Env) *Expr {
+	if e.Type != Pair {
+		return evalAtom(e, env)
+	}
+
+	// Errors unwinding through here pick up the position of the form being
+	// evaluated and the lambdas applied by it. Tail calls don't grow the Go
+	// stack, so they are remembered here instead (see recordTailCall).
+	run := env.evaluation()
+	if run.backend == BytecodeVM {
+		return runCode(compileForm(e, env), env)
+	}
+
+	var callees []*Expr
+	defer func() {
+		run.leave()
+		if r := recover(); r != nil {
+			panic(annotateError(r, e, callees...))
+		}
+	}()
+	run.enter()
+
+	for {
+		run.step()
+		if e.Type != Pair {
+			return evalAtom(e, env)
+		}
+
 		e = macroexpand(e, env)
 		if e.Type != Pair {
-			return eval(e, env)
+			continue
 		}
 
 		op := e.Head
@@ -100,118 +332,105 @@ func eval(e *Expr, env *Env) *Expr {
 			case "quote":
 				// (quote x) → x (unevaluated)
 				return args.Head
+			case "quasiquote", "macro", "syntax-rules", "macroexpand-1", "macroexpand",
+				"load", "import", "module", "try", "throw":
+				return evalForm(e, env)
+			case "unquote", "unquote-splicing":
+				panic(errorf(ErrSyntax, op.Sym, "not inside a quasiquote"))
 			case "if":
 				cond := eval(args.Head, env)
-				if cond != nilExpr {
-					return eval(args.Tail.Head, env)
+				if isTruthy(cond) {
+					e = args.Tail.Head
+				} else if args.Tail.Tail != nilExpr {
+					e = args.Tail.Tail.Head
+				} else {
+					return nilExpr
 				}
-				return eval(args.Tail.Tail.Head, env)
+				continue
+			case "not":
+				return makeBool(!isTruthy(eval(args.Head, env)))
+			case "and", "or":
+				// Stop at the first false value for and or true value for
+				// or. The last expression is a tail call.
+				if args == nilExpr {
+					return makeBool(op.Sym == "and")
+				}
+				for args.Tail != nilExpr {
+					val := eval(args.Head, env)
+					if isTruthy(val) == (op.Sym == "or") {
+						return val
+					}
+					args = args.Tail
+				}
+				e = args.Head
+				continue
 			case "define":
+				// (define name value) or (define name "docstring" value)
 				sym := args.Head
-				val := eval(args.Tail.Head, env)
+				if sym.Type != Symbol {
+					panic(errorf(ErrSyntax, "define", "name must be a symbol, got %s", printExpr(sym)))
+				}
+				// A module's top level is its own, so hiding a global
+				// there is on purpose
+				if env.module == nil && env.Shadows(sym.Sym) {
+					env.interpreter().warnShadow(e, sym.Sym)
+				}
+				doc, value := splitDoc(args.Tail)
+				val := eval(value.Head, env)
+				if (val.Type == Lambda || val.Type == Macro) && val.Name == "" {
+					val.Name = sym.Sym
+				}
 				env.Define(sym.Sym, val)
+				if doc != "" {
+					env.SetDoc(sym.Sym, doc)
+				}
+				return val
+			case "set!":
+				// (set! name value) updates the binding define made
+				sym := args.Head
+				if sym.Type != Symbol {
+					panic(errorf(ErrSyntax, "set!", "name must be a symbol, got %s", printExpr(sym)))
+				}
+				val := eval(args.Tail.Head, env)
+				if !env.Set(sym.Sym, val) {
+					panic(errorf(ErrUnbound, "set!", "unbound symbol: %s", sym.Sym))
+				}
 				return val
-			case "macro":
-				params := args.Head
-				body := args.Tail.Head
-				return makeLambda(params, body, env, Macro)
 			case "lambda":
 				params := args.Head
-				bodyExprs := args.Tail
-
-				// If there's only one body expression, use it directly
-				// Otherwise, wrap multiple expressions in an implicit begin
-				var body *Expr
-				if bodyExprs.Tail == nilExpr {
-					// Single expression
-					body = bodyExprs.Head
-				} else {
-					// Multiple expressions - wrap in begin
-					body = pair(makeSym("begin"), bodyExprs)
-				}
-				return makeLambda(params, body, env, Lambda)
+				doc, body := splitDoc(args.Tail)
+				fn := makeLambda(params, implicitBegin(body), env, Lambda)
+				fn.Doc = doc
+				return fn
+			case "let", "let*", "letrec":
+				// The body runs as a tail call in the new scope
+				e, env = evalLet(op.Sym, args, env)
+				continue
 			case "begin":
-				var result *Expr = nilExpr
-				for args != nilExpr {
-					result = eval(args.Head, env)
-					args = args.Tail
-				}
-				return result
-			case "load":
-				// (load "filepath.lisp")
 				if args == nilExpr {
-					panic("load: missing filepath argument")
-				}
-
-				// Evaluate the filepath argument (could be a variable)
-				filepath := eval(args.Head, env)
-
-				if filepath.Type != String {
-					panic("load: argument must be a string")
-				}
-
-				content, err := os.ReadFile(filepath.Str)
-				if err != nil {
-					panic(fmt.Sprintf("load: cannot read file %s: %v", filepath.Str, err))
+					return nilExpr
 				}
-
-				exprs := readMultipleExprs(string(content))
-
-				var result *Expr = nilExpr
-				for _, expr := range exprs {
-					result = eval(expr, env)
+				// Everything but the last expression, which is a tail call
+				for args.Tail != nilExpr {
+					eval(args.Head, env)
+					args = args.Tail
 				}
-
-				return result
+				e = args.Head
+				continue
 			}
 		}
 
 		fn := eval(op, env)
 		evaledArgs := evalList(args, env)
 
-		if fn.Type == Builtin {
-			return fn.Fn(evaledArgs)
-		}
-
 		if fn.Type == Lambda {
-			newEnv := NewEnv(fn.Env)
-
-			params := fn.Params
-			i := 0
-			for params != nilExpr {
-				// Check for &rest parameter
-				if params.Head != nil && params.Head.Type == Symbol && params.Head.Sym == "&rest" {
-					// Next param gets all remaining args as a list
-					params = params.Tail
-					if params == nilExpr {
-						panic("lambda: &rest requires a parameter name")
-					}
-					// Build a list from remaining args
-					restList := nilExpr
-					for j := len(evaledArgs) - 1; j >= i; j-- {
-						restList = pair(evaledArgs[j], restList)
-					}
-					newEnv.Define(params.Head.Sym, restList)
-					break
-				}
-
-				if i >= len(evaledArgs) {
-					panic("not enough arguments")
-				}
-				newEnv.Define(params.Head.Sym, evaledArgs[i])
-				params = params.Tail
-				i++
-			}
-
-			if i < len(evaledArgs) && params == nilExpr {
-				panic("too many arguments")
-			}
-
-			return eval(fn.Body, newEnv)
+			// Tail call: continue with the body instead of recursing
+			callees = recordTailCall(callees, fn)
 		}
-
-		panic(fmt.Sprintf("not a function: %s", printExpr(fn)))
-	default:
-		return e
+		result, body, bodyEnv := applyTail(env, fn, evaledArgs)
+		if body == nil {
+			return result
+		}
+		e, env = body, bodyEnv
 	}
 }
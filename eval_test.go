@@ -1,14 +1,89 @@
-package main
+package minilisp
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
-func TestEvalNumber(t *testing.T) {
-	env := NewEnv(nil)
+// Run on both backends, see runOnBackends
+func TestEvaluator(t *testing.T) {
+	runOnBackends(t, []backendTest{
+		{"EvalNumber", testEvalNumber},
+		{"EvalBool", testEvalBool},
+		{"EvalNil", testEvalNil},
+		{"EvalSymbol", testEvalSymbol},
+		{"EvalUndefinedSymbol", testEvalUndefinedSymbol},
+		{"EvalSymbolInNestedScope", testEvalSymbolInNestedScope},
+		{"EvalWithShadowing", testEvalWithShadowing},
+		{"Quote", testQuote},
+		{"QuoteSugar", testQuoteSugar},
+		{"If", testIf},
+		{"IfOnlyEvaluatesOneBranch", testIfOnlyEvaluatesOneBranch},
+		{"Define", testDefine},
+		{"DefineWithExpression", testDefineWithExpression},
+		{"Begin", testBegin},
+		{"NestedIf", testNestedIf},
+		{"ComplexProgram", testComplexProgram},
+		{"Lambda", testLambda},
+		{"LambdaApplication", testLambdaApplication},
+		{"LambdaMultipleParams", testLambdaMultipleParams},
+		{"DefineLambda", testDefineLambda},
+		{"SimpleClosure", testSimpleClosure},
+		{"NestedClosure", testNestedClosure},
+		{"ClosureCapture", testClosureCapture},
+		{"Recursion", testRecursion},
+		{"Fibonacci", testFibonacci},
+		{"HigherOrderFunction", testHigherOrderFunction},
+		{"MacroCreation", testMacroCreation},
+		{"SimpleMacro", testSimpleMacro},
+		{"MacroVsFunction", testMacroVsFunction},
+		{"UnlessMacro", testUnlessMacro},
+		{"MacroExpansion", testMacroExpansion},
+		{"Defmacro", testDefmacro},
+		{"AndMacro", testAndMacro},
+		{"OrMacro", testOrMacro},
+		{"LetMacro", testLetMacro},
+		{"RecursiveMacroExpansion", testRecursiveMacroExpansion},
+		{"LoadSimpleFile", testLoadSimpleFile},
+		{"LoadWithMacros", testLoadWithMacros},
+		{"LoadReturnsLastValue", testLoadReturnsLastValue},
+		{"LoadNonexistentFile", testLoadNonexistentFile},
+		{"LoadRelativePath", testLoadRelativePath},
+		{"LoadPreventsDuplicates", testLoadPreventsDuplicates},
+		{"VariadicLambda", testVariadicLambda},
+		{"VariadicLambdaEmpty", testVariadicLambdaEmpty},
+		{"VariadicLambdaMixed", testVariadicLambdaMixed},
+		{"VariadicMacro", testVariadicMacro},
+		{"VariadicMacroEmpty", testVariadicMacroEmpty},
+		{"VariadicLambdaSingleArg", testVariadicLambdaSingleArg},
+		{"IfWithoutElse", testIfWithoutElse},
+		{"TailCallMillionDeep", testTailCallMillionDeep},
+		{"TailCallThroughBegin", testTailCallThroughBegin},
+		{"TailCallMutualRecursion", testTailCallMutualRecursion},
+		{"TailCallMapStyleHelpers", testTailCallMapStyleHelpers},
+		{"TailCallThroughCond", testTailCallThroughCond},
+		{"TailCallStdSumHelper", testTailCallStdSumHelper},
+		{"TailCallTraceKeepsCallers", testTailCallTraceKeepsCallers},
+		{"SetUpdatesEnclosingBinding", testSetUpdatesEnclosingBinding},
+		{"SetUnboundSymbol", testSetUnboundSymbol},
+		{"StatefulClosures", testStatefulClosures},
+		{"DefineShadowWarning", testDefineShadowWarning},
+		{"FalseIsFalsy", testFalseIsFalsy},
+		{"NotAndOr", testNotAndOr},
+		{"AndOrShortCircuit", testAndOrShortCircuit},
+		{"OrTailCall", testOrTailCall},
+		{"PredicatesReturnBooleans", testPredicatesReturnBooleans},
+		{"EnvBuiltinGetsCallingEnv", testEnvBuiltinGetsCallingEnv},
+		{"ApplyProcTracesLambdas", testApplyProcTracesLambdas},
+	})
+}
+
+func testEvalNumber(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 	tests := []int{0, 42, -10, 999}
 
 	for _, num := range tests {
@@ -24,8 +99,8 @@ func TestEvalNumber(t *testing.T) {
 	}
 }
 
-func TestEvalBool(t *testing.T) {
-	env := NewEnv(nil)
+func testEvalBool(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	result := eval(trueExpr, env)
 	if result != trueExpr {
@@ -33,8 +108,8 @@ func TestEvalBool(t *testing.T) {
 	}
 }
 
-func TestEvalNil(t *testing.T) {
-	env := NewEnv(nil)
+func testEvalNil(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	result := eval(nilExpr, env)
 	if result != nilExpr {
@@ -42,8 +117,8 @@ func TestEvalNil(t *testing.T) {
 	}
 }
 
-func TestEvalSymbol(t *testing.T) {
-	env := NewEnv(nil)
+func testEvalSymbol(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 	env.Define("x", makeNum(42))
 	env.Define("y", makeNum(99))
 
@@ -68,8 +143,8 @@ func TestEvalSymbol(t *testing.T) {
 	}
 }
 
-func TestEvalUndefinedSymbol(t *testing.T) {
-	env := NewEnv(nil)
+func testEvalUndefinedSymbol(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	defer func() {
 		if r := recover(); r == nil {
@@ -80,8 +155,8 @@ func TestEvalUndefinedSymbol(t *testing.T) {
 	eval(makeSym("undefined"), env)
 }
 
-func TestEvalSymbolInNestedScope(t *testing.T) {
-	parent := NewEnv(nil)
+func testEvalSymbolInNestedScope(t *testing.T, backend Backend) {
+	parent := setupFullEnv(WithBackend(backend))
 	parent.Define("x", makeNum(10))
 
 	child := NewEnv(parent)
@@ -99,8 +174,8 @@ func TestEvalSymbolInNestedScope(t *testing.T) {
 	}
 }
 
-func TestEvalWithShadowing(t *testing.T) {
-	parent := NewEnv(nil)
+func testEvalWithShadowing(t *testing.T, backend Backend) {
+	parent := setupFullEnv(WithBackend(backend))
 	parent.Define("x", makeNum(10))
 
 	child := NewEnv(parent)
@@ -112,8 +187,8 @@ func TestEvalWithShadowing(t *testing.T) {
 	}
 }
 
-func TestQuote(t *testing.T) {
-	env := NewEnv(nil)
+func testQuote(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	tests := []struct {
 		input string
@@ -136,8 +211,8 @@ func TestQuote(t *testing.T) {
 	}
 }
 
-func TestQuoteSugar(t *testing.T) {
-	env := NewEnv(nil)
+func testQuoteSugar(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	tests := []struct {
 		input string
@@ -159,8 +234,8 @@ func TestQuoteSugar(t *testing.T) {
 	}
 }
 
-func TestIf(t *testing.T) {
-	env := NewEnv(nil)
+func testIf(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	tests := []struct {
 		input string
@@ -181,9 +256,8 @@ func TestIf(t *testing.T) {
 	}
 }
 
-func TestIfOnlyEvaluatesOneBranch(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+func testIfOnlyEvaluatesOneBranch(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Only the true branch should evaluate
 	expr := readStr("(if true (+ 1 2) (+ 3 undefined))")
@@ -202,8 +276,8 @@ func TestIfOnlyEvaluatesOneBranch(t *testing.T) {
 	}
 }
 
-func TestDefine(t *testing.T) {
-	env := NewEnv(nil)
+func testDefine(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define a variable
 	expr := readStr("(define x 42)")
@@ -219,10 +293,8 @@ func TestDefine(t *testing.T) {
 	}
 }
 
-func TestDefineWithExpression(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
+func testDefineWithExpression(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define using an expression
 	expr := readStr("(define result (+ (* 2 3) (* 4 5)))")
@@ -234,9 +306,8 @@ func TestDefineWithExpression(t *testing.T) {
 	}
 }
 
-func TestBegin(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+func testBegin(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// begin evaluates multiple expressions, returns last
 	expr := readStr("(begin (define x 10) (define y 20) (+ x y))")
@@ -255,9 +326,8 @@ func TestBegin(t *testing.T) {
 	}
 }
 
-func TestNestedIf(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("<", makeBuiltin(builtinLt))
+func testNestedIf(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Nested if: (if (< 3 5) (if true 1 2) 3)
 	expr := readStr("(if (< 3 5) (if true 1 2) 3)")
@@ -268,11 +338,8 @@ func TestNestedIf(t *testing.T) {
 	}
 }
 
-func TestComplexProgram(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
-	env.Define("<", makeBuiltin(builtinLt))
+func testComplexProgram(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	program := `
 		(begin
@@ -292,10 +359,8 @@ func TestComplexProgram(t *testing.T) {
 	}
 }
 
-func TestLambda(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
+func testLambda(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Create a lambda
 	expr := readStr("(lambda (x) (* x 2))")
@@ -306,10 +371,8 @@ func TestLambda(t *testing.T) {
 	}
 }
 
-func TestLambdaApplication(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
+func testLambdaApplication(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// ((lambda (x) (* x 2)) 21) → 42
 	expr := readStr("((lambda (x) (* x 2)) 21)")
@@ -320,9 +383,8 @@ func TestLambdaApplication(t *testing.T) {
 	}
 }
 
-func TestLambdaMultipleParams(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+func testLambdaMultipleParams(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// ((lambda (x y) (+ x y)) 10 20) → 30
 	expr := readStr("((lambda (x y) (+ x y)) 10 20)")
@@ -333,10 +395,8 @@ func TestLambdaMultipleParams(t *testing.T) {
 	}
 }
 
-func TestDefineLambda(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
+func testDefineLambda(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define a function
 	eval(readStr("(define double (lambda (x) (* x 2)))"), env)
@@ -349,9 +409,8 @@ func TestDefineLambda(t *testing.T) {
 	}
 }
 
-func TestSimpleClosure(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+func testSimpleClosure(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	program := `
 		(begin
@@ -367,9 +426,8 @@ func TestSimpleClosure(t *testing.T) {
 	}
 }
 
-func TestNestedClosure(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+func testNestedClosure(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	program := `
 		(begin
@@ -387,9 +445,8 @@ func TestNestedClosure(t *testing.T) {
 	}
 }
 
-func TestClosureCapture(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+func testClosureCapture(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Two closures capturing different values
 	program := `
@@ -408,12 +465,8 @@ func TestClosureCapture(t *testing.T) {
 	}
 }
 
-func TestRecursion(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("-", makeBuiltin(builtinSub))
-	env.Define("*", makeBuiltin(builtinMul))
-	env.Define("=", makeBuiltin(builtinEq))
+func testRecursion(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define factorial
 	factorial := `
@@ -445,11 +498,8 @@ func TestRecursion(t *testing.T) {
 	}
 }
 
-func TestFibonacci(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("-", makeBuiltin(builtinSub))
-	env.Define("<", makeBuiltin(builtinLt))
+func testFibonacci(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	fib := `
 		(define fib
@@ -484,10 +534,8 @@ func TestFibonacci(t *testing.T) {
 	}
 }
 
-func TestHigherOrderFunction(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
+func testHigherOrderFunction(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Function that takes a function as argument
 	program := `
@@ -507,8 +555,8 @@ func TestHigherOrderFunction(t *testing.T) {
 	}
 }
 
-func TestMacroCreation(t *testing.T) {
-	env := NewEnv(nil)
+func testMacroCreation(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Create a macro
 	expr := readStr("(macro (x) x)")
@@ -519,9 +567,8 @@ func TestMacroCreation(t *testing.T) {
 	}
 }
 
-func TestSimpleMacro(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testSimpleMacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define a macro that quotes its argument
 	eval(readStr("(define my-quote (macro (x) (pair 'quote (pair x nil))))"), env)
@@ -538,10 +585,8 @@ func TestSimpleMacro(t *testing.T) {
 	}
 }
 
-func TestMacroVsFunction(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("pair", makeBuiltin(builtinPair))
+func testMacroVsFunction(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Function version - evaluates argument
 	eval(readStr("(define func-quote (lambda (x) x))"), env)
@@ -562,9 +607,8 @@ func TestMacroVsFunction(t *testing.T) {
 	}
 }
 
-func TestUnlessMacro(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testUnlessMacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define unless macro
 	unless := `
@@ -598,9 +642,8 @@ func TestUnlessMacro(t *testing.T) {
 	}
 }
 
-func TestMacroExpansion(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testMacroExpansion(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Define unless macro
 	unless := `
@@ -618,9 +661,8 @@ func TestMacroExpansion(t *testing.T) {
 	}
 }
 
-func TestDefmacro(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testDefmacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Bootstrap defmacro
 	defmacroCode := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
@@ -638,9 +680,8 @@ func TestDefmacro(t *testing.T) {
 	}
 }
 
-func TestAndMacro(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testAndMacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	defmacro := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
 	eval(readStr(defmacro), env)
@@ -669,9 +710,8 @@ func TestAndMacro(t *testing.T) {
 	}
 }
 
-func TestOrMacro(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testOrMacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	defmacro := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
 	eval(readStr(defmacro), env)
@@ -700,12 +740,8 @@ func TestOrMacro(t *testing.T) {
 	}
 }
 
-func TestLetMacro(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("head", makeBuiltin(builtinHead))
-	env.Define("tail", makeBuiltin(builtinTail))
-	env.Define("pair", makeBuiltin(builtinPair))
+func testLetMacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	defmacro := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
 	eval(readStr(defmacro), env)
@@ -728,9 +764,8 @@ func TestLetMacro(t *testing.T) {
 	}
 }
 
-func TestRecursiveMacroExpansion(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+func testRecursiveMacroExpansion(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	defmacro := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
 	eval(readStr(defmacro), env)
@@ -750,7 +785,7 @@ func TestRecursiveMacroExpansion(t *testing.T) {
 	}
 }
 
-func TestLoadSimpleFile(t *testing.T) {
+func testLoadSimpleFile(t *testing.T, backend Backend) {
 	// Create a temporary file
 	tmpfile, err := os.CreateTemp("", "test-*.lisp")
 	if err != nil {
@@ -767,7 +802,7 @@ func TestLoadSimpleFile(t *testing.T) {
 	tmpfile.Close()
 
 	// Load the file
-	env := setupFullEnv()
+	env := setupFullEnv(WithBackend(backend))
 
 	loadExpr := readStr(fmt.Sprintf("(load \"%s\")", tmpfile.Name()))
 	eval(loadExpr, env)
@@ -781,7 +816,7 @@ func TestLoadSimpleFile(t *testing.T) {
 	}
 }
 
-func TestLoadWithMacros(t *testing.T) {
+func testLoadWithMacros(t *testing.T, backend Backend) {
 	tmpfile, err := os.CreateTemp("", "macros-*.lisp")
 	if err != nil {
 		t.Fatal(err)
@@ -802,7 +837,7 @@ func TestLoadWithMacros(t *testing.T) {
 	tmpfile.Close()
 
 	// Load and use the macro
-	env := setupFullEnv()
+	env := setupFullEnv(WithBackend(backend))
 
 	loadExpr := readStr(fmt.Sprintf("(load \"%s\")", tmpfile.Name()))
 	eval(loadExpr, env)
@@ -814,7 +849,7 @@ func TestLoadWithMacros(t *testing.T) {
 	}
 }
 
-func TestLoadReturnsLastValue(t *testing.T) {
+func testLoadReturnsLastValue(t *testing.T, backend Backend) {
 	tmpfile, err := os.CreateTemp("", "return-*.lisp")
 	if err != nil {
 		t.Fatal(err)
@@ -830,7 +865,7 @@ func TestLoadReturnsLastValue(t *testing.T) {
 	}
 	tmpfile.Close()
 
-	env := setupFullEnv()
+	env := setupFullEnv(WithBackend(backend))
 
 	loadExpr := readStr(fmt.Sprintf("(load \"%s\")", tmpfile.Name()))
 	result := eval(loadExpr, env)
@@ -841,8 +876,8 @@ func TestLoadReturnsLastValue(t *testing.T) {
 	}
 }
 
-func TestLoadNonexistentFile(t *testing.T) {
-	env := setupFullEnv()
+func testLoadNonexistentFile(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	defer func() {
 		if r := recover(); r == nil {
@@ -854,7 +889,7 @@ func TestLoadNonexistentFile(t *testing.T) {
 	eval(loadExpr, env)
 }
 
-func TestLoadRelativePath(t *testing.T) {
+func testLoadRelativePath(t *testing.T, backend Backend) {
 	// Create subdirectory
 	tmpdir, err := os.MkdirTemp("", "testdir-*")
 	if err != nil {
@@ -870,7 +905,7 @@ func TestLoadRelativePath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	env := setupFullEnv()
+	env := setupFullEnv(WithBackend(backend))
 
 	// Change to temp directory
 	oldDir, _ := os.Getwd()
@@ -886,7 +921,7 @@ func TestLoadRelativePath(t *testing.T) {
 	}
 }
 
-func TestLoadPreventsDuplicates(t *testing.T) {
+func testLoadPreventsDuplicates(t *testing.T, backend Backend) {
 	tmpfile, err := os.CreateTemp("", "counter-*.lisp")
 	if err != nil {
 		t.Fatal(err)
@@ -900,7 +935,7 @@ func TestLoadPreventsDuplicates(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	env := setupFullEnv()
+	env := setupFullEnv(WithBackend(backend))
 	env.Define("counter", nilExpr) // Start with nil
 
 	// Load twice
@@ -914,8 +949,8 @@ func TestLoadPreventsDuplicates(t *testing.T) {
 	}
 }
 
-func TestVariadicLambda(t *testing.T) {
-	env := setupFullEnv()
+func testVariadicLambda(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Test basic variadic lambda with &rest
 	expr := readStr("(define list (lambda (&rest items) items))")
@@ -933,8 +968,8 @@ func TestVariadicLambda(t *testing.T) {
 	}
 }
 
-func TestVariadicLambdaEmpty(t *testing.T) {
-	env := setupFullEnv()
+func testVariadicLambdaEmpty(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Test variadic lambda with no arguments
 	expr := readStr("(define list (lambda (&rest items) items))")
@@ -946,8 +981,8 @@ func TestVariadicLambdaEmpty(t *testing.T) {
 	}
 }
 
-func TestVariadicLambdaMixed(t *testing.T) {
-	env := setupFullEnv()
+func testVariadicLambdaMixed(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Test variadic lambda with regular params + &rest
 	expr := readStr("(define make-pair (lambda (first &rest rest) (pair first rest)))")
@@ -972,8 +1007,8 @@ func TestVariadicLambdaMixed(t *testing.T) {
 	}
 }
 
-func TestVariadicMacro(t *testing.T) {
-	env := setupFullEnv()
+func testVariadicMacro(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Bootstrap defmacro
 	defmacroCode := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
@@ -999,8 +1034,8 @@ func TestVariadicMacro(t *testing.T) {
 	}
 }
 
-func TestVariadicMacroEmpty(t *testing.T) {
-	env := setupFullEnv()
+func testVariadicMacroEmpty(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Bootstrap defmacro
 	defmacroCode := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
@@ -1021,8 +1056,8 @@ func TestVariadicMacroEmpty(t *testing.T) {
 	}
 }
 
-func TestVariadicLambdaSingleArg(t *testing.T) {
-	env := setupFullEnv()
+func testVariadicLambdaSingleArg(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
 
 	// Test variadic with just one argument
 	expr := readStr("(define single (lambda (&rest items) items))")
@@ -1038,3 +1073,447 @@ func TestVariadicLambdaSingleArg(t *testing.T) {
 		t.Errorf("expected 42, got %d", items[0].Num)
 	}
 }
+
+func testIfWithoutElse(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	result := eval(readStr("(if nil 1)"), env)
+	if result != nilExpr {
+		t.Errorf("(if nil 1) = %v, want nil", printExpr(result))
+	}
+}
+
+func testTailCallMillionDeep(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	program := `
+		(define count-down
+			(lambda (n acc)
+				(if (= n 0)
+					acc
+					(count-down (- n 1) (+ acc 1)))))
+		(count-down 1000000 0)
+	`
+
+	var result *Expr
+	for _, expr := range readMultipleExprs(program) {
+		result = eval(expr, env)
+	}
+
+	if result.Num != 1000000 {
+		t.Errorf("count-down = %d, want 1000000", result.Num)
+	}
+}
+
+func testTailCallThroughBegin(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	// The recursive call is the last expression of a multi-expression body
+	program := `
+		(define loop
+			(lambda (n)
+				(define next (- n 1))
+				(if (= n 0)
+					'done
+					(begin
+						next
+						(loop next)))))
+		(loop 1000000)
+	`
+
+	var result *Expr
+	for _, expr := range readMultipleExprs(program) {
+		result = eval(expr, env)
+	}
+
+	if printExpr(result) != "done" {
+		t.Errorf("loop = %s, want done", printExpr(result))
+	}
+}
+
+func testTailCallMutualRecursion(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	program := `
+		(define even?
+			(lambda (n) (if (= n 0) true (odd? (- n 1)))))
+		(define odd?
+			(lambda (n) (if (= n 0) nil (even? (- n 1)))))
+		(even? 1000000)
+	`
+
+	var result *Expr
+	for _, expr := range readMultipleExprs(program) {
+		result = eval(expr, env)
+	}
+
+	if result != trueExpr {
+		t.Errorf("(even? 1000000) = %s, want true", printExpr(result))
+	}
+}
+
+func testTailCallMapStyleHelpers(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	items := make([]*Expr, 1000000)
+	for i := range items {
+		items[i] = makeNum(i + 1)
+	}
+	env.Define("numbers", list(items...))
+
+	// Accumulator-passing map over a million element list
+	program := `
+		(define reverse-acc
+			(lambda (lst acc)
+				(if (null? lst)
+					acc
+					(reverse-acc (tail lst) (pair (head lst) acc)))))
+
+		(define map-acc
+			(lambda (f lst acc)
+				(if (null? lst)
+					(reverse-acc acc nil)
+					(map-acc f (tail lst) (pair (f (head lst)) acc)))))
+
+		(map-acc (lambda (x) (* x 2)) numbers nil)
+	`
+
+	var result *Expr
+	for _, expr := range readMultipleExprs(program) {
+		result = eval(expr, env)
+	}
+
+	doubled := listToSlice(result)
+	if len(doubled) != 1000000 {
+		t.Fatalf("map-acc returned %d items, want 1000000", len(doubled))
+	}
+	if doubled[0].Num != 2 || doubled[999999].Num != 2000000 {
+		t.Errorf("map-acc = (%d ... %d), want (2 ... 2000000)", doubled[0].Num, doubled[999999].Num)
+	}
+}
+
+func testTailCallThroughCond(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	// cond expands to nested ifs, so its clause bodies are tail calls too
+	program := `
+		(define steps
+			(lambda (n acc)
+				(cond
+					((= n 0) acc)
+					((> n 10) (steps (- n 2) (+ acc 1)))
+					(true (steps (- n 1) (+ acc 1))))))
+		(steps 100000 0)
+	`
+
+	var result *Expr
+	for _, expr := range readMultipleExprs(program) {
+		result = eval(expr, env)
+	}
+
+	// 49995 steps of 2 down to 10, then 10 steps of 1
+	if result.Num != 50005 {
+		t.Errorf("steps = %d, want 50005", result.Num)
+	}
+}
+
+func testTailCallStdSumHelper(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+	eval(readStr(`(load "std/functions.lisp")`), env)
+
+	// sum-helper from the std library recursing over a long list
+	items := make([]*Expr, 200000)
+	for i := range items {
+		items[i] = makeNum(1)
+	}
+	env.Define("ones", list(items...))
+
+	result := eval(readStr("(sum-helper ones 0)"), env)
+	if result.Num != 200000 {
+		t.Errorf("sum-helper = %d, want 200000", result.Num)
+	}
+}
+
+func testTailCallTraceKeepsCallers(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	// b is tail-called from a, but both still show up in the trace
+	program := `
+		(define b (lambda (x) (hash-get x)))
+		(define a (lambda (x) (b x)))
+		(a 1)
+	`
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("a should fail")
+		}
+		err := recoverError(r)
+		if got := strings.Join(err.Trace, " <- "); got != "b <- a" {
+			t.Errorf("trace = %q, want \"b <- a\"", got)
+		}
+	}()
+
+	for _, expr := range readMultipleExprs(program) {
+		eval(expr, env)
+	}
+}
+
+func testSetUpdatesEnclosingBinding(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(define x 1)", "1"},
+		{"(set! x 2)", "2"},
+		{"x", "2"},
+		{"((lambda () (set! x (+ x 1))))", "3"},
+		{"x", "3"},
+		// set! on a parameter only changes the parameter
+		{"((lambda (x) (set! x 10) x) 5)", "10"},
+		{"x", "3"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testSetUnboundSymbol(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("set! of an unbound symbol should panic")
+		}
+		err := recoverError(r)
+		if err.Kind != ErrUnbound || errorMessage(err) != "set!: unbound symbol: nope" {
+			t.Errorf("error = %s %q", err.Kind, errorMessage(err))
+		}
+	}()
+
+	eval(readStr("(set! nope 1)"), env)
+}
+
+func testStatefulClosures(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	code := `(define make-counter
+		(lambda ()
+			(define count 0)
+			(lambda () (set! count (+ count 1)) count)))`
+	eval(readStr(code), env)
+	eval(readStr("(define a (make-counter))"), env)
+	eval(readStr("(define b (make-counter))"), env)
+
+	eval(readStr("(a)"), env)
+	eval(readStr("(a)"), env)
+	if got := eval(readStr("(a)"), env); got.Num != 3 {
+		t.Errorf("third (a) = %v, want 3", printExpr(got))
+	}
+	if got := eval(readStr("(b)"), env); got.Num != 1 {
+		t.Errorf("first (b) = %v, want 1", printExpr(got))
+	}
+	if _, ok := env.Lookup("count"); ok {
+		t.Error("count should only live inside the closures")
+	}
+}
+
+func testDefineShadowWarning(t *testing.T, backend Backend) {
+	var out strings.Builder
+	env := setupFullEnv(WithBackend(backend))
+	env.interpreter().stderr = &out
+	program := `(define total 0)
+(define add
+  (lambda (n)
+    (define total (+ total n))
+    total))
+(add 1)
+(add 2)
+(define total 5)
+(define fresh (lambda () (define unique-local 1) unique-local))
+(fresh)`
+
+	for _, expr := range readSource(program, "shadow.lisp") {
+		eval(expr, env)
+	}
+
+	// Warns once for the define in add, and not for the global redefine
+	// or a local that shadows nothing
+	want := "warning: shadow.lisp:4:5: define of total shadows an outer binding, use set! to change it\n"
+	if out.String() != want {
+		t.Errorf("warnings = %q, want %q", out.String(), want)
+	}
+}
+
+func testFalseIsFalsy(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(if false 1 2)", "2"},
+		{"(if nil 1 2)", "2"},
+		{"(if true 1 2)", "1"},
+		// Everything except false and nil is truthy
+		{"(if 0 1 2)", "1"},
+		{`(if "" 1 2)`, "1"},
+		{"(if (< 2 1) 1 2)", "2"},
+		{"(if false 1)", "nil"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testNotAndOr(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(not true)", "false"},
+		{"(not false)", "true"},
+		{"(not nil)", "true"},
+		{"(not 0)", "false"},
+		{"(and)", "true"},
+		{"(and 1 2 3)", "3"},
+		{"(and 1 false 3)", "false"},
+		{"(and 1 nil 3)", "nil"},
+		{"(or)", "false"},
+		{"(or false nil 3)", "3"},
+		{"(or false nil)", "nil"},
+		{"(or 1 2)", "1"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testAndOrShortCircuit(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	// undefined-symbol would raise an error if it were evaluated
+	tests := []string{
+		"(and false undefined-symbol)",
+		"(and nil undefined-symbol)",
+		"(or 1 undefined-symbol)",
+		"(or (< 1 2) undefined-symbol)",
+	}
+
+	for _, input := range tests {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s evaluated past the deciding value: %s", input, formatError(r))
+				}
+			}()
+			eval(readStr(input), env)
+		}()
+	}
+}
+
+func testOrTailCall(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	code := `(define count-down
+		(lambda (n) (or (= n 0) (count-down (- n 1)))))`
+	eval(readStr(code), env)
+
+	result := eval(readStr("(count-down 1000000)"), env)
+	if result != trueExpr {
+		t.Errorf("(count-down 1000000) = %s, want true", printExpr(result))
+	}
+}
+
+func testPredicatesReturnBooleans(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(= 1 2)", "false"},
+		{"(= 1 1)", "true"},
+		{"(!= 1 2)", "true"},
+		{`(!= 1 "1")`, "true"},
+		{"(!= (pair 1 (pair 2 nil)) (pair 1 (pair 3 nil)))", "true"},
+		{"(< 2 1)", "false"},
+		{"(null? 1)", "false"},
+		{`(number? "x")`, "false"},
+		{"(= false false)", "true"},
+		{"(= false nil)", "false"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testEnvBuiltinGetsCallingEnv(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env.SetContext(ctx)
+
+	// (lookup 'x) finds x where it's called from
+	var gotCtx context.Context
+	env.Define("lookup", makeEnvBuiltin(func(c context.Context, callEnv *Env, args []*Expr) *Expr {
+		gotCtx = c
+		val, _ := callEnv.Lookup(args[0].Sym)
+		return val
+	}))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(let ((x 1)) (lookup 'x))", "1"},
+		{"((lambda (x) (lookup 'x)) 2)", "2"},
+		{"(let ((x 3)) (map lookup '(x)))", "(3)"},
+		{"(let ((x 4)) (apply lookup '(x)))", "4"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+	if gotCtx != ctx {
+		t.Error("env builtin should get the context set on the global environment")
+	}
+}
+
+func testApplyProcTracesLambdas(t *testing.T, backend Backend) {
+	env := setupFullEnv(WithBackend(backend))
+	fn := eval(readStr(`(define explode (lambda (x) (+ x "a")))`), env)
+
+	defer func() {
+		err := recoverError(recover())
+		if len(err.Trace) == 0 || err.Trace[len(err.Trace)-1] != "explode" {
+			t.Errorf("trace = %v, want it to end with explode", err.Trace)
+		}
+	}()
+	applyProc(env, fn, []*Expr{makeNum(1)})
+}
@@ -18,19 +18,19 @@
 (define card
   (lambda (props)
     ; slots
-    (define title (hash-get props "title"))
-    (define content (hash-get props "content"))
+    (define title (:title props))
+    (define content (:content props))
 
     ; template
     (<div>
-      (hash "class" "card")
+      {:class "card"}
       (when-html title
-                (<h1> (hash "class" "card-title") title))
-      (<p> (hash "class" "card-content") content))))
+                (<h1> {:class "card-title"} title))
+      (<p> {:class "card-content"} content))))
 
 (define router
   (lambda (request)
-          (define path (hash-get request "path"))
+          (define path (:path request))
           (cond
             ((= path "/") (home-handler request))
             ((= path "/api") (api-handler request))
@@ -41,43 +41,49 @@
 
 (define home-handler
   (lambda (request)
-          (hash "status" 200
-                "headers" (hash "Content-Type" "text/html")
-                "body" (html-page
+          {:status 200
+           :headers {"Content-Type" "text/html"}
+           :body (html-page
                         (<div>
                          (<h1> "HTMX Counter Demo")
-                         (<div> (hash
-                         "id" "counter-display"
-                         "hx-get" "/counter"
-                         "hx-trigger" "load") "Loading..."))))))
+                         (<div> {:id "counter-display"
+                                 :hx-get "/counter"
+                                 :hx-trigger "load"} "Loading...")))}))
+
+; The count lives in a closure, only reachable through these functions
+(define make-counter
+  (lambda ()
+    (let ((count 0))
+      {:get (lambda () count)
+       :increment (lambda ()
+                    (set! count (+ count 1))
+                    count)})))
+
+(define counter (make-counter))
 
-(define app-state (hash "counter" 0))
 (define counter-handler
   (lambda (request)
-          (define current (hash-get app-state "counter"))
-          (hash "status" 200
-                "headers" (hash "Content-Type" "text/html")
-                "body" (string-append
-                        (<p> (hash "id" "count") (@string current))
-                        (<button> (hash
-                                   "hx-post" "/get-latest-count"
-                                   "hx-target" "#count"
-                                   "hx-swap" "outerHTML")
-                                   "Increment Counter")))))
+          (define current ((:get counter)))
+          {:status 200
+           :headers {"Content-Type" "text/html"}
+           :body (string-append
+                  (<p> {:id "count"} (@string current))
+                  (<button> {:hx-post "/get-latest-count"
+                             :hx-target "#count"
+                             :hx-swap "outerHTML"}
+                            "Increment Counter"))}))
 
 (define get-latest-count-handler
   (lambda (request)
-          (define current (hash-get app-state "counter"))
-          (define new-count (+ current 1))
-          (hash-set app-state "counter" new-count)
-          (hash "status" 200
-                "headers" (hash "Content-Type" "text/html")
-                "body" (<p> (hash "id" "count") (@string new-count)))))
+          (define new-count ((:increment counter)))
+          {:status 200
+           :headers {"Content-Type" "text/html"}
+           :body (<p> {:id "count"} (@string new-count))}))
 
 (define not-found-handler
   (lambda (request)
-          (hash "status" 404
-                "headers" (hash "Content-Type" "text/plain")
-                "body" "Not Found")))
+          {:status 404
+           :headers {"Content-Type" "text/plain"}
+           :body "Not Found"}))
 
 (http-server 3000 router)
\ No newline at end of file
@@ -1,110 +1,63 @@
-package main
+package minilisp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html"
+	"io"
 	"strings"
 )
 
 func builtinAdd(args []*Expr) *Expr {
-	sum := 0
+	sum := makeNum(0)
 	for _, arg := range args {
-		sum += arg.Num
+		sum = arith('+', sum, arg)
 	}
-	return makeNum(sum)
+	return sum
 }
 
 func builtinSub(args []*Expr) *Expr {
 	if len(args) == 0 {
 		return makeNum(0)
 	}
-	result := args[0].Num
+	result := args[0]
 	for i := 1; i < len(args); i++ {
-		result -= args[i].Num
+		result = arith('-', result, args[i])
 	}
-	return makeNum(result)
+	return result
 }
 
 func builtinMul(args []*Expr) *Expr {
-	result := 1
+	result := makeNum(1)
 	for _, arg := range args {
-		result *= arg.Num
+		result = arith('*', result, arg)
 	}
-	return makeNum(result)
+	return result
 }
 
+// Exact division: (/ 6 3) is 2 but (/ 7 2) is the rational 7/2.
+// Use quotient for integer division.
 func builtinDiv(args []*Expr) *Expr {
-	return makeNum(args[0].Num / args[1].Num)
-}
-
-func builtinEq(args []*Expr) *Expr {
-	a, b := args[0], args[1]
-
-	if a.Type != b.Type {
-		return nilExpr
+	if len(args) == 1 {
+		return divide("/", makeNum(1), args[0])
 	}
-
-	switch a.Type {
-	case Number:
-		if a.Num == b.Num {
-			return trueExpr
-		}
-	case Symbol:
-		if a.Sym == b.Sym {
-			return trueExpr
-		}
-	case String:
-		if a.Str == b.Str {
-			return trueExpr
-		}
-	case Nil:
-		return trueExpr
-	case Pair:
-		// Structural equality for lists
-		if structuralEq(a, b) {
-			return trueExpr
-		}
-	default:
-		if a == b {
-			return trueExpr
-		}
+	result := args[0]
+	for i := 1; i < len(args); i++ {
+		result = divide("/", result, args[i])
 	}
-	return nilExpr
+	return result
 }
-func builtinNotEq(args []*Expr) *Expr {
-	a, b := args[0], args[1]
 
-	if a.Type != b.Type {
-		return nilExpr
-	}
+// Lists compare structurally and numbers by value across the tower,
+// so (= 1 1.0) and (= (list 1 2) (list 1 2)) are both true
+func builtinEq(args []*Expr) *Expr {
+	return makeBool(structuralEq(args[0], args[1]))
+}
 
-	switch a.Type {
-	case Number:
-		if a.Num != b.Num {
-			return trueExpr
-		}
-	case Symbol:
-		if a.Sym != b.Sym {
-			return trueExpr
-		}
-	case String:
-		if a.Str != b.Str {
-			return trueExpr
-		}
-	case Nil:
-		return falseExpr
-	case Pair:
-		// Structural equality for lists
-		if structuralNotEq(a, b) {
-			return trueExpr
-		}
-	default:
-		if a != b {
-			return trueExpr
-		}
-	}
-	return nilExpr
+func builtinNotEq(args []*Expr) *Expr {
+	return makeBool(!structuralEq(args[0], args[1]))
 }
 
 func structuralEq(a, b *Expr) bool {
@@ -118,6 +71,10 @@ func structuralEq(a, b *Expr) bool {
 		return false
 	}
 
+	if isNumber(a) && isNumber(b) {
+		return compareNums(a, b) == 0
+	}
+
 	// Different types
 	if a.Type != b.Type {
 		return false
@@ -128,81 +85,55 @@ func structuralEq(a, b *Expr) bool {
 		return structuralEq(a.Head, b.Head) && structuralEq(a.Tail, b.Tail)
 	}
 
+	if a.Type == Vector {
+		if len(a.Items) != len(b.Items) {
+			return false
+		}
+		for i := range a.Items {
+			if !structuralEq(a.Items[i], b.Items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if a.Type == Hash {
+		return hashEq(a, b)
+	}
+
 	// For atoms, check value equality
 	switch a.Type {
 	case Number:
 		return a.Num == b.Num
-	case Symbol:
+	case Symbol, Keyword:
 		return a.Sym == b.Sym
 	case String:
 		return a.Str == b.Str
 	case Bool:
 		return a == b // trueExpr is a singleton
+	case Object:
+		return a.Obj.Type() == b.Obj.Type() && a.Obj.Pointer() == b.Obj.Pointer()
 	default:
 		return a == b // Pointer equality for other types
 	}
 }
-func structuralNotEq(a, b *Expr) bool {
-	// Both nil
-	if a == nilExpr && b == nilExpr {
-		return false
-	}
-
-	// One nil, one not
-	if a == nilExpr || b == nilExpr {
-		return false
-	}
-
-	// Different types
-	if a.Type != b.Type {
-		return false
-	}
-
-	// For pairs, recursively check head and tail
-	if a.Type == Pair {
-		return structuralNotEq(a.Head, b.Head) && structuralNotEq(a.Tail, b.Tail)
-	}
-
-	// For atoms, check value equality
-	switch a.Type {
-	case Number:
-		return a.Num != b.Num
-	case Symbol:
-		return a.Sym != b.Sym
-	case String:
-		return a.Str != b.Str
-	case Bool:
-		return a != b
-	default:
-		return a != b // Pointer equality for other types
-	}
-}
-
-// TODO -  maybe not nil for falsey?
 func builtinLt(args []*Expr) *Expr {
-	if args[0].Num < args[1].Num {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(compareArgs("<", args) < 0)
 }
 func builtinEqualOrLt(args []*Expr) *Expr {
-	if args[0].Num <= args[1].Num {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(compareArgs("<=", args) <= 0)
 }
 
 func builtinGt(args []*Expr) *Expr {
-	if args[0].Num > args[1].Num {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(compareArgs(">", args) > 0)
 }
 func builtinEqualOrGt(args []*Expr) *Expr {
-	if args[0].Num >= args[1].Num {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(compareArgs(">=", args) >= 0)
+}
+
+// Compare the two numeric arguments of an ordering builtin
+func compareArgs(name string, args []*Expr) int {
+	return compareNums(args[0], args[1])
 }
 
 func builtinPair(args []*Expr) *Expr {
@@ -226,165 +157,118 @@ func builtinTail(args []*Expr) *Expr {
 }
 
 func builtinNullP(args []*Expr) *Expr {
-	if args[0] == nilExpr {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(args[0] == nilExpr)
 }
 
-func builtinPrint(args []*Expr) *Expr {
-	fmt.Println(printExpr(args[0]))
+func builtinPrint(ctx context.Context, env *Env, args []*Expr) *Expr {
+	fmt.Fprintln(env.interpreter().stdout, printExpr(args[0]))
 	return args[0]
 }
 
-func builtinHash(args []*Expr) *Expr {
-	if len(args)%2 != 0 {
-		panic("hash: expect an even number of arguments")
-	}
-
-	h := makeHash()
-	for i := 0; i < len(args); i += 2 {
-		key := args[i]
-		value := args[i+1]
-
-		if key.Type != String {
-			panic("hash: keys must be strings")
-		}
-		hashSet(h, key.Str, value)
-	}
-
-	return h
-}
-
-func builtinHashGet(args []*Expr) *Expr {
-	if len(args) != 2 {
-		panic("hash-get: expects 2 arguments")
-	}
-
-	hash := args[0]
-	key := args[1]
-
-	if key.Type != String {
-		panic("hash-get: key must be a string")
-	}
-
-	val, ok := hashGet(hash, key.Str)
-	if !ok {
-		return nilExpr
-	}
-	return val
-}
-
-func builtinHashSet(args []*Expr) *Expr {
-	if len(args) != 3 {
-		panic("hash-set: expects 3 arguments (hash, key, value)")
+func builtinStringAppend(ctx context.Context, env *Env, args []*Expr) *Expr {
+	var n int64
+	for _, arg := range args {
+		n += int64(len(arg.Str))
 	}
+	env.evaluation().reserve(0, n)
 
-	hash := args[0]
-	key := args[1]
-	value := args[2]
-
-	if key.Type != String {
-		panic("hash-set: key must be a string")
+	var result strings.Builder
+	for _, arg := range args {
+		result.WriteString(arg.Str)
 	}
-
-	hashSet(hash, key.Str, value)
-	return hash
+	return makeStr(result.String())
 }
 
-func builtinHashKeys(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("hash-keys: expects 1 argument")
+// (@json text) decodes arrays as lists, (@json text 'vector) as vectors
+func builtinJsonParse(args []*Expr) *Expr {
+	vectors := false
+	if len(args) == 2 {
+		switch args[1].Sym {
+		case "vector":
+			vectors = true
+		case "list":
+		default:
+			panic(errorf(ErrValue, "@json", "array type must be 'list or 'vector, got %s", printExpr(args[1])))
+		}
 	}
 
-	keys := hashKeys(args[0])
-	result := nilExpr
-
-	// Build list of string keys
-	for i := len(keys) - 1; i >= 0; i-- {
-		result = pair(makeStr(keys[i]), result)
+	// Decode numbers as json.Number so integers and big values keep
+	// their exact digits instead of going through float64. Reading token
+	// by token keeps object keys in the order they're written.
+	decoder := json.NewDecoder(strings.NewReader(args[0].Str))
+	decoder.UseNumber()
+	result := jsonToExpr(decoder, vectors)
+	if _, err := decoder.Token(); err != io.EOF {
+		panic(errorf(ErrJSON, "@json", "unexpected data after top-level value"))
 	}
 
 	return result
 }
 
-func builtinStringAppend(args []*Expr) *Expr {
-	var result string
-	for _, arg := range args {
-		if arg.Type != String {
-			panic("string-append: all arguments must be strings")
-		}
-		result += arg.Str
-	}
-	return makeStr(result)
-}
-
-func builtinJsonParse(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("@json: expects 1 argument")
-	}
-
-	if args[0].Type != String {
-		panic("@json: argument must be a string")
-	}
-
-	var data interface{}
-	err := json.Unmarshal([]byte(args[0].Str), &data)
+// Read the next JSON value from the decoder
+func jsonToExpr(decoder *json.Decoder, vectors bool) *Expr {
+	tok, err := decoder.Token()
 	if err != nil {
-		panic(fmt.Sprintf("@json: %v", err))
+		panic(errorf(ErrJSON, "@json", "%v", err))
 	}
 
-	return jsonToExpr(data)
-}
-
-func jsonToExpr(data interface{}) *Expr {
-	switch v := data.(type) {
+	switch v := tok.(type) {
 	case nil:
 		return nilExpr
 
 	case bool:
-		if v {
-			return trueExpr
-		}
-		return nilExpr
+		return makeBool(v)
 
-	case float64:
-		return makeNum(int(v))
+	case json.Number:
+		if n, ok := parseNumber(string(v)); ok && n.Type != Rational {
+			return n
+		}
+		panic(errorf(ErrJSON, "@json", "invalid number %s", v))
 
 	case string:
 		return makeStr(v)
 
-	case []interface{}:
-		// JSON array → Lisp list
-		result := nilExpr
-		for i := len(v) - 1; i >= 0; i-- {
-			result = pair(jsonToExpr(v[i]), result)
+	case json.Delim:
+		if v == '[' {
+			// JSON array → Lisp list, or vector if asked for
+			items := []*Expr{}
+			for decoder.More() {
+				items = append(items, jsonToExpr(decoder, vectors))
+			}
+			jsonClose(decoder)
+			if vectors {
+				return makeVector(items)
+			}
+			return list(items...)
 		}
-		return result
 
-	case map[string]interface{}:
 		// JSON object → Hash
 		hash := makeHash()
-		for key, val := range v {
-			hashSet(hash, key, jsonToExpr(val))
+		for decoder.More() {
+			key := jsonToExpr(decoder, vectors)
+			hashSet(hash, key.Str, jsonToExpr(decoder, vectors))
 		}
+		jsonClose(decoder)
 		return hash
 
 	default:
-		panic(fmt.Sprintf("@json: unsupported type %T", v))
+		panic(errorf(ErrJSON, "@json", "unsupported type %T", v))
 	}
 }
 
-func builtinJsonStringify(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("json-stringify: expects 1 argument")
+// Read the ] or } that ends an array or object
+func jsonClose(decoder *json.Decoder) {
+	if _, err := decoder.Token(); err != nil {
+		panic(errorf(ErrJSON, "@json", "%v", err))
 	}
+}
 
+func builtinJsonStringify(args []*Expr) *Expr {
 	data := exprToJson(args[0])
 
 	bytes, err := json.Marshal(data)
 	if err != nil {
-		panic(fmt.Sprintf("json-stringify: %v", err))
+		panic(errorf(ErrJSON, "json-stringify", "%v", err))
 	}
 
 	return makeStr(string(bytes))
@@ -401,9 +285,24 @@ func exprToJson(e *Expr) interface{} {
 	case Number:
 		return e.Num
 
+	case Float:
+		return e.Float
+
+	case BigInt:
+		// Written out digit for digit rather than rounded through float64
+		return json.Number(e.Big.String())
+
+	case Rational:
+		// JSON has no fractions, so this is the nearest float
+		f, _ := e.Rat.Float64()
+		return f
+
 	case String:
 		return e.Str
 
+	case Keyword:
+		return e.Sym
+
 	case Pair:
 		// Lisp list → JSON array
 		items := listToSlice(e)
@@ -413,87 +312,114 @@ func exprToJson(e *Expr) interface{} {
 		}
 		return result
 
+	case Vector:
+		result := make([]interface{}, len(e.Items))
+		for i, item := range e.Items {
+			result[i] = exprToJson(item)
+		}
+		return result
+
 	case Hash:
-		// Hash → JSON object
-		result := make(map[string]interface{})
-		for key, val := range e.HashTable {
-			result[key] = exprToJson(val)
+		// Hash → JSON object, keys in insertion order
+		result := jsonObject{}
+		for _, entry := range e.HashTable.Entries() {
+			result = append(result, jsonField{jsonKey(entry.Key), exprToJson(entry.Val)})
 		}
 		return result
 
+	case Object:
+		// The Go value, which encoding/json knows how to write
+		return e.Obj.Interface()
+
 	default:
-		panic(fmt.Sprintf("json-stringify: cannot convert type %v", e.Type))
+		panic(errorf(ErrType, "json-stringify", "cannot convert type %v", e.Type))
 	}
 }
 
-// Type-checkers, might split out into own file later, maybe
+// A JSON object that marshals its fields in order, unlike a map
+type jsonObject []jsonField
 
-func builtinNumberP(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("number?: expect 1 argument")
+type jsonField struct {
+	Key string
+	Val interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(f.Val)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
 	}
-	if args[0].Type == Number {
-		return trueExpr
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// JSON keys are strings, so :name becomes "name" and other hash keys are
+// written as they print
+func jsonKey(key *Expr) string {
+	switch key.Type {
+	case String:
+		return key.Str
+	case Keyword:
+		return key.Sym
+	default:
+		return printExpr(key)
 	}
-	return nilExpr
+}
+
+// Type-checkers, might split out into own file later, maybe
+
+func builtinNumberP(args []*Expr) *Expr {
+	return makeBool(isNumber(args[0]))
 }
 
 func builtinStringP(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("string?: expect 1 argument")
-	}
-	if args[0].Type == String {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(args[0].Type == String)
 }
 
 func builtinSymbolP(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("symbol?: expect 1 argument")
-	}
-	if args[0].Type == Symbol {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(args[0].Type == Symbol)
 }
 
 func builtinListP(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("list?: expect 1 argument")
-	}
-	if args[0].Type == Pair {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(args[0].Type == Pair)
+}
+
+func builtinKeywordP(args []*Expr) *Expr {
+	return makeBool(args[0].Type == Keyword)
 }
 
 func builtinBoolP(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("bool?: expect 1 argument")
-	}
-	// In MiniLisp, true is a special value, nil is also considered bool
-	if args[0] == trueExpr || args[0] == nilExpr {
-		return trueExpr
-	}
-	return nilExpr
+	return makeBool(args[0].Type == Bool)
 }
 
 func builtinToString(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("@string: expect 1 argument")
-	}
-
 	val := args[0]
 
 	switch val.Type {
 	case Number:
 		return makeStr(fmt.Sprintf("%d", val.Num))
 
+	case Float, BigInt, Rational:
+		return makeStr(printExpr(val))
+
 	case String:
 		return val
 
-	case Symbol:
+	case Symbol, Keyword:
 		return makeStr(val.Sym)
 
 	case Nil:
@@ -514,34 +440,25 @@ func builtinToString(args []*Expr) *Expr {
 }
 
 func builtinToNumber(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("@number: expect 1 argument")
-	}
-
 	val := args[0]
 
 	switch val.Type {
-	case Number:
+	case Number, Float, BigInt, Rational:
 		return val
 
 	case String:
-		num := 0
-		_, err := fmt.Sscanf(val.Str, "%d", &num)
-		if err != nil {
-			panic(fmt.Sprintf("@number: cannot parse '%s' as number", val.Str))
+		num, ok := parseNumber(strings.TrimSpace(val.Str))
+		if !ok {
+			panic(errorf(ErrValue, "@number", "cannot parse '%s' as number", val.Str))
 		}
-		return makeNum(num)
+		return num
 
 	default:
-		panic(fmt.Sprintf("@number: cannot convert %s to number", val.Type))
+		panic(errorf(ErrType, "@number", "cannot convert %s to number", val.Type))
 	}
 }
 
-func builtinStringJoin(args []*Expr) *Expr {
-	if len(args) != 2 {
-		panic("string-join: expects 2 arguments (list, separator)")
-	}
-
+func builtinStringJoin(ctx context.Context, env *Env, args []*Expr) *Expr {
 	items := listToSlice(args[0])
 	sep := ""
 	if args[1].Type == String {
@@ -549,26 +466,21 @@ func builtinStringJoin(args []*Expr) *Expr {
 	}
 
 	parts := make([]string, len(items))
+	n := int64(len(sep) * max(len(items)-1, 0))
 	for i, item := range items {
 		if item.Type == String {
 			parts[i] = item.Str
 		} else {
 			parts[i] = printExpr(item)
 		}
+		n += int64(len(parts[i]))
 	}
+	env.evaluation().reserve(0, n)
 
 	return makeStr(strings.Join(parts, sep))
 }
 
 func builtinHtmlEscape(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("html-escape: expects 1 argument")
-	}
-
-	if args[0].Type != String {
-		panic("html-escape: argument must be a string")
-	}
-
 	escaped := html.EscapeString(args[0].Str)
 	return makeStr(escaped)
 }
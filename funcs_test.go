@@ -1,10 +1,9 @@
-package main
+package minilisp
 
 import "testing"
 
 func TestBuiltinAdd(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input string
@@ -32,8 +31,7 @@ func TestBuiltinAdd(t *testing.T) {
 }
 
 func TestBuiltinSub(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("-", makeBuiltin(builtinSub))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input string
@@ -56,8 +54,7 @@ func TestBuiltinSub(t *testing.T) {
 }
 
 func TestBuiltinMul(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("*", makeBuiltin(builtinMul))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input string
@@ -80,30 +77,48 @@ func TestBuiltinMul(t *testing.T) {
 }
 
 func TestBuiltinDiv(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("/", makeBuiltin(builtinDiv))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input string
-		want  int
+		want  string
 	}{
-		{"(/ 10 2)", 5},
-		{"(/ 100 10)", 10},
-		{"(/ 7 2)", 3}, // Integer division
+		{"(/ 10 2)", "5"},
+		{"(/ 100 10)", "10"},
+		{"(/ 7 2)", "7/2"}, // Exact division gives a rational
+		{"(/ 7.0 2)", "3.5"},
+		{"(/ 2)", "1/2"},
+		{"(/ 60 2 3)", "10"},
 	}
 
 	for _, tt := range tests {
 		expr := readStr(tt.input)
 		result := eval(expr, env)
-		if result.Num != tt.want {
-			t.Errorf("%s = %d, want %d", tt.input, result.Num, tt.want)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
 		}
 	}
 }
 
+func TestBuiltinDivByZero(t *testing.T) {
+	for _, input := range []string{"(/ 1 0)", "(/ 1.5 0.0)", "(/ 1/2 0)"} {
+		t.Run(input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", input)
+				}
+				if err := recoverError(r); err.Kind != ErrArith {
+					t.Errorf("%s kind = %s, want arithmetic-error", input, err.Kind)
+				}
+			}()
+			builtinDiv(listToSlice(readStr(input).Tail))
+		})
+	}
+}
+
 func TestBuiltinEq(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("=", makeBuiltin(builtinEq))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -128,8 +143,7 @@ func TestBuiltinEq(t *testing.T) {
 }
 
 func TestBuiltinNotEq(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("!=", makeBuiltin(builtinNotEq))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -155,8 +169,7 @@ func TestBuiltinNotEq(t *testing.T) {
 }
 
 func TestBuiltinLt(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("<", makeBuiltin(builtinLt))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -180,8 +193,7 @@ func TestBuiltinLt(t *testing.T) {
 	}
 }
 func TestBuiltinEqualOrLt(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("<=", makeBuiltin(builtinEqualOrLt))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -206,8 +218,7 @@ func TestBuiltinEqualOrLt(t *testing.T) {
 }
 
 func TestBuiltinGt(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define(">", makeBuiltin(builtinGt))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -231,8 +242,7 @@ func TestBuiltinGt(t *testing.T) {
 	}
 }
 func TestBuiltinEqualOrGt(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define(">=", makeBuiltin(builtinEqualOrGt))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -256,8 +266,7 @@ func TestBuiltinEqualOrGt(t *testing.T) {
 	}
 }
 func TestBuiltinPairs(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("pair", makeBuiltin(builtinPair))
+	env := setupFullEnv()
 
 	expr := readStr("(pair 1 2)")
 	result := eval(expr, env)
@@ -308,9 +317,7 @@ func TestBuiltinList(t *testing.T) {
 }
 
 func TestBuiltinHead(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("head", makeBuiltin(builtinHead))
-	env.Define("pair", makeBuiltin(builtinPair))
+	env := setupFullEnv()
 
 	expr := readStr("(head (pair 1 2))")
 	result := eval(expr, env)
@@ -321,9 +328,7 @@ func TestBuiltinHead(t *testing.T) {
 }
 
 func TestBuiltinTail(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("tail", makeBuiltin(builtinTail))
-	env.Define("pair", makeBuiltin(builtinPair))
+	env := setupFullEnv()
 
 	expr := readStr("(tail (pair 1 2))")
 	result := eval(expr, env)
@@ -334,8 +339,7 @@ func TestBuiltinTail(t *testing.T) {
 }
 
 func TestBuiltinNullP(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("null?", makeBuiltin(builtinNullP))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input    string
@@ -374,10 +378,7 @@ func TestEvalList(t *testing.T) {
 }
 
 func TestComplexArithmetic(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
-	env.Define("-", makeBuiltin(builtinSub))
+	env := setupFullEnv()
 
 	tests := []struct {
 		input string
@@ -403,7 +404,7 @@ func TestBuiltinHash(t *testing.T) {
 	if result.Type != Hash {
 		t.Errorf("builtinHash() type = %v, want Hash", result.Type)
 	}
-	if len(result.HashTable) != 0 {
+	if result.HashTable.Len() != 0 {
 		t.Errorf("empty hash should have 0 entries")
 	}
 
@@ -438,14 +439,14 @@ func TestBuiltinHashOddArgs(t *testing.T) {
 	builtinHash([]*Expr{makeStr("key")})
 }
 
-func TestBuiltinHashNonStringKey(t *testing.T) {
+func TestBuiltinHashUnhashableKey(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
-			t.Error("builtinHash with non-string key should panic")
+			t.Error("builtinHash with a list key should panic")
 		}
 	}()
 
-	builtinHash([]*Expr{makeNum(42), makeStr("value")})
+	builtinHash([]*Expr{list(makeNum(42)), makeStr("value")})
 }
 
 func TestBuiltinHashGet(t *testing.T) {
@@ -488,27 +489,27 @@ func TestBuiltinHashGetWrongArgs(t *testing.T) {
 					t.Errorf("hash-get with %s should panic", tt.name)
 				}
 			}()
-			builtinHashGet(tt.args)
+			callBuiltinNamed("hash-get", tt.args)
 		})
 	}
 }
 
-func TestBuiltinHashGetNonStringKey(t *testing.T) {
+func TestBuiltinHashGetUnhashableKey(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
-			t.Error("hash-get with non-string key should panic")
+			t.Error("hash-get with a list key should panic")
 		}
 	}()
 
 	hash := makeHash()
-	builtinHashGet([]*Expr{hash, makeNum(42)})
+	callBuiltinNamed("hash-get", []*Expr{hash, list(makeNum(42))})
 }
 
 func TestBuiltinHashSet(t *testing.T) {
 	hash := makeHash()
 
 	// Set new value
-	result := builtinHashSet([]*Expr{hash, makeStr("name"), makeStr("Alice")})
+	result := callBuiltinNamed("hash-set", []*Expr{hash, makeStr("name"), makeStr("Alice")})
 
 	// Should return the hash
 	if result != hash {
@@ -522,7 +523,7 @@ func TestBuiltinHashSet(t *testing.T) {
 	}
 
 	// Overwrite existing value
-	builtinHashSet([]*Expr{hash, makeStr("name"), makeStr("Bob")})
+	callBuiltinNamed("hash-set", []*Expr{hash, makeStr("name"), makeStr("Bob")})
 	val, _ = hashGet(hash, "name")
 	if val.Str != "Bob" {
 		t.Errorf("name should be overwritten to 'Bob', got %v", val.Str)
@@ -547,20 +548,20 @@ func TestBuiltinHashSetWrongArgs(t *testing.T) {
 					t.Errorf("hash-set with %s should panic", tt.name)
 				}
 			}()
-			builtinHashSet(tt.args)
+			callBuiltinNamed("hash-set", tt.args)
 		})
 	}
 }
 
-func TestBuiltinHashSetNonStringKey(t *testing.T) {
+func TestBuiltinHashSetUnhashableKey(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
-			t.Error("hash-set with non-string key should panic")
+			t.Error("hash-set with a list key should panic")
 		}
 	}()
 
 	hash := makeHash()
-	builtinHashSet([]*Expr{hash, makeNum(42), makeStr("value")})
+	callBuiltinNamed("hash-set", []*Expr{hash, list(makeNum(42)), makeStr("value")})
 }
 
 func TestBuiltinHashKeys(t *testing.T) {
@@ -625,7 +626,7 @@ func TestBuiltinHashKeysWrongArgs(t *testing.T) {
 					t.Errorf("hash-keys with %s should panic", tt.name)
 				}
 			}()
-			builtinHashKeys(tt.args)
+			callBuiltinNamed("hash-keys", tt.args)
 		})
 	}
 }
@@ -680,7 +681,7 @@ func TestHashMutation(t *testing.T) {
 
 	// Mutate multiple times
 	for i := 1; i <= 5; i++ {
-		builtinHashSet([]*Expr{hash, makeStr("count"), makeNum(i)})
+		callBuiltinNamed("hash-set", []*Expr{hash, makeStr("count"), makeNum(i)})
 	}
 
 	// Check final value
@@ -691,11 +692,7 @@ func TestHashMutation(t *testing.T) {
 }
 
 func TestHashFromLisp(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("hash", makeBuiltin(builtinHash))
-	env.Define("hash-get", makeBuiltin(builtinHashGet))
-	env.Define("hash-set", makeBuiltin(builtinHashSet))
-	env.Define("hash-keys", makeBuiltin(builtinHashKeys))
+	env := setupFullEnv()
 
 	// Create hash from Lisp
 	code := `(hash "name" "Alice" "age" 30)`
@@ -761,8 +758,8 @@ func TestJsonParseBoolFalse(t *testing.T) {
 	input := `false`
 	result := builtinJsonParse([]*Expr{makeStr(input)})
 
-	if result != nilExpr {
-		t.Error("false should parse to nilExpr")
+	if result != falseExpr {
+		t.Error("false should parse to falseExpr")
 	}
 }
 
@@ -889,8 +886,8 @@ func TestBuiltinNumberP(t *testing.T) {
 					t.Errorf("expected true for %s", tt.name)
 				}
 			} else {
-				if result != nilExpr {
-					t.Errorf("expected nil for %s", tt.name)
+				if result != falseExpr {
+					t.Errorf("expected false for %s", tt.name)
 				}
 			}
 		})
@@ -919,8 +916,8 @@ func TestBuiltinStringP(t *testing.T) {
 					t.Errorf("expected true for %s", tt.name)
 				}
 			} else {
-				if result != nilExpr {
-					t.Errorf("expected nil for %s", tt.name)
+				if result != falseExpr {
+					t.Errorf("expected false for %s", tt.name)
 				}
 			}
 		})
@@ -949,8 +946,8 @@ func TestBuiltinSymbolP(t *testing.T) {
 					t.Errorf("expected true for %s", tt.name)
 				}
 			} else {
-				if result != nilExpr {
-					t.Errorf("expected nil for %s", tt.name)
+				if result != falseExpr {
+					t.Errorf("expected false for %s", tt.name)
 				}
 			}
 		})
@@ -980,8 +977,8 @@ func TestBuiltinListP(t *testing.T) {
 					t.Errorf("expected true for %s", tt.name)
 				}
 			} else {
-				if result != nilExpr {
-					t.Errorf("expected nil for %s", tt.name)
+				if result != falseExpr {
+					t.Errorf("expected false for %s", tt.name)
 				}
 			}
 		})
@@ -995,7 +992,8 @@ func TestBuiltinBoolP(t *testing.T) {
 		want  bool
 	}{
 		{"true is bool", trueExpr, true},
-		{"nil is bool", nilExpr, true},
+		{"false is bool", falseExpr, true},
+		{"nil is not bool", nilExpr, false},
 		{"number is not bool", makeNum(42), false},
 		{"zero is not bool", makeNum(0), false},
 		{"string is not bool", makeStr("true"), false},
@@ -1011,8 +1009,8 @@ func TestBuiltinBoolP(t *testing.T) {
 					t.Errorf("expected true for %s", tt.name)
 				}
 			} else {
-				if result != nilExpr {
-					t.Errorf("expected nil for %s", tt.name)
+				if result != falseExpr {
+					t.Errorf("expected false for %s", tt.name)
 				}
 			}
 		})
@@ -1078,7 +1076,7 @@ func TestBuiltinToStringWrongArgs(t *testing.T) {
 					t.Errorf("@string with %s should panic", tt.name)
 				}
 			}()
-			builtinToString(tt.args)
+			callBuiltinNamed("@string", tt.args)
 		})
 	}
 }
@@ -1144,7 +1142,24 @@ func TestBuiltinToNumberWrongArgs(t *testing.T) {
 					t.Errorf("->number with %s should panic", tt.name)
 				}
 			}()
-			builtinToNumber(tt.args)
+			callBuiltinNamed("@number", tt.args)
 		})
 	}
 }
+
+func TestJsonBoolRoundTrip(t *testing.T) {
+	inputs := []string{
+		`false`,
+		`true`,
+		`[true,false,null]`,
+		`{"active":false}`,
+	}
+
+	for _, input := range inputs {
+		parsed := builtinJsonParse([]*Expr{makeStr(input)})
+		result := builtinJsonStringify([]*Expr{parsed})
+		if result.Str != input {
+			t.Errorf("round trip of %s = %s", input, result.Str)
+		}
+	}
+}
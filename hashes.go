@@ -0,0 +1,236 @@
+package minilisp
+
+import (
+	"context"
+	"math/big"
+)
+
+// Hashes map keys to values and remember the order keys were first added
+// in, so printing, hash-keys and json-stringify always come out the same.
+// Keys can be strings, numbers, symbols, keywords or booleans and compare
+// the way = does, so 1 and 1.0 are the same key.
+
+type HashTable struct {
+	index   map[string]int // hashKey of each key → position in entries
+	entries []hashEntry
+}
+
+type hashEntry struct {
+	Key *Expr
+	Val *Expr
+}
+
+func newHashTable() *HashTable {
+	return &HashTable{index: make(map[string]int)}
+}
+
+// The string a key is stored under, or false if it can't be a key.
+// Lists, vectors and hashes can change, so they can't be keys.
+func hashKey(key *Expr) (string, bool) {
+	switch key.Type {
+	case String:
+		return "s" + key.Str, true
+	case Symbol:
+		return "y" + key.Sym, true
+	case Keyword:
+		return "k" + key.Sym, true
+	case Bool:
+		return "b" + printExpr(key), true
+	case Number, BigInt, Rational:
+		return "n" + printExpr(key), true
+	case Float:
+		// Every finite float is exactly some rational, so it shares a key
+		// with the integer or rational it's = to
+		if r := new(big.Rat).SetFloat64(key.Float); r != nil {
+			return "n" + printExpr(makeRat(r)), true
+		}
+		return "f" + formatFloat(key.Float), true
+	default:
+		return "", false
+	}
+}
+
+// Panic with a type-error unless arg can be a hash key. i is the 0-based
+// index of the argument, reported 1-based.
+func checkHashKey(name string, i int, arg *Expr) string {
+	k, ok := hashKey(arg)
+	if !ok {
+		panic(argError(name, i, "a hash key", arg))
+	}
+	return k
+}
+
+func checkHash(name string, i int, arg *Expr) {
+	checkArg(name, i, hashArg, arg)
+}
+
+func (h *HashTable) Len() int {
+	return len(h.entries)
+}
+
+// Key value pairs in insertion order. Don't modify the result.
+func (h *HashTable) Entries() []hashEntry {
+	return h.entries
+}
+
+func (h *HashTable) Get(key *Expr) (*Expr, bool) {
+	k, ok := hashKey(key)
+	if !ok {
+		return nil, false
+	}
+	if i, ok := h.index[k]; ok {
+		return h.entries[i].Val, true
+	}
+	return nil, false
+}
+
+// Overwriting a key keeps its original position. Builtins check key with
+// checkHashKey first, so the error names them and the argument.
+func (h *HashTable) Set(key, val *Expr) {
+	k, ok := hashKey(key)
+	if !ok {
+		panic(errorf(ErrType, "", "can't use %s as a hash key", describeArg(key)))
+	}
+	if i, ok := h.index[k]; ok {
+		h.entries[i].Val = val
+		return
+	}
+	h.index[k] = len(h.entries)
+	h.entries = append(h.entries, hashEntry{key, val})
+}
+
+// Remove key, reporting whether it was there
+func (h *HashTable) Delete(key *Expr) bool {
+	k, ok := hashKey(key)
+	if !ok {
+		return false
+	}
+	i, ok := h.index[k]
+	if !ok {
+		return false
+	}
+	delete(h.index, k)
+	h.entries = append(h.entries[:i], h.entries[i+1:]...)
+	for j := i; j < len(h.entries); j++ {
+		k, _ := hashKey(h.entries[j].Key)
+		h.index[k] = j
+	}
+	return true
+}
+
+// Hashes are = when they have the same keys with = values, whatever
+// order the keys were added in
+func hashEq(a, b *Expr) bool {
+	if a.HashTable.Len() != b.HashTable.Len() {
+		return false
+	}
+	for _, e := range a.HashTable.Entries() {
+		v, ok := b.HashTable.Get(e.Key)
+		if !ok || !structuralEq(e.Val, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// (hash key value ...), also what {key value ...} reads as
+func builtinHash(args []*Expr) *Expr {
+	if len(args)%2 != 0 {
+		panic(errorf(ErrArity, "hash", "expect an even number of arguments"))
+	}
+
+	h := makeHash()
+	for i := 0; i < len(args); i += 2 {
+		checkHashKey("hash", i, args[i])
+		h.HashTable.Set(args[i], args[i+1])
+	}
+
+	return h
+}
+
+func builtinHashGet(args []*Expr) *Expr {
+	val, ok := args[0].HashTable.Get(args[1])
+	if !ok {
+		return nilExpr
+	}
+	return val
+}
+
+func builtinHashSet(ctx context.Context, env *Env, args []*Expr) *Expr {
+	growHash(env, args[0], args[1])
+	args[0].HashTable.Set(args[1], args[2])
+	return args[0]
+}
+
+// Count the entry setting key in h will add, if it isn't there already
+func growHash(env *Env, h, key *Expr) {
+	if _, ok := h.HashTable.Get(key); !ok {
+		env.evaluation().grow(h, 1, 0)
+	}
+}
+
+func builtinHashKeys(args []*Expr) *Expr {
+	return list(hashKeys(args[0])...)
+}
+
+func builtinHashValues(args []*Expr) *Expr {
+	var vals []*Expr
+	for _, e := range args[0].HashTable.Entries() {
+		vals = append(vals, e.Val)
+	}
+	return list(vals...)
+}
+
+func builtinHashHasP(args []*Expr) *Expr {
+	_, ok := args[0].HashTable.Get(args[1])
+	return makeBool(ok)
+}
+
+// (hash-delete h key) removes key if it's there and returns the hash
+func builtinHashDelete(args []*Expr) *Expr {
+	args[0].HashTable.Delete(args[1])
+	return args[0]
+}
+
+func builtinHashCount(args []*Expr) *Expr {
+	return makeNum(args[0].HashTable.Len())
+}
+
+// (hash-merge h1 h2 ...) returns a new hash, with later hashes winning
+// when they share a key
+func builtinHashMerge(args []*Expr) *Expr {
+	merged := makeHash()
+	for _, h := range args {
+		for _, e := range h.HashTable.Entries() {
+			merged.HashTable.Set(e.Key, e.Val)
+		}
+	}
+	return merged
+}
+
+// (hash-update h key f [default]) sets key to (f current), where current
+// is default (or nil) if key isn't there, and returns the hash
+func builtinHashUpdate(ctx context.Context, env *Env, args []*Expr) *Expr {
+	current, ok := args[0].HashTable.Get(args[1])
+	if !ok {
+		current = nilExpr
+		if len(args) == 4 {
+			current = args[3]
+		}
+	}
+	val := applyProc(env, args[2], []*Expr{current})
+	if !ok {
+		growHash(env, args[0], args[1])
+	}
+	args[0].HashTable.Set(args[1], val)
+	return args[0]
+}
+
+// List of (key value) lists, in insertion order
+func builtinHashToList(args []*Expr) *Expr {
+	var items []*Expr
+	for _, e := range args[0].HashTable.Entries() {
+		items = append(items, list(e.Key, e.Val))
+	}
+	return list(items...)
+}
@@ -0,0 +1,166 @@
+package minilisp
+
+import "testing"
+
+func TestHashes(t *testing.T) {
+	env := setupFullEnv()
+	env.Define("x", makeNum(5))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{}`, `{}`},
+		{`{"b" 1 "a" 2 "c" 3}`, `{"b" 1 "a" 2 "c" 3}`},
+		{`{"x" x "y" (+ x 1)}`, `{"x" 5 "y" 6}`},
+		{`(hash 1 "one" 'two 2 true "yes")`, `{1 "one" two 2 true "yes"}`},
+		{`(hash-get {1 "one"} 1)`, `"one"`},
+		{`(hash-get {1 "one"} 1.0)`, `"one"`},
+		{`(hash-get {1/2 "half"} 0.5)`, `"half"`},
+		{`(hash-get {1 "one"} "1")`, "nil"},
+		{`(hash-get {'a 1} 'a)`, "1"},
+		{`(hash-set {"a" 1 "b" 2} "a" 3)`, `{"a" 3 "b" 2}`},
+		{`(hash-keys {"z" 1 10 2 'm 3})`, `("z" 10 m)`},
+		{`(hash-values {"z" 1 10 2 'm 3})`, `(1 2 3)`},
+		{`(hash-keys {})`, "nil"},
+		{`(hash-has? {"a" nil} "a")`, "true"},
+		{`(hash-has? {"a" nil} "b")`, "false"},
+		{`(hash-delete {"a" 1 "b" 2 "c" 3} "b")`, `{"a" 1 "c" 3}`},
+		{`(hash-delete {"a" 1} "missing")`, `{"a" 1}`},
+		{`(hash-set (hash-delete {"a" 1 "b" 2} "a") "a" 3)`, `{"b" 2 "a" 3}`},
+		{`(hash-count {"a" 1 "b" 2})`, "2"},
+		{`(hash-count {})`, "0"},
+		{`(hash-merge {"a" 1 "b" 2} {"b" 3 "c" 4})`, `{"a" 1 "b" 3 "c" 4}`},
+		{`(hash-merge {"a" 1})`, `{"a" 1}`},
+		{`(hash-update {"n" 1} "n" (lambda (n) (+ n 1)))`, `{"n" 2}`},
+		{`(hash-update {} "n" (lambda (n) (+ n 1)) 0)`, `{"n" 1}`},
+		{`(hash-update {} "xs" list)`, `{"xs" (nil)}`},
+		{`(hash->list {"a" 1 'b 2})`, `(("a" 1) (b 2))`},
+		{`(= {"a" 1 "b" 2} {"b" 2 "a" 1})`, "true"},
+		{`(= {"a" 1} {"a" 2})`, "false"},
+		{`(= {"a" 1} {"a" 1 "b" 2})`, "false"},
+		{`(= {"a" {"b" (list 1)}} {"a" {"b" (list 1)}})`, "true"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestHashMergeCopies(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(define a {"x" 1})`), env)
+	eval(readStr(`(define b (hash-merge a))`), env)
+	eval(readStr(`(hash-set b "x" 2)`), env)
+
+	if got := printExpr(eval(readStr("a"), env)); got != `{"x" 1}` {
+		t.Errorf("a = %s after changing its merge, want {\"x\" 1}", got)
+	}
+}
+
+func TestHashLiteralDestructuring(t *testing.T) {
+	env := setupMacroTestEnv()
+	env.Define("hash", makeBuiltin(builtinHash))
+
+	result := eval(readStr(`(let (({"name" name 1 one} {"name" "Ada" 1 "first"})) (list name one))`), env)
+	if got := printExpr(result); got != `("Ada" "first")` {
+		t.Errorf("destructured = %s, want (\"Ada\" \"first\")", got)
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{`{(list 1) 2}`, ErrType},
+		{`{[1] 2}`, ErrType},
+		{`(hash-set {} {} 1)`, ErrType},
+		{`(hash-get (list 1) "a")`, ErrType},
+		{`(hash-count 1)`, ErrType},
+		{`(hash-merge)`, ErrArity},
+		{`(hash-merge {} 1)`, ErrType},
+		{`(hash-update {} "a")`, ErrArity},
+		{`(hash-update {} "a" 1)`, ErrType},
+		{`{"a"}`, ErrSyntax},
+		{`{"a" 1`, ErrSyntax},
+		{`}`, ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func TestHashKeyErrorsNameBuiltin(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`(hash-set {} [1] 1)`, "hash-set: argument 2 must be a hash key, got vector [1]"},
+		{`(hash-update {} [1] list)`, "hash-update: argument 2 must be a hash key, got vector [1]"},
+		{`(hash "a" 1 [1] 2)`, "hash: argument 3 must be a hash key, got vector [1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				if got := errorMessage(recoverError(recover())); got != tt.want {
+					t.Errorf("error = %q, want %q", got, tt.want)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func TestJsonKeepsKeyOrder(t *testing.T) {
+	inputs := []string{
+		`{"z":1,"a":2,"m":{"y":true,"b":null}}`,
+		`[{"b":1,"a":2},{}]`,
+	}
+
+	for _, input := range inputs {
+		parsed := builtinJsonParse([]*Expr{makeStr(input)})
+		result := builtinJsonStringify([]*Expr{parsed})
+		if result.Str != input {
+			t.Errorf("round trip of %s = %s", input, result.Str)
+		}
+	}
+
+	h := builtinHash([]*Expr{makeNum(1), makeStr("one"), makeSym("b"), makeNum(2)})
+	if got := builtinJsonStringify([]*Expr{h}).Str; got != `{"1":"one","b":2}` {
+		t.Errorf("json-stringify %s = %s", printExpr(h), got)
+	}
+}
+
+func TestJsonTrailingData(t *testing.T) {
+	for _, input := range []string{`{} x`, `[1] ]`, `1 2`, ``} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || recoverError(r).Kind != ErrJSON {
+					t.Errorf("@json %q = %v, want a json-error", input, r)
+				}
+			}()
+			builtinJsonParse([]*Expr{makeStr(input)})
+		}()
+	}
+}
@@ -0,0 +1,14 @@
+package minilisp
+
+// An interpreter's global environment with every builtin and defmacro,
+// but not the standard library
+func setupFullEnv(opts ...Option) *Env {
+	return New(append([]Option{WithoutStdlib()}, opts...)...).env
+}
+
+// Call a builtin the way Lisp code does, so its signature is checked
+func callBuiltinNamed(name string, args []*Expr) *Expr {
+	env := setupFullEnv()
+	fn, _ := env.Lookup(name)
+	return applyProc(env, fn, args)
+}
@@ -1,58 +1,93 @@
-package main
+package minilisp
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 )
 
-func builtinFetch(args []*Expr) *Expr {
-	if len(args) != 1 {
-		panic("fetch: expects 1 argument (url)")
-	}
-
+// (fetch url) is given up on when the evaluation is cancelled or times out
+func builtinFetch(ctx context.Context, env *Env, args []*Expr) *Expr {
 	url := args[0]
-	if url.Type != String {
-		panic("fetch: url must be a string")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.Str, nil)
+	if err != nil {
+		panic(errorf(ErrValue, "fetch", "bad url: %v", err))
 	}
-
-	resp, err := http.Get(url.Str)
+	in := env.interpreter()
+	in.checkFetch(req.URL)
+	resp, err := in.fetchClient().Do(req)
 	if err != nil {
-		panic(fmt.Sprintf("fetch: HTTP error: %v", err))
+		if ctx.Err() != nil {
+			env.evaluation().checkContext()
+		}
+		checkRedirectDenied(err)
+		panic(errorf(ErrIO, "fetch", "HTTP error: %v", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		panic(fmt.Sprintf("fetch: HTTP %d: %s", resp.StatusCode, resp.Status))
+		payload := makeHash()
+		hashSet(payload, "status", makeNum(resp.StatusCode))
+		hashSet(payload, "url", url)
+		panic(makeError(ErrHTTP, "fetch", fmt.Sprintf("HTTP %d: %s", resp.StatusCode, resp.Status), payload))
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		panic(fmt.Sprintf("fetch: error reading response: %v", err))
+		panic(errorf(ErrIO, "fetch", "error reading response: %v", err))
 	}
 
 	return makeStr(string(body))
 }
 
-func builtinHttpServer(args []*Expr) *Expr {
-	if len(args) != 2 {
-		panic("http-server: expects 2 arguments (port, handler)")
-	}
-
+// (http-server port handler) calls handler with a request hash for each
+// request and serves the hash it returns. It runs until the evaluation's
+// context is cancelled.
+func builtinHttpServer(ctx context.Context, env *Env, args []*Expr) *Expr {
 	port := args[0]
 	handler := args[1]
 
-	if port.Type != Number {
-		panic("http-server: port must be a number")
-	}
+	// Start server
+	addr := ":" + strconv.Itoa(port.Num)
+	fmt.Fprintf(env.interpreter().stdout, "Starting server on http://localhost%s\n", addr)
 
-	if handler.Type != Lambda {
-		panic("http-server: handler must be a lambda")
+	server := &http.Server{Addr: addr, Handler: lispHandler(env, handler)}
+	stop := context.AfterFunc(ctx, func() {
+		server.Close()
+	})
+	defer stop()
+
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		panic(errorf(ErrIO, "http-server", "%v", err))
 	}
 
-	// Create HTTP handler
-	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+	return nilExpr
+}
+
+// Serve requests by calling a Lisp handler with the request as a hash.
+// Each request is an evaluation of its own, with the interpreter's limits,
+// that stops if the client goes away.
+func lispHandler(env *Env, handler *Expr) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqEnv := NewEnv(env)
+		run, cancel := env.interpreter().newEvaluation(r.Context())
+		defer cancel()
+		reqEnv.run = run
+
+		// An uncaught Lisp error becomes a 500 rather than killing the connection
+		defer func() {
+			if rec := recover(); rec != nil {
+				err := recoverError(rec)
+				err.Trace = append(err.Trace, "http-server")
+				fmt.Fprintln(env.interpreter().stderr, formatError(err))
+				http.Error(w, errorMessage(err), http.StatusInternalServerError)
+			}
+		}()
+
 		// Build request hash for Lisp
 		reqHash := makeHash()
 		hashSet(reqHash, "method", makeStr(r.Method))
@@ -60,8 +95,9 @@ func builtinHttpServer(args []*Expr) *Expr {
 
 		// Parse query parameters
 		queryHash := makeHash()
-		for key, values := range r.URL.Query() {
-			if len(values) > 0 {
+		query := r.URL.Query()
+		for _, key := range sortedKeys(query) {
+			if values := query[key]; len(values) > 0 {
 				hashSet(queryHash, key, makeStr(values[0]))
 			}
 		}
@@ -69,8 +105,8 @@ func builtinHttpServer(args []*Expr) *Expr {
 
 		// Parse headers
 		headersHash := makeHash()
-		for key, values := range r.Header {
-			if len(values) > 0 {
+		for _, key := range sortedKeys(r.Header) {
+			if values := r.Header[key]; len(values) > 0 {
 				hashSet(headersHash, key, makeStr(values[0]))
 			}
 		}
@@ -80,32 +116,25 @@ func builtinHttpServer(args []*Expr) *Expr {
 		body, _ := io.ReadAll(r.Body)
 		hashSet(reqHash, "body", makeStr(string(body)))
 
-		// Call Lisp handler
-		newEnv := NewEnv(handler.Env)
-		params := handler.Params
-		if params != nilExpr && params.Head != nil {
-			newEnv.Define(params.Head.Sym, reqHash)
-		}
-
-		response := eval(handler.Body, newEnv)
+		response := applyProc(reqEnv, handler, []*Expr{reqHash})
 
 		// Extract response fields
 		if response.Type != Hash {
-			panic("http-server: handler must return hash")
+			panic(errorf(ErrType, "http-server", "handler must return hash"))
 		}
 
 		// Get status (default 200)
 		status := 200
-		if statusExpr, ok := hashGet(response, "status"); ok {
+		if statusExpr, ok := responseField(response, "status"); ok {
 			status = statusExpr.Num
 		}
 
 		// Get headers (default empty)
-		if headersExpr, ok := hashGet(response, "headers"); ok {
+		if headersExpr, ok := responseField(response, "headers"); ok {
 			if headersExpr.Type == Hash {
-				for key, val := range headersExpr.HashTable {
-					if val.Type == String {
-						w.Header().Set(key, val.Str)
+				for _, e := range headersExpr.HashTable.Entries() {
+					if (e.Key.Type == String || e.Key.Type == Keyword) && e.Val.Type == String {
+						w.Header().Set(jsonKey(e.Key), e.Val.Str)
 					}
 				}
 			}
@@ -113,7 +142,7 @@ func builtinHttpServer(args []*Expr) *Expr {
 
 		// Get body (default empty string)
 		bodyStr := ""
-		if bodyExpr, ok := hashGet(response, "body"); ok {
+		if bodyExpr, ok := responseField(response, "body"); ok {
 			if bodyExpr.Type == String {
 				bodyStr = bodyExpr.Str
 			}
@@ -123,15 +152,23 @@ func builtinHttpServer(args []*Expr) *Expr {
 		w.WriteHeader(status)
 		w.Write([]byte(bodyStr))
 	}
+}
 
-	// Start server
-	addr := ":" + strconv.Itoa(port.Num)
-	fmt.Printf("Starting server on http://localhost%s\n", addr)
-
-	err := http.ListenAndServe(addr, http.HandlerFunc(httpHandler))
-	if err != nil {
-		panic(fmt.Sprintf("http-server: %v", err))
+// Query parameters and headers go into hashes in sorted order, so the
+// request hash is the same however Go's maps iterate
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	return nilExpr
+// Handlers can use :status or "status" style keys in their response
+func responseField(response *Expr, name string) (*Expr, bool) {
+	if val, ok := response.HashTable.Get(makeKeyword(name)); ok {
+		return val, true
+	}
+	return hashGet(response, name)
 }
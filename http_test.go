@@ -1,9 +1,14 @@
-package main
+package minilisp
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestBuiltinFetch(t *testing.T) {
@@ -16,7 +21,7 @@ func TestBuiltinFetch(t *testing.T) {
 
 	// Call fetch
 	args := []*Expr{makeStr(server.URL)}
-	result := builtinFetch(args)
+	result := builtinFetch(context.Background(), NewEnv(nil), args)
 
 	if result.Type != String {
 		t.Errorf("fetch should return String, got %v", result.Type)
@@ -35,7 +40,7 @@ func TestBuiltinFetchJSON(t *testing.T) {
 	defer server.Close()
 
 	args := []*Expr{makeStr(server.URL)}
-	result := builtinFetch(args)
+	result := builtinFetch(context.Background(), NewEnv(nil), args)
 
 	expected := `{"name":"Alice","age":30}`
 	if result.Str != expected {
@@ -57,5 +62,78 @@ func TestBuiltinFetchNotFound(t *testing.T) {
 	}()
 
 	args := []*Expr{makeStr(server.URL)}
-	builtinFetch(args)
+	builtinFetch(context.Background(), NewEnv(nil), args)
+}
+
+func TestLispHandler(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		handler string
+		status  int
+		body    string
+	}{
+		{`(lambda (req) {:status 201 :body (:path req)})`, 201, "/users"},
+		{`(lambda ({"method" method}) {:body method})`, 200, "GET"},
+		// Handlers are called like any other function, so &rest works
+		{`(lambda (&rest args) {:body (:path (head args))})`, 200, "/users"},
+		{`(lambda (req) "not a hash")`, 500, "http-server: handler must return hash\n"},
+		{`(lambda (a b) {})`, 500, "not enough arguments\n"},
+	}
+
+	for _, tt := range tests {
+		handler := eval(readStr(tt.handler), env)
+		w := httptest.NewRecorder()
+		lispHandler(env, handler)(w, httptest.NewRequest("GET", "/users", nil))
+
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s responded %d %q, want %d %q", tt.handler, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestHttpServerStopsWhenCancelled(t *testing.T) {
+	// Find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	env := setupFullEnv()
+	handler := eval(readStr(`(lambda (req) {:body "up"})`), env)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan *Expr)
+	go func() {
+		done <- builtinHttpServer(ctx, env, []*Expr{makeNum(port), handler})
+	}()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/", port)
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server never came up: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "up" {
+		t.Errorf("body = %q, want up", body)
+	}
+
+	cancel()
+	select {
+	case result := <-done:
+		if result != nilExpr {
+			t.Errorf("http-server returned %s, want nil", printExpr(result))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("http-server didn't stop when its context was cancelled")
+	}
 }
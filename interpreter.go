@@ -0,0 +1,81 @@
+package minilisp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// An interpreter is a global environment plus everything evaluating in it
+// needs: where output goes, the builtins it was given, the modules it has
+// loaded and its configuration. None of it is shared, so a program can run
+// as many interpreters side by side as it likes.
+//
+// Every global environment has one; NewEnv(nil) makes a bare one with no
+// builtins, and New fills it in.
+type Interpreter struct {
+	env      *Env
+	builtins map[string]*Expr // builtins and Go functions defined in env, for :help
+
+	stdout    io.Writer // print, and the REPL
+	stderr    io.Writer // warnings, and errors in http handlers
+	colour    bool      // colour values printed by the REPL
+	noStdlib  bool
+	stdlibDir string   // read std: files from here rather than the built in copy
+	limits    Limits   // for each evaluation
+	sandbox   *Sandbox // nil if scripts can do anything
+	backend   Backend  // what runs the code
+
+	mu      sync.Mutex
+	modules map[string]*Module // loaded modules by path
+	warned  map[string]bool    // shadowing warnings already given
+	gensyms atomic.Int64
+}
+
+func newInterpreter(env *Env) *Interpreter {
+	return &Interpreter{
+		env:      env,
+		builtins: map[string]*Expr{},
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		colour:   os.Getenv("NO_COLOR") == "",
+		modules:  map[string]*Module{},
+		warned:   map[string]bool{},
+	}
+}
+
+// Names of the builtins this interpreter has, sorted
+func (in *Interpreter) builtinNames() []string {
+	names := make([]string, 0, len(in.builtins))
+	for name := range in.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A fresh symbol, e.g. tmp#12. The reader rejects # in names, so only
+// gensym makes names like this.
+func (in *Interpreter) gensym(prefix string) *Expr {
+	return makeSym(fmt.Sprintf("%s#%d", prefix, in.gensyms.Add(1)))
+}
+
+// Warn that a define inside a body hides an outer binding, which is
+// usually a set! gone wrong. Each define form only warns once.
+func (in *Interpreter) warnShadow(form *Expr, name string) {
+	loc := ""
+	if form.Pos != nil {
+		loc = form.Pos.String() + ": "
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.warned[loc+name] {
+		return
+	}
+	in.warned[loc+name] = true
+	fmt.Fprintf(in.stderr, "warning: %sdefine of %s shadows an outer binding, use set! to change it\n", loc, name)
+}
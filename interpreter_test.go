@@ -0,0 +1,96 @@
+package minilisp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestInterpretersAreIsolated(t *testing.T) {
+	var outA, outB strings.Builder
+	a := New(WithoutStdlib(), WithStdout(&outA))
+	b := New(WithoutStdlib(), WithStdout(&outB))
+	ctx := context.Background()
+
+	a.Eval(ctx, `(define x "a") (print x)`)
+	b.Eval(ctx, `(define x "b") (print x)`)
+
+	if outA.String() != "\"a\"\n" || outB.String() != "\"b\"\n" {
+		t.Errorf("outputs = %q and %q", outA.String(), outB.String())
+	}
+
+	// Redefining a builtin in one doesn't touch the other
+	a.Eval(ctx, `(define + -)`)
+	if got, _ := b.Eval(ctx, "(+ 2 1)"); got != 3 {
+		t.Errorf("(+ 2 1) in b = %v, want 3", got)
+	}
+
+	// Each counts its own gensyms
+	if got, _ := b.Eval(ctx, "(gensym)"); got != "g#1" {
+		t.Errorf("first gensym in b = %v, want g#1", got)
+	}
+}
+
+func TestInterpretersRunConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	outs := make([]strings.Builder, 8)
+	for i := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			interp := New(WithStdout(&outs[i]))
+			interp.Define("id", i)
+			interp.Eval(context.Background(), `
+(define loop (lambda (n acc) (if (= n 0) acc (loop (- n 1) (+ acc id)))))
+(print (loop 1000 0))
+(print (-> id (* 2)))`)
+		}()
+	}
+	wg.Wait()
+
+	for i := range outs {
+		if want := fmt.Sprintf("%d\n%d\n", 1000*i, 2*i); outs[i].String() != want {
+			t.Errorf("interpreter %d printed %q, want %q", i, outs[i].String(), want)
+		}
+	}
+}
+
+func TestWarningsGoToStderr(t *testing.T) {
+	var stderr strings.Builder
+	interp := New(WithoutStdlib(), WithStderr(&stderr))
+	interp.Eval(context.Background(), "(define x 1) ((lambda () (define x 2) x))")
+
+	if !strings.Contains(stderr.String(), "define of x shadows an outer binding") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestGoFuncsAreListedAsBuiltins(t *testing.T) {
+	interp := New(WithoutStdlib())
+	interp.Define("double", func(args ...any) (any, error) { return args[0].(int) * 2, nil })
+
+	names := interp.builtinNames()
+	found := false
+	for _, name := range names {
+		found = found || name == "double"
+	}
+	if !found || len(names) != len(builtinDefs)+1 {
+		t.Errorf("builtins = %v, want the registry plus double", names)
+	}
+	if got, _ := interp.Eval(context.Background(), "(double 4)"); got != 8 {
+		t.Errorf("(double 4) = %v, want 8", got)
+	}
+}
+
+func TestColourOption(t *testing.T) {
+	plain := New(WithoutStdlib(), WithColour(false))
+	if got := plain.printExprColoured(makeNum(1)); got != "1" {
+		t.Errorf("without colour = %q", got)
+	}
+	coloured := New(WithoutStdlib(), WithColour(true))
+	if got := coloured.printExprColoured(makeNum(1)); got != colourCyan+"1"+colourReset {
+		t.Errorf("with colour = %q", got)
+	}
+}
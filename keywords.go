@@ -0,0 +1,60 @@
+package minilisp
+
+// Keywords like :name evaluate to themselves, so they make tidy hash keys.
+// Calling one looks it up in a hash, falling back to the string key with
+// the same name so it works on hashes from JSON too:
+//
+//	(:name {:name "Ada"})           → "Ada"
+//	(:login (@json text))           → the "login" field
+//	(:missing {} "default")         → "default"
+func keywordGet(kw *Expr, args []*Expr) *Expr {
+	name := ":" + kw.Sym
+	if len(args) != 1 && len(args) != 2 {
+		panic(errorf(ErrArity, name, "expects 1 or 2 arguments (hash, default)"))
+	}
+
+	missing := nilExpr
+	if len(args) == 2 {
+		missing = args[1]
+	}
+
+	h := args[0]
+	if h == nilExpr {
+		return missing
+	}
+	if h.Type == Object {
+		if field, ok := findField(h.Obj.Elem(), kw.Sym); ok {
+			return lispValue(name, field)
+		}
+		if len(args) == 2 {
+			return missing
+		}
+		panic(noSuchField(name, h, kw.Sym))
+	}
+	checkHash(name, 0, h)
+
+	if val, ok := h.HashTable.Get(kw); ok {
+		return val
+	}
+	if val, ok := h.HashTable.Get(makeStr(kw.Sym)); ok {
+		return val
+	}
+	return missing
+}
+
+// (keyword "name") or (keyword 'name) → :name
+func builtinKeyword(args []*Expr) *Expr {
+	switch args[0].Type {
+	case String, Symbol, Keyword:
+		name := args[0].Str
+		if args[0].Type != String {
+			name = args[0].Sym
+		}
+		if name == "" {
+			panic(errorf(ErrValue, "keyword", "name can't be empty"))
+		}
+		return makeKeyword(name)
+	default:
+		panic(errorf(ErrType, "keyword", "argument must be a string or symbol"))
+	}
+}
@@ -0,0 +1,153 @@
+package minilisp
+
+import "testing"
+
+func TestKeywords(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{":status", ":status"},
+		{"(list :a :b)", "(:a :b)"},
+		{"':a", ":a"},
+		{"(keyword? :a)", "true"},
+		{"(keyword? 'a)", "false"},
+		{"(symbol? :a)", "false"},
+		{"(= :a :a)", "true"},
+		{"(= :a 'a)", "false"},
+		{`(= :a "a")`, "false"},
+		{`(keyword "path")`, ":path"},
+		{`(keyword 'path)`, ":path"},
+		{`(@string :path)`, `"path"`},
+		{`{:status 200 :body "ok"}`, `{:status 200 :body "ok"}`},
+		{`(hash-get {:a 1} :a)`, "1"},
+		{`(hash-get {:a 1} "a")`, "nil"},
+		{`(hash-get {"a" 1} :a)`, "nil"},
+		{`(hash-keys {:a 1 "a" 2 'a 3})`, `(:a "a" a)`},
+		// Calling a keyword looks it up
+		{`(:path {:path "/home"})`, `"/home"`},
+		{`(:path {"path" "/home"})`, `"/home"`},
+		{`(:a {:a 1 "a" 2})`, "1"},
+		{`(:missing {:a 1})`, "nil"},
+		{`(:missing {:a 1} "default")`, `"default"`},
+		{`(:a nil)`, "nil"},
+		{`(:b (:a {:a {:b 2}}))`, "2"},
+		{`(hash-update {:n 1} :n (lambda (n) (+ n 1)))`, `{:n 2}`},
+		{`(hash-update {:user {:name "Ada"}} :user :name)`, `{:user "Ada"}`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordsThroughJson(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`(json-stringify {:status 200 :tags (list :a "b")})`, `"{\"status\":200,\"tags\":[\"a\",\"b\"]}"`},
+		{`(@json "{\"status\": 200}")`, `{"status" 200}`},
+		{`(:login (@json "{\"login\": \"ada\"}"))`, `"ada"`},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordDestructuring(t *testing.T) {
+	env := setupMacroTestEnv()
+	env.Define("hash", makeBuiltin(builtinHash))
+
+	result := eval(readStr(`(let (({:name name :age age} {"name" "Ada" :age 36})) (list name age))`), env)
+	if got := printExpr(result); got != `("Ada" 36)` {
+		t.Errorf("destructured = %s, want (\"Ada\" 36)", got)
+	}
+}
+
+func TestResultUsesKeywords(t *testing.T) {
+	env := setupFullEnv()
+	env.Define("hash", makeBuiltin(builtinHash))
+	eval(readStr(`(load "std/result.lisp")`), env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(ok 42)", "{:type :ok :value 42}"},
+		{"(ok? (ok 42))", "true"},
+		{`(err? (err "failed"))`, "true"},
+		{"(unwrap (ok 42))", "42"},
+		{`(unwrap-err (err "failed"))`, `"failed"`},
+		{`(unwrap-or (err "failed") 0)`, "0"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordErrors(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{`(:a (list 1))`, ErrType},
+		{`(:a)`, ErrArity},
+		{`(:a {} 1 2)`, ErrArity},
+		{`(keyword "")`, ErrValue},
+		{`(keyword 1)`, ErrType},
+		{`(define :a 1)`, ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func TestREPLCommandsAndKeywords(t *testing.T) {
+	tests := []struct {
+		line    string
+		command bool
+	}{
+		{":help", true},
+		{":q", true},
+		{":env  ", true},
+		{":status", false},
+		{":helpful", false},
+		{"(:path req)", false},
+	}
+
+	for _, tt := range tests {
+		if got := isREPLCommand(tt.line); got != tt.command {
+			t.Errorf("isREPLCommand(%q) = %v, want %v", tt.line, got, tt.command)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package minilisp
+
+// Wrap a list of body expressions in a begin, unless there's only one
+func implicitBegin(body *Expr) *Expr {
+	if body == nilExpr {
+		return nilExpr
+	}
+	if body.Tail == nilExpr {
+		return body.Head
+	}
+	return pair(makeSym("begin"), body)
+}
+
+// let, let*, letrec and named let. Returns the body and the environment
+// to evaluate it in, so eval can run the body as a tail call.
+//
+//	(let ((x 1) (y 2)) body...)      inits see the outer scope only
+//	(let* ((x 1) (y x)) body...)     each init sees the bindings before it
+//	(letrec ((f (lambda ...))) ...)  inits see all the bindings
+//	(let loop ((i 0)) body...)       binds loop to a lambda over the body
+//	                                 and calls it with the inits
+func evalLet(kind string, args *Expr, env *Env) (*Expr, *Env) {
+	if args == nilExpr {
+		panic(errorf(ErrSyntax, kind, "expects bindings and a body"))
+	}
+
+	if kind == "let" && args.Head.Type == Symbol {
+		return evalNamedLet(args, env)
+	}
+
+	bindings := letBindings(kind, args.Head)
+	body := implicitBegin(args.Tail)
+
+	switch kind {
+	case "let":
+		vals := make([]*Expr, len(bindings))
+		for i, b := range bindings {
+			vals[i] = eval(b.Tail.Head, env)
+		}
+		newEnv := NewEnv(env)
+		for i, b := range bindings {
+			bindPattern(newEnv, b.Head, vals[i], kind)
+		}
+		return body, newEnv
+	case "let*":
+		// A new scope per binding, so closures made in an init only see
+		// the bindings before it
+		newEnv := NewEnv(env)
+		for _, b := range bindings {
+			val := eval(b.Tail.Head, newEnv)
+			newEnv = NewEnv(newEnv)
+			bindPattern(newEnv, b.Head, val, kind)
+		}
+		return body, newEnv
+	default:
+		newEnv := NewEnv(env)
+		for _, b := range bindings {
+			bindPattern(newEnv, b.Head, eval(b.Tail.Head, newEnv), kind)
+		}
+		return body, newEnv
+	}
+}
+
+func evalNamedLet(args *Expr, env *Env) (*Expr, *Env) {
+	name := args.Head
+	if args.Tail == nilExpr {
+		panic(errorf(ErrSyntax, "let", "named let expects bindings and a body"))
+	}
+	bindings := letBindings("let", args.Tail.Head)
+
+	var params []*Expr
+	vals := make([]*Expr, len(bindings))
+	for i, b := range bindings {
+		params = append(params, b.Head)
+		vals[i] = eval(b.Tail.Head, env)
+	}
+
+	// The loop lambda can see itself, but the inits can't see it
+	loopEnv := NewEnv(env)
+	loop := makeLambda(list(params...), implicitBegin(args.Tail.Tail), loopEnv, Lambda)
+	loop.Name = name.Sym
+	loopEnv.Define(name.Sym, loop)
+
+	return loop.Body, bindParams(env, loop, vals)
+}
+
+// Check a binding list looks like ((pattern init) ...) and return its
+// bindings
+func letBindings(kind string, bindings *Expr) []*Expr {
+	if bindings != nilExpr && bindings.Type != Pair {
+		panic(errorf(ErrSyntax, kind, "bindings must be a list like ((name value) ...)"))
+	}
+
+	items := listToSlice(bindings)
+	for _, b := range items {
+		if b.Type != Pair || b.Tail.Type != Pair || b.Tail.Tail != nilExpr {
+			panic(errorf(ErrSyntax, kind, "each binding must look like (name value), got %s", printExpr(b)))
+		}
+	}
+	return items
+}
+
+// Bind val to a pattern in env. A pattern is a symbol, _ to ignore the
+// value, a list of patterns (with &rest for the remaining elements) or
+// (hash "key" pattern ...), or {"key" pattern ...}, to pull values out of
+// a hash by key.
+//
+//	(let (((a b &rest more) (list 1 2 3 4))
+//	      ((hash "name" name "age" age) user))
+//	  ...)
+func bindPattern(env *Env, pat, val *Expr, origin string) {
+	switch {
+	case pat.Type == Symbol:
+		if pat.Sym != "_" {
+			env.Define(pat.Sym, val)
+		}
+	case pat.Type == Pair && pat.Head.Type == Symbol && pat.Head.Sym == "hash":
+		bindHashPattern(env, pat.Tail, val, origin)
+	case pat.Type == Pair || pat == nilExpr:
+		bindListPattern(env, pat, val, origin)
+	default:
+		panic(errorf(ErrSyntax, origin, "cannot bind to %s", printExpr(pat)))
+	}
+}
+
+func bindListPattern(env *Env, pat, val *Expr, origin string) {
+	whole := val
+	for pat != nilExpr {
+		if pat.Head.Type == Symbol && pat.Head.Sym == "&rest" {
+			if pat.Tail == nilExpr {
+				panic(errorf(ErrSyntax, origin, "&rest requires a parameter name"))
+			}
+			bindPattern(env, pat.Tail.Head, val, origin)
+			return
+		}
+
+		if val.Type != Pair {
+			if val == nilExpr {
+				panic(errorf(ErrValue, origin, "not enough elements in %s to match %s", printExpr(whole), printExpr(pat)))
+			}
+			panic(errorf(ErrType, origin, "cannot destructure %s as a list", printExpr(whole)))
+		}
+		bindPattern(env, pat.Head, val.Head, origin)
+		pat, val = pat.Tail, val.Tail
+	}
+
+	if val != nilExpr {
+		panic(errorf(ErrValue, origin, "too many elements in %s", printExpr(whole)))
+	}
+}
+
+func bindHashPattern(env *Env, pat, val *Expr, origin string) {
+	if val.Type != Hash {
+		panic(errorf(ErrType, origin, "cannot destructure %s as a hash", printExpr(val)))
+	}
+
+	for ; pat != nilExpr; pat = pat.Tail.Tail {
+		key := pat.Head
+		if _, ok := hashKey(key); !ok || pat.Tail == nilExpr {
+			panic(errorf(ErrSyntax, origin, "hash patterns look like (hash \"key\" pattern ...)"))
+		}
+		// Missing keys bind nil, like hash-get. Keywords find string keys
+		// too, like calling the keyword would.
+		v, ok := val.HashTable.Get(key)
+		if !ok && key.Type == Keyword {
+			v, ok = val.HashTable.Get(makeStr(key.Sym))
+		}
+		if !ok {
+			v = nilExpr
+		}
+		bindPattern(env, pat.Tail.Head, v, origin)
+	}
+}
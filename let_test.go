@@ -0,0 +1,178 @@
+package minilisp
+
+import "testing"
+
+// Run on both backends, see runOnBackends
+func TestLet(t *testing.T) {
+	runOnBackends(t, []backendTest{
+		{"LetForms", testLetForms},
+		{"LetDoesNotLeakBindings", testLetDoesNotLeakBindings},
+		{"NamedLetTailCalls", testNamedLetTailCalls},
+		{"LetClosures", testLetClosures},
+		{"Destructuring", testDestructuring},
+		{"LetErrors", testLetErrors},
+		{"SyntaxRulesRenamesLetBindings", testSyntaxRulesRenamesLetBindings},
+		{"HtmlAttrsDoNotLeak", testHtmlAttrsDoNotLeak},
+	})
+}
+
+func testLetForms(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	env.Define("x", makeNum(10))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(let ((a 1) (b 2)) (+ a b))", "3"},
+		{"(let () 42)", "42"},
+		{"(let ((a 1)))", "nil"},
+		{"(let ((a 1)) (define b 2) (+ a b))", "3"},
+		// let inits see the outer x, let* inits see earlier bindings
+		{"(let ((x 1) (y x)) y)", "10"},
+		{"(let* ((x 1) (y x)) y)", "1"},
+		{"(let* ((x (+ x 1)) (x (* x 2))) x)", "22"},
+		{"(letrec ((even? (lambda (n) (if (= n 0) true (odd? (- n 1)))))" +
+			"          (odd? (lambda (n) (if (= n 0) nil (even? (- n 1))))))" +
+			"  (even? 100))", "true"},
+		{"(let loop ((i 0) (acc nil)) (if (= i 3) acc (loop (+ i 1) (pair i acc))))", "(2 1 0)"},
+		{"(let loop ((i 5)) (if (= i 0) 'done (loop (- i 1))))", "done"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testLetDoesNotLeakBindings(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	eval(readStr("(let ((leaked 1)) (define inner 2) leaked)"), env)
+	eval(readStr("(let* ((a 1) (b 2)) b)"), env)
+	eval(readStr("(let loop ((i 0)) (if (< i 3) (loop (+ i 1)) i))"), env)
+
+	for _, name := range []string{"leaked", "inner", "a", "b", "i", "loop"} {
+		if _, ok := env.Lookup(name); ok {
+			t.Errorf("%s should not be defined outside the let", name)
+		}
+	}
+}
+
+func testNamedLetTailCalls(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	result := eval(readStr("(let loop ((i 0)) (if (= i 1000000) i (loop (+ i 1))))"), env)
+	if result.Num != 1000000 {
+		t.Errorf("named let loop = %s, want 1000000", printExpr(result))
+	}
+}
+
+func testLetClosures(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	eval(readStr("(define make-adder (lambda (n) (let ((k n)) (lambda (x) (+ x k)))))"), env)
+	eval(readStr("(define add5 (make-adder 5))"), env)
+	eval(readStr("(define add7 (make-adder 7))"), env)
+
+	if got := eval(readStr("(list (add5 1) (add7 1))"), env); printExpr(got) != "(6 8)" {
+		t.Errorf("closures over let = %s, want (6 8)", printExpr(got))
+	}
+}
+
+func testDestructuring(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	eval(readStr(`(define user (hash "name" "Ada" "langs" (list "lisp" "go")))`), env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(let (((a b) (list 1 2))) (+ a b))", "3"},
+		{"(let (((a (b c)) (list 1 (list 2 3)))) (list a b c))", "(1 2 3)"},
+		{"(let (((a &rest more) (list 1 2 3))) more)", "(2 3)"},
+		{"(let (((_ b _) (list 1 2 3))) b)", "2"},
+		{`(let (((hash "name" n) user)) n)`, `"Ada"`},
+		{`(let (((hash "langs" (first second)) user)) second)`, `"go"`},
+		{`(let (((hash "missing" m) user)) m)`, "nil"},
+		{`(let* (((hash "langs" langs) user) ((first &rest _) langs)) first)`, `"lisp"`},
+		{"((lambda ((a b) c) (list a b c)) (list 1 2) 3)", "(1 2 3)"},
+		{`((lambda ((hash "name" n)) n) user)`, `"Ada"`},
+		{"(let loop (((a b) (list 1 2))) (+ a b))", "3"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testLetErrors(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{"(let)", ErrSyntax},
+		{"(let (a 1) a)", ErrSyntax},
+		{"(let ((a)) a)", ErrSyntax},
+		{"(let ((42 1)) 1)", ErrSyntax},
+		{"(let (((a b) (list 1))) a)", ErrValue},
+		{"(let (((a) (list 1 2))) a)", ErrValue},
+		{"(let (((a b) 5)) a)", ErrType},
+		{`(let (((hash "a" a) (list 1))) a)`, ErrType},
+		{`(let (((hash a) (hash))) a)`, ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func testSyntaxRulesRenamesLetBindings(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	code := `(define-syntax my-or
+		(syntax-rules ()
+			((_) nil)
+			((_ e rest ...) (let ((t e)) (if t t (my-or rest ...))))))`
+	eval(readStr(code), env)
+	eval(readStr("(define t 7)"), env)
+
+	result := eval(readStr("(my-or nil t)"), env)
+	if result.Num != 7 {
+		t.Errorf("(my-or nil t) = %s, want 7", printExpr(result))
+	}
+}
+
+func testHtmlAttrsDoNotLeak(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	eval(readStr(`(load "std/html.lisp")`), env)
+
+	result := eval(readStr(`(html-element "a" (hash "href" "/x") "link")`), env)
+	if result.Str != `<a href=/x>link</a>` {
+		t.Errorf("html-element = %q", result.Str)
+	}
+
+	for _, name := range []string{"keys", "pairs", "attr-str", "open-tag"} {
+		if _, ok := env.Lookup(name); ok {
+			t.Errorf("%s leaked into the global environment", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package minilisp
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Limits bound how much one evaluation can do, so a runaway program gets
+// stopped with a limit-error rather than hanging or crashing the process.
+// An evaluation is one call to Eval, Run or Call, a line typed at the REPL
+// or one request to an http-server handler. Zero means no limit.
+type Limits struct {
+	Steps   int64         // forms evaluated, or calls made on the VM
+	Depth   int           // evaluations nested inside each other, DefaultDepth if zero
+	Conses  int64         // pairs, vector slots and hash entries made by builtins
+	Strings int64         // bytes of strings made by builtins
+	Timeout time.Duration // wall time
+}
+
+// Go's stack would overflow somewhere past this, and that can't be
+// recovered from, so depth is always limited
+const DefaultDepth = 10000
+
+// Steps between checks of the context
+const checkEvery = 1024
+
+// WithLimits limits every evaluation in the interpreter
+func WithLimits(limits Limits) Option {
+	return func(in *Interpreter) { in.limits = limits }
+}
+
+// An evaluation in progress: the context it runs in, its limits and what
+// it has used so far. It belongs to one goroutine.
+type evaluation struct {
+	ctx     context.Context
+	limits  Limits
+	backend Backend
+	steps   int64
+	depth   int
+	conses  int64
+	strings int64
+
+	compiled  map[*Expr]compiledForm // see compileForm
+	importing *Module                // a module it's waiting for another evaluation to load
+}
+
+// Start an evaluation in ctx with the interpreter's limits. cancel stops
+// the timer of a Timeout.
+func (in *Interpreter) newEvaluation(ctx context.Context) (run *evaluation, cancel context.CancelFunc) {
+	cancel = func() {}
+	if in.limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, in.limits.Timeout)
+	}
+	return &evaluation{ctx: ctx, limits: in.limits, backend: in.backend}, cancel
+}
+
+// Count one time round eval's loop, or one call on the VM
+func (run *evaluation) step() {
+	run.steps++
+	if run.limits.Steps > 0 && run.steps > run.limits.Steps {
+		panic(errorf(ErrLimit, "", "evaluation took more than %d steps", run.limits.Steps))
+	}
+	if run.steps%checkEvery == 0 {
+		run.checkContext()
+	}
+}
+
+// Stop if the context was cancelled or timed out
+func (run *evaluation) checkContext() {
+	err := run.ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		panic(errorf(ErrLimit, "", "evaluation timed out"))
+	}
+	if err != nil {
+		panic(errorf(ErrCancelled, "", "evaluation cancelled"))
+	}
+}
+
+// Go one evaluation deeper. Every enter is paired with a leave, even when
+// it panics. The context is checked at the top level too, so a cancelled
+// script stops before its next form rather than up to checkEvery steps in.
+func (run *evaluation) enter() {
+	run.depth++
+	max := run.limits.Depth
+	if max == 0 {
+		max = DefaultDepth
+	}
+	if run.depth > max {
+		panic(errorf(ErrLimit, "", "evaluation nested more than %d deep", max))
+	}
+	if run.depth == 1 {
+		run.checkContext()
+	}
+}
+
+func (run *evaluation) leave() {
+	run.depth--
+}
+
+// Count the pairs, vector slots, hash entries and strings in a value a
+// builtin made.
+// Each is only counted the first time it's seen, so walking stops at
+// parts of the value that already existed, like the tail of a cons.
+func (run *evaluation) allocated(e *Expr) {
+	if run.limits.Conses == 0 && run.limits.Strings == 0 {
+		return
+	}
+	run.count(e)
+	run.checkAllocation(0, 0)
+}
+
+// Stop a builtin before it makes conses pairs, slots or entries and bytes
+// of strings that would take the evaluation over its limits, rather than
+// finding out once they're made. Making them can take a while, so the
+// context is checked too. They're counted by allocated when the builtin
+// returns.
+func (run *evaluation) reserve(conses, bytes int64) {
+	run.checkAllocation(conses, bytes)
+	run.checkContext()
+}
+
+// Stop a builtin before it adds conses slots and bytes to e, a vector or
+// hash it changes in place, if that would take the evaluation over its
+// limits. Once e has been counted, allocated won't look at it again, so
+// what's added is counted here.
+func (run *evaluation) grow(e *Expr, conses, bytes int64) {
+	run.reserve(conses, bytes)
+	if e.counted.Load() {
+		run.conses += conses
+		run.strings += bytes
+	}
+}
+
+func (run *evaluation) checkAllocation(conses, bytes int64) {
+	if run.limits.Conses > 0 && run.conses+conses > run.limits.Conses {
+		panic(errorf(ErrLimit, "", "evaluation made more than %d conses", run.limits.Conses))
+	}
+	if run.limits.Strings > 0 && run.strings+bytes > run.limits.Strings {
+		panic(errorf(ErrLimit, "", "evaluation made more than %d bytes of strings", run.limits.Strings))
+	}
+}
+
+func (run *evaluation) count(e *Expr) {
+	for e.Type == Pair && e.counted.CompareAndSwap(false, true) {
+		run.conses++
+		run.count(e.Head)
+		e = e.Tail
+	}
+	switch e.Type {
+	case Vector:
+		if e.counted.CompareAndSwap(false, true) {
+			run.conses += int64(len(e.Items))
+			for _, item := range e.Items {
+				run.count(item)
+			}
+		}
+	case Hash:
+		if e.counted.CompareAndSwap(false, true) {
+			run.conses += int64(e.HashTable.Len())
+			for _, entry := range e.HashTable.Entries() {
+				run.count(entry.Key)
+				run.count(entry.Val)
+			}
+		}
+	case String:
+		if e.counted.CompareAndSwap(false, true) {
+			run.strings += int64(len(e.Str))
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package minilisp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		input  string
+		kind   string
+		msg    string
+	}{
+		{"steps", Limits{Steps: 1000}, "(define loop (lambda () (loop))) (loop)", ErrLimit, "evaluation took more than 1000 steps"},
+		{"depth", Limits{Depth: 50}, "(define f (lambda (n) (+ 1 (f n)))) (f 1)", ErrLimit, "evaluation nested more than 50 deep"},
+		{"default depth", Limits{}, "(define f (lambda (n) (+ 1 (f n)))) (f 1)", ErrLimit, "evaluation nested more than 10000 deep"},
+		{"conses", Limits{Conses: 100}, "(define f (lambda (l) (f (pair 1 l)))) (f nil)", ErrLimit, "evaluation made more than 100 conses"},
+		{"vectors", Limits{Conses: 100}, "(list->vector (range 0 1000))", ErrLimit, "evaluation made more than 100 conses"},
+		{"quasiquote", Limits{Conses: 100}, "(define f (lambda (l) (f `(1 ,@l)))) (f nil)", ErrLimit, "evaluation made more than 100 conses"},
+		{"strings", Limits{Strings: 1000}, `(define f (lambda (s) (f (string-append s "ab")))) (f "")`, ErrLimit, "evaluation made more than 1000 bytes of strings"},
+		{"timeout", Limits{Timeout: 20 * time.Millisecond}, "(define loop (lambda () (loop))) (loop)", ErrLimit, "evaluation timed out"},
+		// Builtins that can make a lot from a little stop before making it
+		{"range", Limits{Conses: 1000}, "(range 0 100000000)", ErrLimit, "evaluation made more than 1000 conses"},
+		{"range timeout", Limits{Timeout: 20 * time.Millisecond}, "(range 0 1000000000)", ErrLimit, "evaluation timed out"},
+		{"append", Limits{Conses: 1000}, "(define l (range 0 600)) (append l l)", ErrLimit, "evaluation made more than 1000 conses"},
+		{"map", Limits{Conses: 1000}, "(define l (range 0 600)) (map head (map list l))", ErrLimit, "evaluation made more than 1000 conses"},
+		{"filter", Limits{Conses: 1000}, "(define l (range 0 600)) (filter number? l)", ErrLimit, "evaluation made more than 1000 conses"},
+		{"list->vector", Limits{Conses: 1000}, "(list->vector (range 0 600))", ErrLimit, "evaluation made more than 1000 conses"},
+		{"string-replace", Limits{Strings: 1000}, `(string-replace "aaaa" "a" (string-join (range 0 400) ""))`, ErrLimit, "evaluation made more than 1000 bytes of strings"},
+		{"string-join", Limits{Strings: 1000}, `(string-join (list "a" "b") (string-join (range 0 400) ""))`, ErrLimit, "evaluation made more than 1000 bytes of strings"},
+		{"string-append", Limits{Strings: 1000}, `(define s (string-join (range 0 300) "")) (string-append s s)`, ErrLimit, "evaluation made more than 1000 bytes of strings"},
+		{"string->list", Limits{Conses: 100}, `(string->list (string-join (range 0 60) ""))`, ErrLimit, "evaluation made more than 100 conses"},
+		// Growing a vector or hash in place counts what's added
+		{"vector-push", Limits{Conses: 1000}, "(define v [1]) (let loop ((i 0)) (if (< i 100000) (begin (vector-push v i) (loop (+ i 1)))))", ErrLimit, "evaluation made more than 1000 conses"},
+		{"vector-push many", Limits{Conses: 1000}, "(apply vector-push (pair (vector) (range 0 600))) (apply vector-push (pair (vector) (range 0 600)))", ErrLimit, "evaluation made more than 1000 conses"},
+		{"hash-set", Limits{Conses: 1000}, "(define h (hash)) (let loop ((i 0)) (if (< i 100000) (begin (hash-set h i i) (loop (+ i 1)))))", ErrLimit, "evaluation made more than 1000 conses"},
+		{"hash-update", Limits{Conses: 1000}, "(define h (hash)) (let loop ((i 0)) (if (< i 100000) (begin (hash-update h i (lambda (x) 1)) (loop (+ i 1)))))", ErrLimit, "evaluation made more than 1000 conses"},
+		// Catching a limit error doesn't get round it
+		{"caught", Limits{Steps: 1000}, "(define loop (lambda () (try (loop) (catch (e) (loop))))) (loop)", ErrLimit, "evaluation took more than 1000 steps"},
+		{"caught steps", Limits{Steps: 1000}, "(let outer () (try (let inner () (inner)) (catch (e) nil)) (outer))", ErrLimit, "evaluation took more than 1000 steps"},
+		{"caught timeout", Limits{Timeout: 50 * time.Millisecond}, "(let outer () (try (let inner () (inner)) (catch (e) nil)) (outer))", ErrLimit, "evaluation timed out"},
+		{"caught by kind", Limits{Timeout: 50 * time.Millisecond}, "(let outer () (try (let inner () (inner)) (catch (e limit-error) nil)) (outer))", ErrLimit, "evaluation timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interp := New(WithoutStdlib(), WithLimits(tt.limits))
+			_, err := interp.Eval(context.Background(), tt.input)
+			var lispErr *EvalError
+			if !errors.As(err, &lispErr) || lispErr.Kind != tt.kind || lispErr.Message != tt.msg {
+				t.Errorf("err = %v, want %s %q", err, tt.kind, tt.msg)
+			}
+		})
+	}
+}
+
+func TestLimitsAreEachEvaluation(t *testing.T) {
+	interp := New(WithoutStdlib(), WithLimits(Limits{Steps: 1000, Conses: 100}))
+	ctx := context.Background()
+
+	// Within the limits every time, though not all together
+	interp.Eval(ctx, "(define count (lambda (n) (if (= n 0) 'done (count (- n 1)))))")
+	for i := 0; i < 5; i++ {
+		if got, err := interp.Eval(ctx, "(count 100) (vector-length (list->vector (range 0 40)))"); err != nil || got != 40 {
+			t.Fatalf("run %d = %v, %v", i, got, err)
+		}
+	}
+
+	// Setting a key that's already there adds nothing
+	interp.Eval(ctx, "(define h (hash :a 1))")
+	if _, err := interp.Eval(ctx, "(let loop ((i 0)) (if (< i 150) (begin (hash-set h :a i) (loop (+ i 1)))))"); err != nil {
+		t.Errorf("err = %v", err)
+	}
+
+	// The tail of each pair already exists, so isn't counted again
+	if _, err := interp.Eval(ctx, "(define l (range 0 60)) (map (lambda (n) (pair n l)) (range 0 10))"); err != nil {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// try can't catch a limit error, but its finally still runs
+func TestLimitErrorRunsFinally(t *testing.T) {
+	interp := New(WithoutStdlib(), WithLimits(Limits{Timeout: 50 * time.Millisecond}))
+	ctx := context.Background()
+	interp.Eval(ctx, "(define cleaned nil)")
+
+	_, err := interp.Eval(ctx, "(try (let loop () (loop)) (catch (e limit-error) 'caught) (finally (set! cleaned true)))")
+	var lispErr *EvalError
+	if !errors.As(err, &lispErr) || lispErr.Kind != ErrLimit {
+		t.Errorf("err = %v, want a limit-error", err)
+	}
+	if got, _ := interp.Eval(ctx, "cleaned"); got != true {
+		t.Errorf("cleaned = %v, want true", got)
+	}
+}
+
+// Evaluations running at once each get their own context and counts
+func TestConcurrentEvaluations(t *testing.T) {
+	interp := New(WithoutStdlib(), WithLimits(Limits{Steps: 10000}))
+	interp.Eval(context.Background(), "(define count (lambda (n) (if (= n 0) 'done (count (- n 1)))))")
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if got, err := interp.Call(context.Background(), "count", 1000); err != nil || got != "done" {
+					t.Errorf("call = %v, %v", got, err)
+					return
+				}
+				if _, err := interp.Eval(cancelled, "(count 10)"); err == nil {
+					t.Error("cancelled eval should fail")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCancel(t *testing.T) {
+	interp := New(WithoutStdlib())
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := interp.Eval(ctx, "(define loop (lambda (n) (loop (+ n 1)))) (loop 0)")
+	var lispErr *EvalError
+	if !errors.As(err, &lispErr) || lispErr.Kind != ErrCancelled {
+		t.Fatalf("err = %v, want a cancel-error", err)
+	}
+
+	// The interpreter still works after
+	if got, err := interp.Eval(context.Background(), "(+ 1 2)"); err != nil || got != 3 {
+		t.Errorf("(+ 1 2) = %v, %v", got, err)
+	}
+}
+
+func TestRunStopsAtLimit(t *testing.T) {
+	interp := New(WithoutStdlib(), WithLimits(Limits{Timeout: 20 * time.Millisecond}))
+	var reported []string
+	err := interp.Run(context.Background(), "(head nil)\n(define loop (lambda () (loop)))\n(loop)\n(define after 1)", "script.lisp", func(err error) {
+		reported = append(reported, err.Error())
+	})
+
+	if len(reported) != 1 || reported[0] != "head: argument 1 must be a pair, got nil" {
+		t.Errorf("reported = %q", reported)
+	}
+	if err == nil || err.Error() != "evaluation timed out" {
+		t.Errorf("err = %v, want the time out", err)
+	}
+	if _, ok := interp.env.Lookup("after"); ok {
+		t.Error("the script should stop at the time out")
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	in := New(WithoutStdlib(), WithLimits(Limits{Steps: 10000}), WithStderr(&strings.Builder{}))
+	in.Eval(context.Background(), `
+(define loop (lambda () (loop)))
+(define handler (lambda (req)
+  (if (= (hash-get req "path") "/loop") (loop) {:body "ok"})))`)
+	handler, _ := in.env.Lookup("handler")
+	server := httptest.NewServer(lispHandler(in.env, handler))
+	defer server.Close()
+
+	// A runaway request fails on its own and the next one still works
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{{"/loop", 500}, {"/", 200}, {"/loop", 500}, {"/", 200}} {
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s status = %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestFetchCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	interp := New(WithoutStdlib(), WithLimits(Limits{Timeout: 20 * time.Millisecond}))
+	interp.Define("url", server.URL)
+	_, err := interp.Eval(context.Background(), "(fetch url)")
+	var lispErr *EvalError
+	if !errors.As(err, &lispErr) || lispErr.Kind != ErrLimit || lispErr.Message != "evaluation timed out" {
+		t.Errorf("err = %v, want a time out", err)
+	}
+}
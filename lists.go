@@ -0,0 +1,362 @@
+package minilisp
+
+import (
+	"context"
+	"sort"
+)
+
+// List builtins. These loop in Go rather than recursing, so they work on
+// lists of any length. Functions passed to them (map, filter, sort and so
+// on) are called with applyProc and can be builtins, lambdas or keywords,
+// which is why those builtins are made with makeEnvBuiltin.
+//
+// Like SRFI-1, functions come first and the list last, except for nth,
+// take and drop which take the list first like vector-ref and substring.
+
+// The elements of a proper list argument. i is the 0-based index of the
+// argument, reported 1-based.
+func checkList(name string, i int, arg *Expr) []*Expr {
+	var items []*Expr
+	e := arg
+	for ; e.Type == Pair; e = e.Tail {
+		items = append(items, e.Head)
+	}
+	if e != nilExpr {
+		panic(argError(name, i, "a list", arg))
+	}
+	return items
+}
+
+// A non-negative count argument
+func checkCount(name string, i int, arg *Expr) int {
+	checkInteger(name, i, arg)
+	if arg.Num < 0 {
+		panic(errorf(ErrValue, name, "argument %d must not be negative, got %d", i+1, arg.Num))
+	}
+	return arg.Num
+}
+
+func builtinLength(args []*Expr) *Expr {
+	return makeNum(len(listToSlice(args[0])))
+}
+
+// (append l1 l2 ...) copies all but the last list, which is shared
+func builtinAppend(ctx context.Context, env *Env, args []*Expr) *Expr {
+	if len(args) == 0 {
+		return nilExpr
+	}
+
+	lists := make([][]*Expr, len(args)-1)
+	var n int64
+	for i := range lists {
+		lists[i] = listToSlice(args[i])
+		n += int64(len(lists[i]))
+	}
+	env.evaluation().reserve(n, 0)
+
+	result := args[len(args)-1]
+	for i := len(lists) - 1; i >= 0; i-- {
+		items := lists[i]
+		for j := len(items) - 1; j >= 0; j-- {
+			result = pair(items[j], result)
+		}
+	}
+	return result
+}
+
+func builtinReverse(args []*Expr) *Expr {
+	result := nilExpr
+	for _, item := range listToSlice(args[0]) {
+		result = pair(item, result)
+	}
+	return result
+}
+
+// (nth lst i), counting from 0
+func builtinNth(args []*Expr) *Expr {
+	items := listToSlice(args[0])
+	checkInteger("nth", 1, args[1])
+
+	i := args[1].Num
+	if i < 0 || i >= len(items) {
+		panic(errorf(ErrValue, "nth", "index %d out of bounds for list of length %d", i, len(items)))
+	}
+	return items[i]
+}
+
+// (apply f lst) calls f with the elements of lst as its arguments.
+// Arguments between f and lst go in front: (apply + 1 2 '(3 4)) is
+// (+ 1 2 3 4).
+func builtinApply(ctx context.Context, env *Env, args []*Expr) *Expr {
+	last := len(args) - 1
+	callArgs := append([]*Expr{}, args[1:last]...)
+	callArgs = append(callArgs, checkList("apply", last, args[last])...)
+	return applyProc(env, args[0], callArgs)
+}
+
+// Rows of the nth element of each list, as many as the shortest list has
+func transpose(args []*Expr) [][]*Expr {
+	lists := make([][]*Expr, len(args))
+	n := -1
+	for i, arg := range args {
+		lists[i] = listToSlice(arg)
+		if n < 0 || len(lists[i]) < n {
+			n = len(lists[i])
+		}
+	}
+
+	rows := make([][]*Expr, n)
+	for j := range rows {
+		rows[j] = make([]*Expr, len(lists))
+		for i := range lists {
+			rows[j][i] = lists[i][j]
+		}
+	}
+	return rows
+}
+
+// (map f lst ...) with more lists passing f one element from each
+func builtinMap(ctx context.Context, env *Env, args []*Expr) *Expr {
+	rows := transpose(args[1:])
+	env.evaluation().reserve(int64(len(rows)), 0)
+
+	var results []*Expr
+	for _, row := range rows {
+		results = append(results, applyProc(env, args[0], row))
+	}
+	return list(results...)
+}
+
+// Like map but only for side effects, returns nil
+func builtinForEach(ctx context.Context, env *Env, args []*Expr) *Expr {
+	for _, row := range transpose(args[1:]) {
+		applyProc(env, args[0], row)
+	}
+	return nilExpr
+}
+
+func builtinFilter(ctx context.Context, env *Env, args []*Expr) *Expr {
+	run := env.evaluation()
+	var kept []*Expr
+	for _, item := range listToSlice(args[1]) {
+		if isTruthy(applyProc(env, args[0], []*Expr{item})) {
+			kept = append(kept, item)
+			run.checkAllocation(int64(len(kept)), 0)
+		}
+	}
+	return list(kept...)
+}
+
+// (fold-left f init lst) calls (f acc x) from the left
+func builtinFoldLeft(ctx context.Context, env *Env, args []*Expr) *Expr {
+	acc := args[1]
+	for _, item := range listToSlice(args[2]) {
+		acc = applyProc(env, args[0], []*Expr{acc, item})
+	}
+	return acc
+}
+
+// (fold-right f init lst) calls (f x acc) from the right
+func builtinFoldRight(ctx context.Context, env *Env, args []*Expr) *Expr {
+	acc := args[1]
+	items := listToSlice(args[2])
+	for i := len(items) - 1; i >= 0; i-- {
+		acc = applyProc(env, args[0], []*Expr{items[i], acc})
+	}
+	return acc
+}
+
+// (reduce f init lst) is fold-left, (reduce f lst) starts from the first
+// element
+func builtinReduce(ctx context.Context, env *Env, args []*Expr) *Expr {
+	if len(args) == 3 {
+		return builtinFoldLeft(ctx, env, args)
+	}
+	// The signature only checks the list when init is given
+	items := checkList("reduce", 1, args[1])
+	if len(items) == 0 {
+		panic(errorf(ErrValue, "reduce", "empty list with no initial value"))
+	}
+	acc := items[0]
+	for _, item := range items[1:] {
+		acc = applyProc(env, args[0], []*Expr{acc, item})
+	}
+	return acc
+}
+
+// (range end), (range start end) or (range start end step), end excluded
+func builtinRange(ctx context.Context, env *Env, args []*Expr) *Expr {
+	for i, arg := range args {
+		checkInteger("range", i, arg)
+	}
+
+	start, end, step := 0, args[0].Num, 1
+	if len(args) > 1 {
+		start, end = args[0].Num, args[1].Num
+	}
+	if len(args) > 2 {
+		step = args[2].Num
+	}
+	if step == 0 {
+		panic(errorf(ErrValue, "range", "step can't be 0"))
+	}
+
+	n := 0
+	if (step > 0 && start < end) || (step < 0 && start > end) {
+		n = (end-start-sign(step))/step + 1
+	}
+	run := env.evaluation()
+	run.reserve(int64(n), 0)
+
+	var items []*Expr
+	for i := 0; i < n; i++ {
+		if i%checkEvery == 0 {
+			run.checkContext()
+		}
+		items = append(items, makeNum(start+i*step))
+	}
+	return list(items...)
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+// (take lst n), the whole list if it's shorter than n
+func builtinTake(args []*Expr) *Expr {
+	items := listToSlice(args[0])
+	n := checkCount("take", 1, args[1])
+
+	if n > len(items) {
+		n = len(items)
+	}
+	return list(items[:n]...)
+}
+
+// (drop lst n), nil if it's shorter than n
+func builtinDrop(args []*Expr) *Expr {
+	n := checkCount("drop", 1, args[1])
+
+	// The rest of the list is shared rather than copied
+	e := args[0]
+	for ; n > 0 && e != nilExpr; n-- {
+		e = e.Tail
+	}
+	return e
+}
+
+// (zip l1 l2 ...) → ((a1 b1 ...) (a2 b2 ...) ...), as long as the
+// shortest list
+func builtinZip(args []*Expr) *Expr {
+	var rows []*Expr
+	for _, row := range transpose(args) {
+		rows = append(rows, list(row...))
+	}
+	return list(rows...)
+}
+
+// (sort lst) sorts numbers or strings ascending, (sort lst less?) uses a
+// function that says whether its first argument goes before its second.
+// The sort is stable and returns a new list.
+func builtinSort(ctx context.Context, env *Env, args []*Expr) *Expr {
+	items := append([]*Expr{}, listToSlice(args[0])...)
+
+	var less func(a, b *Expr) bool
+	if len(args) == 2 {
+		less = func(a, b *Expr) bool {
+			return isTruthy(applyProc(env, args[1], []*Expr{a, b}))
+		}
+	} else {
+		less = defaultLess
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+	return list(items...)
+}
+
+// Order numbers by value and strings alphabetically
+func defaultLess(a, b *Expr) bool {
+	switch {
+	case isNumber(a) && isNumber(b):
+		return compareNums(a, b) < 0
+	case a.Type == String && b.Type == String:
+		return a.Str < b.Str
+	default:
+		panic(errorf(ErrType, "sort", "can't compare %s and %s without a comparison function", printExpr(a), printExpr(b)))
+	}
+}
+
+// (member x lst) returns the rest of lst starting at the first element
+// = to x, or nil
+func builtinMember(args []*Expr) *Expr {
+	for e := args[1]; e != nilExpr; e = e.Tail {
+		if structuralEq(args[0], e.Head) {
+			return e
+		}
+	}
+	return nilExpr
+}
+
+// (assoc key alist) returns the first entry of a list of (key value ...)
+// lists whose key is = to key, or nil
+func builtinAssoc(args []*Expr) *Expr {
+	for _, entry := range listToSlice(args[1]) {
+		if entry.Type != Pair {
+			panic(errorf(ErrType, "assoc", "entries must be lists, got %s", printExpr(entry)))
+		}
+		if structuralEq(args[0], entry.Head) {
+			return entry
+		}
+	}
+	return nilExpr
+}
+
+// Elements of nested lists, all in one list
+func builtinFlatten(args []*Expr) *Expr {
+	var items []*Expr
+	var walk func(e *Expr)
+	walk = func(e *Expr) {
+		for ; e.Type == Pair; e = e.Tail {
+			if e.Head.Type == Pair {
+				walk(e.Head)
+			} else if e.Head != nilExpr {
+				items = append(items, e.Head)
+			}
+		}
+	}
+	walk(args[0])
+	return list(items...)
+}
+
+func builtinAnyP(ctx context.Context, env *Env, args []*Expr) *Expr {
+	for _, item := range listToSlice(args[1]) {
+		if isTruthy(applyProc(env, args[0], []*Expr{item})) {
+			return trueExpr
+		}
+	}
+	return falseExpr
+}
+
+func builtinEveryP(ctx context.Context, env *Env, args []*Expr) *Expr {
+	for _, item := range listToSlice(args[1]) {
+		if !isTruthy(applyProc(env, args[0], []*Expr{item})) {
+			return falseExpr
+		}
+	}
+	return trueExpr
+}
+
+// The first element pred is true for, or nil
+func builtinFind(ctx context.Context, env *Env, args []*Expr) *Expr {
+	for _, item := range listToSlice(args[1]) {
+		if isTruthy(applyProc(env, args[0], []*Expr{item})) {
+			return item
+		}
+	}
+	return nilExpr
+}
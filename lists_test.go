@@ -0,0 +1,184 @@
+package minilisp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListLibrary(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(length nil)", "0"},
+		{"(length '(1 2 3))", "3"},
+		{"(append)", "nil"},
+		{"(append '(1 2) '(3) nil '(4 5))", "(1 2 3 4 5)"},
+		{"(append nil '(1))", "(1)"},
+		{"(reverse '(1 2 3))", "(3 2 1)"},
+		{"(reverse nil)", "nil"},
+		{"(nth '(a b c) 0)", "a"},
+		{"(nth '(a b c) 2)", "c"},
+		{"(apply + '(1 2 3))", "6"},
+		{"(apply + 1 2 '(3 4))", "10"},
+		{"(apply list nil)", "nil"},
+		{"(apply (lambda (x &rest more) more) '(1 2 3))", "(2 3)"},
+		{"(apply :a (list {:a 1}))", "1"},
+		{"(apply map list '((1 2) (a b)))", "((1 a) (2 b))"},
+		{"(map (lambda (x) (* x x)) '(1 2 3))", "(1 4 9)"},
+		{"(map + '(1 2 3) '(10 20))", "(11 22)"},
+		{"(map :name (list {:name \"a\"} {:name \"b\"}))", `("a" "b")`},
+		{"(map head nil)", "nil"},
+		{"(for-each print nil)", "nil"},
+		{"(filter number? '(1 \"a\" 2 b))", "(1 2)"},
+		{"(filter (lambda (x) (> x 1)) '(1 2 3))", "(2 3)"},
+		{"(reduce + '(1 2 3 4))", "10"},
+		{"(reduce + 10 '(1 2 3 4))", "20"},
+		{"(reduce + '(5))", "5"},
+		{"(fold-left - 0 '(1 2 3))", "-6"},
+		{"(fold-right - 0 '(1 2 3))", "2"},
+		{"(fold-left (lambda (acc x) (pair x acc)) nil '(1 2 3))", "(3 2 1)"},
+		{"(fold-right pair nil '(1 2 3))", "(1 2 3)"},
+		{"(range 4)", "(0 1 2 3)"},
+		{"(range 2 5)", "(2 3 4)"},
+		{"(range 10 0 -3)", "(10 7 4 1)"},
+		{"(range 10 1 -3)", "(10 7 4)"},
+		{"(range 0 10 3)", "(0 3 6 9)"},
+		{"(range 0)", "nil"},
+		{"(range 5 2)", "nil"},
+		{"(take '(1 2 3) 2)", "(1 2)"},
+		{"(take '(1 2) 5)", "(1 2)"},
+		{"(take '(1 2) 0)", "nil"},
+		{"(drop '(1 2 3) 2)", "(3)"},
+		{"(drop '(1 2) 5)", "nil"},
+		{"(zip '(1 2 3) '(a b c))", "((1 a) (2 b) (3 c))"},
+		{"(zip '(1 2 3) '(a))", "((1 a))"},
+		{"(sort '(3 1 2))", "(1 2 3)"},
+		{"(sort '(2.5 1/2 1))", "(1/2 1 2.5)"},
+		{`(sort '("pear" "apple" "fig"))`, `("apple" "fig" "pear")`},
+		{"(sort '(1 3 2) >)", "(3 2 1)"},
+		{"(sort '((b 2) (a 1) (c 2)) (lambda (x y) (< (nth x 1) (nth y 1))))", "((a 1) (b 2) (c 2))"},
+		{"(sort nil)", "nil"},
+		{"(member 2 '(1 2 3))", "(2 3)"},
+		{"(member '(a) '(1 (a) 3))", "((a) 3)"},
+		{"(member 4 '(1 2 3))", "nil"},
+		{"(assoc 'b '((a 1) (b 2)))", "(b 2)"},
+		{`(assoc "x" '(("y" 1)))`, "nil"},
+		{"(flatten '(1 (2 (3 4)) () 5))", "(1 2 3 4 5)"},
+		{"(any? number? '(a 1))", "true"},
+		{"(any? number? nil)", "false"},
+		{"(every? number? '(1 2))", "true"},
+		{"(every? number? '(1 b))", "false"},
+		{"(every? number? nil)", "true"},
+		{"(find string? '(1 \"a\" \"b\"))", `"a"`},
+		{"(find string? '(1 2))", "nil"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestListLibraryDoesNotMutate(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr("(define xs '(3 1 2))"), env)
+	eval(readStr("(sort xs)"), env)
+	eval(readStr("(reverse xs)"), env)
+	eval(readStr("(append xs '(4))"), env)
+
+	if got := printExpr(eval(readStr("xs"), env)); got != "(3 1 2)" {
+		t.Errorf("xs = %s, want (3 1 2)", got)
+	}
+}
+
+func TestForEachRunsInOrder(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr("(define seen nil)"), env)
+	eval(readStr("(for-each (lambda (x y) (set! seen (pair (+ x y) seen))) '(1 2 3) '(10 20 30))"), env)
+
+	if got := printExpr(eval(readStr("seen"), env)); got != "(33 22 11)" {
+		t.Errorf("seen = %s, want (33 22 11)", got)
+	}
+}
+
+func TestListLibraryOnLongLists(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(length (map (lambda (x) (+ x 1)) (range 200000)))", "200000"},
+		{"(reduce + (filter (lambda (x) (> x 0)) (range 200000)))", "19999900000"},
+		{"(length (reverse (append (range 100000) (range 100000))))", "200000"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestListLibraryErrors(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{"(length 1)", ErrType},
+		{"(length (pair 1 2))", ErrType},
+		{"(length)", ErrArity},
+		{"(nth '(1 2) 2)", ErrValue},
+		{"(nth '(1 2) -1)", ErrValue},
+		{"(apply +)", ErrArity},
+		{"(apply + 1)", ErrType},
+		{"(apply 1 '(2))", ErrType},
+		{"(apply (lambda (x) x) '(1 2))", ErrArity},
+		{"(map 1 '(1 2))", ErrType},
+		{"(map head)", ErrArity},
+		{"(filter number? 1)", ErrType},
+		{"(reduce + nil)", ErrValue},
+		{"(range 0 10 0)", ErrValue},
+		{"(range 1.5)", ErrType},
+		{"(take '(1 2) -1)", ErrValue},
+		{"(sort '(1 \"a\"))", ErrType},
+		{"(assoc 'a '(1 2))", ErrType},
+		{"(map (lambda (x y) x) '(1 2))", ErrArity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func TestCallbackErrorsTraceTheLambda(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(define explode (lambda (x) (+ x "a")))`), env)
+
+	defer func() {
+		err := recoverError(recover())
+		if trace := strings.Join(err.Trace, " "); !strings.Contains(trace, "explode") {
+			t.Errorf("trace = %q, want it to mention explode", trace)
+		}
+	}()
+	eval(readStr("(map explode '(1))"), env)
+}
@@ -1,44 +1,46 @@
-package main
+package minilisp
 
-import "testing"
-
-func setupMacroTestEnv() *Env {
-	env := NewEnv(nil)
-
-	// Arithmetic
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("-", makeBuiltin(builtinSub))
-	env.Define("*", makeBuiltin(builtinMul))
-	env.Define("/", makeBuiltin(builtinDiv))
-	env.Define("=", makeBuiltin(builtinEq))
-	env.Define("<", makeBuiltin(builtinLt))
-	env.Define(">", makeBuiltin(builtinGt))
-
-	// String operations
-	env.Define("string-append", makeBuiltin(builtinStringAppend))
-
-	// List operations
-	env.Define("pair", makeBuiltin(builtinPair))
-	env.Define("list", makeBuiltin(builtinList))
-	env.Define("head", makeBuiltin(builtinHead))
-	env.Define("tail", makeBuiltin(builtinTail))
-
-	// Hash operations
-	env.Define("hash", makeBuiltin(builtinHash))
-	env.Define("hash-get", makeBuiltin(builtinHashGet))
-	env.Define("hash-set", makeBuiltin(builtinHashSet))
-
-	// Bootstrap defmacro
-	defmacroCode := "(define defmacro (macro (name params body) (pair 'define (pair name (pair (pair 'macro (pair params (pair body nil))) nil)))))"
-	eval(readStr(defmacroCode), env)
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
 
+func setupMacroTestEnv(opts ...Option) *Env {
+	env := setupFullEnv(opts...)
 	eval(readStr(`(load "std/macro.lisp")`), env)
-
 	return env
 }
 
-func TestThreadFirstMacro(t *testing.T) {
-	env := setupMacroTestEnv()
+// Run on both backends, see runOnBackends
+func TestMacros(t *testing.T) {
+	runOnBackends(t, []backendTest{
+		{"ThreadFirstMacro", testThreadFirstMacro},
+		{"ThreadLastMacro", testThreadLastMacro},
+		{"WhenMacro", testWhenMacro},
+		{"CondMacro", testCondMacro},
+		{"ThreadMacrosWithHash", testThreadMacrosWithHash},
+		{"ThreadMacrosWithList", testThreadMacrosWithList},
+		{"Quasiquote", testQuasiquote},
+		{"UnquoteSplicing", testUnquoteSplicing},
+		{"NestedQuasiquote", testNestedQuasiquote},
+		{"QuasiquoteErrors", testQuasiquoteErrors},
+		{"TemplateMacroSplicesIntoMiddle", testTemplateMacroSplicesIntoMiddle},
+		{"DefmacroMultipleBodyExpressions", testDefmacroMultipleBodyExpressions},
+		{"WhenMacroMultipleBodyExpressions", testWhenMacroMultipleBodyExpressions},
+		{"Gensym", testGensym},
+		{"GensymCantBeTyped", testGensymCantBeTyped},
+		{"GensymInDefmacro", testGensymInDefmacro},
+		{"Macroexpand", testMacroexpand},
+		{"SyntaxRules", testSyntaxRules},
+		{"SyntaxRulesHygiene", testSyntaxRulesHygiene},
+		{"SyntaxRulesErrors", testSyntaxRulesErrors},
+	})
+}
+
+func testThreadFirstMacro(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
 
 	// Test single form: (-> 5 (* 2)) should be 10
 	code := `(-> 5 (* 2))`
@@ -64,8 +66,8 @@ func TestThreadFirstMacro(t *testing.T) {
 	}
 }
 
-func TestThreadLastMacro(t *testing.T) {
-	env := setupMacroTestEnv()
+func testThreadLastMacro(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
 
 	// Test single form: (->> 5 (* 2)) should be 10
 	code := `(->> 5 (* 2))`
@@ -90,8 +92,8 @@ func TestThreadLastMacro(t *testing.T) {
 	}
 }
 
-func TestWhenMacro(t *testing.T) {
-	env := setupMacroTestEnv()
+func testWhenMacro(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
 
 	// Test when with true - should execute body
 	code := `(when true 42)`
@@ -115,8 +117,8 @@ func TestWhenMacro(t *testing.T) {
 	}
 }
 
-func TestCondMacro(t *testing.T) {
-	env := setupMacroTestEnv()
+func testCondMacro(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
 
 	// Test cond with first clause true
 	env.Define("y", makeNum(0))
@@ -152,8 +154,8 @@ func TestCondMacro(t *testing.T) {
 	}
 }
 
-func TestThreadMacrosWithHash(t *testing.T) {
-	env := setupMacroTestEnv()
+func testThreadMacrosWithHash(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
 
 	// Test -> with hash-get (from fetch.lisp pattern)
 	code := `(-> (hash "name" "Alice" "age" 30) (hash-get "name"))`
@@ -172,8 +174,8 @@ func TestThreadMacrosWithHash(t *testing.T) {
 	}
 }
 
-func TestThreadMacrosWithList(t *testing.T) {
-	env := setupMacroTestEnv()
+func testThreadMacrosWithList(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
 
 	// Test -> with list operations
 	code := `(-> (list 1 2 3) (head))`
@@ -197,3 +199,363 @@ func TestThreadMacrosWithList(t *testing.T) {
 		t.Errorf("tail should be 3, got %d", result.Tail.Tail.Num)
 	}
 }
+
+func testQuasiquote(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	env.Define("x", makeNum(5))
+	env.Define("xs", list(makeNum(1), makeNum(2), makeNum(3)))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"`x", "x"},
+		{"`(a b c)", "(a b c)"},
+		{"`(a ,x c)", "(a 5 c)"},
+		{"`(a ,(+ x 1) c)", "(a 6 c)"},
+		{"`(a (b ,x))", "(a (b 5))"},
+		// (a unquote x) is how (a . ,x) reads in other Lisps
+		{"`(a unquote x)", "(a . 5)"},
+		{"`,x", "5"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testUnquoteSplicing(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	env.Define("xs", list(makeNum(1), makeNum(2), makeNum(3)))
+	env.Define("x", makeNum(5))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"`(,@xs)", "(1 2 3)"},
+		{"`(a ,@xs)", "(a 1 2 3)"},
+		{"`(,@xs z)", "(1 2 3 z)"},
+		{"`(a ,@xs z)", "(a 1 2 3 z)"},
+		{"`(a ,@xs ,@xs z)", "(a 1 2 3 1 2 3 z)"},
+		{"`(a ,@nil z)", "(a z)"},
+		{"`(a (b ,@xs) z)", "(a (b 1 2 3) z)"},
+		{"`(a ,@(list 'x 'y) unquote x)", "(a x y . 5)"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	// Splicing copies the list, so the original is left alone
+	eval(readStr("`(,@xs 4)"), env)
+	if got := printExpr(eval(readStr("xs"), env)); got != "(1 2 3)" {
+		t.Errorf("xs after splicing = %s, want (1 2 3)", got)
+	}
+}
+
+func testNestedQuasiquote(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	env.Define("x", makeNum(5))
+	env.Define("xs", list(makeNum(1), makeNum(2)))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// Inner unquotes belong to the inner quasiquote and are kept
+		{"`(a `(b ,x))", "(a (quasiquote (b (unquote x))))"},
+		// ,,x unquotes through both levels
+		{"`(a `(b ,,x))", "(a (quasiquote (b (unquote 5))))"},
+		{"`(a `(b ,@xs ,,@xs))", "(a (quasiquote (b (unquote-splicing xs) (unquote 1 2))))"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	// Evaluating the inner template finishes the expansion
+	eval(readStr("(define y 7)"), env)
+	code := "(define tmpl `(list `(y ,y ,,x)))"
+	eval(readStr(code), env)
+	result := eval(eval(readStr("tmpl"), env), env)
+	if got := printExpr(result); got != "((y 7 5))" {
+		t.Errorf("evaluated nested template = %s, want ((y 7 5))", got)
+	}
+}
+
+func testQuasiquoteErrors(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+	env.Define("x", makeNum(5))
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{",x", ErrSyntax},
+		{",@x", ErrSyntax},
+		{"`,@x", ErrSyntax},
+		{"`(a ,@x)", ErrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func testTemplateMacroSplicesIntoMiddle(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	// A macro that wraps its body between two calls
+	code := `(defmacro between (before after &rest body)
+		` + "`" + `(list ,before ,@body ,after))`
+	eval(readStr(code), env)
+
+	result := eval(readStr(`(between 1 5 2 3 4)`), env)
+	if got := printExpr(result); got != "(1 2 3 4 5)" {
+		t.Errorf("(between 1 5 2 3 4) = %s, want (1 2 3 4 5)", got)
+	}
+
+	result = eval(readStr(`(between 1 5)`), env)
+	if got := printExpr(result); got != "(1 5)" {
+		t.Errorf("(between 1 5) = %s, want (1 5)", got)
+	}
+}
+
+func testDefmacroMultipleBodyExpressions(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	code := `(defmacro twice (expr)
+		(define once expr)
+		` + "`" + `(list ,once ,once))`
+	eval(readStr(code), env)
+
+	result := eval(readStr(`(twice (+ 1 2))`), env)
+	if got := printExpr(result); got != "(3 3)" {
+		t.Errorf("(twice (+ 1 2)) = %s, want (3 3)", got)
+	}
+}
+
+func testWhenMacroMultipleBodyExpressions(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	result := eval(readStr(`(when true (define w 1) (+ w 41))`), env)
+	if result.Num != 42 {
+		t.Errorf("when with two body expressions = %v, want 42", printExpr(result))
+	}
+}
+
+func testGensym(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	a := eval(readStr("(gensym)"), env)
+	b := eval(readStr("(gensym)"), env)
+	if a.Type != Symbol || b.Type != Symbol {
+		t.Fatalf("gensym types = %v, %v, want Symbol", a.Type, b.Type)
+	}
+	if a.Sym == b.Sym {
+		t.Errorf("gensym returned %s twice", a.Sym)
+	}
+
+	named := eval(readStr(`(gensym "tmp")`), env)
+	if !strings.HasPrefix(named.Sym, "tmp#") {
+		t.Errorf("(gensym \"tmp\") = %s, want tmp#N", named.Sym)
+	}
+}
+
+// Typing the name the next gensym will have is an error rather than a
+// binding a macro's renamed names could capture
+func testGensymCantBeTyped(t *testing.T, backend Backend) {
+	interp := New(WithoutStdlib(), WithBackend(backend))
+	ctx := context.Background()
+
+	_, err := interp.Eval(ctx, "(define g#1 'user)")
+	var lispErr *EvalError
+	if !errors.As(err, &lispErr) || lispErr.Kind != ErrSyntax {
+		t.Errorf("err = %v, want a syntax-error", err)
+	}
+	if got, _ := interp.Eval(ctx, "(gensym)"); got != "g#1" {
+		t.Errorf("(gensym) = %v, want g#1", got)
+	}
+}
+
+func testGensymInDefmacro(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	// Without gensym the temporary would capture the caller's tmp
+	code := `(defmacro my-or2 (a b)
+		(define var (gensym "tmp"))
+		` + "`" + `((lambda (,var) (if ,var ,var ,b)) ,a))`
+	eval(readStr(code), env)
+	eval(readStr("(define tmp 5)"), env)
+
+	result := eval(readStr("(my-or2 nil tmp)"), env)
+	if result.Num != 5 {
+		t.Errorf("(my-or2 nil tmp) = %s, want 5", printExpr(result))
+	}
+}
+
+func testMacroexpand(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(macroexpand-1 '(when x 1 2))", "(if x (begin 1 2) nil)"},
+		{"(macroexpand-1 '(-> 5 (* 2) (+ 3)))", "(-> (* 5 2) (+ 3))"},
+		{"(macroexpand '(-> 5 (* 2) (+ 3)))", "(+ (* 5 2) 3)"},
+		// Only the outer form is expanded
+		{"(macroexpand '(when a (when b 1)))", "(if a (begin (when b 1)) nil)"},
+		{"(macroexpand-1 '(+ 1 2))", "(+ 1 2)"},
+		{"(macroexpand 42)", "42"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testSyntaxRules(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	definitions := []string{
+		`(define-syntax my-if
+			(syntax-rules (then else)
+				((_ c then a else b) (if c a b))))`,
+		`(define-syntax my-list
+			(syntax-rules ()
+				((_ x ...) (list x ...))))`,
+		`(define-syntax sum-pairs
+			(syntax-rules ()
+				((_ (a b) ...) (list (+ a b) ...))))`,
+		`(define-syntax firsts
+			(syntax-rules ()
+				((_ (a rest ...) ...) (list a ...))))`,
+		`(define-syntax flat
+			(syntax-rules ()
+				((_ (a ...) ...) (list a ... ...))))`,
+		`(define-syntax middle
+			(syntax-rules ()
+				((_ first x ... last) (list x ...))))`,
+		`(define-syntax count-args
+			(syntax-rules ()
+				((_) 0)
+				((_ x) 1)
+				((_ x y ...) (+ 1 (count-args y ...)))))`,
+	}
+	for _, code := range definitions {
+		eval(readStr(code), env)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(my-if true then 1 else 2)", "1"},
+		{"(my-if nil then 1 else 2)", "2"},
+		{"(my-list)", "nil"},
+		{"(my-list 1 (+ 1 1) 3)", "(1 2 3)"},
+		{"(sum-pairs (1 2) (3 4) (5 6))", "(3 7 11)"},
+		{"(firsts (1 2 3) (4) (5 6))", "(1 4 5)"},
+		{"(flat (1 2) () (3))", "(1 2 3)"},
+		{"(middle 1 2 3 4)", "(2 3)"},
+		{"(middle 1 4)", "nil"},
+		{"(count-args)", "0"},
+		{"(count-args a b c d)", "4"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testSyntaxRulesHygiene(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	code := `(define-syntax swap!
+		(syntax-rules ()
+			((_ a b) (begin (define tmp a) (define a b) (define b tmp)))))`
+	eval(readStr(code), env)
+
+	// The template's tmp is renamed, so swapping the caller's tmp works
+	eval(readStr("(define tmp 1)"), env)
+	eval(readStr("(define other 2)"), env)
+	eval(readStr("(swap! tmp other)"), env)
+
+	tmp, _ := env.Lookup("tmp")
+	other, _ := env.Lookup("other")
+	if tmp.Num != 2 || other.Num != 1 {
+		t.Errorf("after swap! tmp = %s, other = %s, want 2 and 1", printExpr(tmp), printExpr(other))
+	}
+
+	// Lambda parameters introduced by the template can't capture either
+	code = `(define-syntax my-or
+		(syntax-rules ()
+			((_) nil)
+			((_ e) e)
+			((_ e rest ...) ((lambda (t) (if t t (my-or rest ...))) e))))`
+	eval(readStr(code), env)
+	eval(readStr("(define t 7)"), env)
+
+	result := eval(readStr("(my-or nil t)"), env)
+	if result.Num != 7 {
+		t.Errorf("(my-or nil t) = %s, want 7", printExpr(result))
+	}
+}
+
+func testSyntaxRulesErrors(t *testing.T, backend Backend) {
+	env := setupMacroTestEnv(WithBackend(backend))
+
+	eval(readStr(`(define-syntax two (syntax-rules () ((_ a b) (list a b))))`), env)
+	eval(readStr(`(define-syntax bad-depth (syntax-rules () ((_ x ...) (list x))))`), env)
+
+	tests := []string{
+		"(two 1)",
+		"(two 1 2 3)",
+		"(bad-depth 1 2)",
+		"(syntax-rules () (oops))",
+		"(syntax-rules (1) ((_) 1))",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", input)
+				}
+				if err := recoverError(r); err.Kind != ErrSyntax {
+					t.Errorf("%s kind = %s, want syntax-error", input, err.Kind)
+				}
+			}()
+			eval(readStr(input), env)
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package minilisp
+
+import "context"
+
+// (gensym) or (gensym "prefix")
+func builtinGensym(ctx context.Context, env *Env, args []*Expr) *Expr {
+	in := env.interpreter()
+	if len(args) == 0 {
+		return in.gensym("g")
+	}
+
+	switch args[0].Type {
+	case String:
+		return in.gensym(args[0].Str)
+	case Symbol:
+		return in.gensym(args[0].Sym)
+	default:
+		panic(errorf(ErrType, "gensym", "prefix must be a string or symbol"))
+	}
+}
+
+// syntax-rules macros
+//
+//	(define swap!
+//	  (syntax-rules ()
+//	    ((_ a b) (begin (define tmp a) (define a b) (define b tmp)))))
+//
+// Each clause is a pattern and a template. The first pattern that matches
+// the call is used, with the macro keyword position ignored. Symbols in the
+// pattern bind whatever they match, except _ which matches anything and the
+// listed literals which match only themselves. x ... matches zero or more
+// x, and in the template repeats whatever follows it once per match.
+//
+// Expansion is hygienic for bindings: symbols the template itself binds
+// (lambda and macro parameters, define names, let bindings and catch
+// variables) are renamed to fresh gensyms, so they can't capture the
+// caller's variables.
+
+func makeSyntaxRules(args *Expr, env *Env) *Expr {
+	if args == nilExpr {
+		panic(errorf(ErrSyntax, "syntax-rules", "expects a literals list and clauses"))
+	}
+
+	literals := args.Head
+	for _, lit := range listToSlice(literals) {
+		if lit.Type != Symbol {
+			panic(errorf(ErrSyntax, "syntax-rules", "literals must be symbols"))
+		}
+	}
+
+	clauses := args.Tail
+	for _, clause := range listToSlice(clauses) {
+		if clause.Type != Pair || clause.Head.Type != Pair || clause.Tail.Type != Pair || clause.Tail.Tail != nilExpr {
+			panic(errorf(ErrSyntax, "syntax-rules", "clauses must look like ((_ pattern...) template)"))
+		}
+	}
+
+	m := makeLambda(literals, nilExpr, env, Macro)
+	m.Rules = clauses
+	return m
+}
+
+// What a pattern variable matched. Variables followed by ... in the
+// pattern are repeated, with one binding per match in items.
+type patternBinding struct {
+	value    *Expr
+	repeated bool
+	items    []*patternBinding
+}
+
+type patternBindings map[string]*patternBinding
+
+func expandSyntaxRules(env *Env, m *Expr, form *Expr) *Expr {
+	literals := map[string]bool{}
+	for _, lit := range listToSlice(m.Params) {
+		literals[lit.Sym] = true
+	}
+
+	for clause := m.Rules; clause != nilExpr; clause = clause.Tail {
+		pattern, template := clause.Head.Head, clause.Head.Tail.Head
+
+		b := patternBindings{}
+		if matchPattern(pattern.Tail, form.Tail, literals, b) {
+			renames := map[string]*Expr{}
+			collectBinders(m.Env.interpreter(), template, b, renames)
+			if mod := moduleOf(m.Env); mod != nil {
+				closeFreeNames(env, mod, template, b, renames)
+			}
+			return expandTemplate(template, b, renames)
+		}
+	}
+
+	panic(errorf(ErrSyntax, frameName(m), "no syntax-rules pattern matches %s", printExpr(form)))
+}
+
+func isEllipsis(e *Expr) bool {
+	return e.Type == Pair && e.Head.Type == Symbol && e.Head.Sym == "..."
+}
+
+// Number of pairs before the end of a (possibly improper) list
+func pairCount(e *Expr) int {
+	n := 0
+	for ; e.Type == Pair; e = e.Tail {
+		n++
+	}
+	return n
+}
+
+func matchPattern(pat, form *Expr, literals map[string]bool, b patternBindings) bool {
+	switch {
+	case pat.Type == Symbol:
+		if pat.Sym == "_" {
+			return true
+		}
+		if literals[pat.Sym] {
+			return form.Type == Symbol && form.Sym == pat.Sym
+		}
+		b[pat.Sym] = &patternBinding{value: form}
+		return true
+	case pat.Type == Pair:
+		return matchList(pat, form, literals, b)
+	case pat == nilExpr:
+		return form == nilExpr
+	default:
+		return structuralEq(pat, form)
+	}
+}
+
+func matchList(pat, form *Expr, literals map[string]bool, b patternBindings) bool {
+	for pat.Type == Pair {
+		if isEllipsis(pat.Tail) {
+			// Leave enough of the form for the patterns after the ellipsis
+			after := pat.Tail.Tail
+			n := pairCount(form) - pairCount(after)
+			if n < 0 {
+				return false
+			}
+
+			vars := patternVars(pat.Head, literals, nil)
+			for _, v := range vars {
+				b[v] = &patternBinding{repeated: true}
+			}
+			for i := 0; i < n; i++ {
+				sub := patternBindings{}
+				if !matchPattern(pat.Head, form.Head, literals, sub) {
+					return false
+				}
+				for _, v := range vars {
+					b[v].items = append(b[v].items, sub[v])
+				}
+				form = form.Tail
+			}
+
+			pat = after
+			continue
+		}
+
+		if form.Type != Pair || !matchPattern(pat.Head, form.Head, literals, b) {
+			return false
+		}
+		pat, form = pat.Tail, form.Tail
+	}
+
+	// The end of the list, or a symbol after a dot matching the rest
+	return matchPattern(pat, form, literals, b)
+}
+
+// Names of the pattern variables in pat
+func patternVars(pat *Expr, literals map[string]bool, vars []string) []string {
+	switch pat.Type {
+	case Symbol:
+		if pat.Sym != "_" && pat.Sym != "..." && !literals[pat.Sym] {
+			vars = append(vars, pat.Sym)
+		}
+	case Pair:
+		vars = patternVars(pat.Head, literals, vars)
+		vars = patternVars(pat.Tail, literals, vars)
+	}
+	return vars
+}
+
+// Find the symbols a template binds itself and give each a fresh name
+func collectBinders(in *Interpreter, template *Expr, b patternBindings, renames map[string]*Expr) {
+	if template.Type != Pair {
+		return
+	}
+
+	// Rename every symbol bound by a binding pattern
+	var rename func(pat *Expr)
+	rename = func(pat *Expr) {
+		switch pat.Type {
+		case Symbol:
+			if pat.Sym == "&rest" || pat.Sym == "..." || pat.Sym == "_" {
+				return
+			}
+			if _, isVar := b[pat.Sym]; isVar {
+				return
+			}
+			if _, done := renames[pat.Sym]; !done {
+				renames[pat.Sym] = in.gensym(pat.Sym)
+			}
+		case Pair:
+			if pat.Head.Type == Symbol && pat.Head.Sym == "hash" {
+				pat = pat.Tail
+			}
+			for ; pat.Type == Pair; pat = pat.Tail {
+				rename(pat.Head)
+			}
+			rename(pat)
+		}
+	}
+
+	if head := template.Head; head.Type == Symbol && template.Tail.Type == Pair {
+		binding := template.Tail.Head
+		switch head.Sym {
+		case "lambda", "macro", "define":
+			rename(binding)
+		case "catch":
+			if binding.Type == Pair {
+				rename(binding.Head)
+			}
+		case "let", "let*", "letrec":
+			// Named let binds the loop name too
+			if binding.Type == Symbol && template.Tail.Tail.Type == Pair {
+				rename(binding)
+				binding = template.Tail.Tail.Head
+			}
+			for ; binding.Type == Pair; binding = binding.Tail {
+				if binding.Head.Type == Pair {
+					rename(binding.Head.Head)
+				}
+			}
+		}
+	}
+
+	for t := template; t.Type == Pair; t = t.Tail {
+		collectBinders(in, t.Head, b, renames)
+	}
+}
+
+// Point names in a template that the macro's module defines, but that
+// mean something else where the macro is used, at the module's binding.
+// After (import std:macro :as m), cond's template still calls cond, which
+// is only bound as m/cond. The name is renamed to a gensym bound globally
+// to the module's value, the same gensym every time.
+func closeFreeNames(env *Env, mod *Module, template *Expr, b patternBindings, renames map[string]*Expr) {
+	switch template.Type {
+	case Symbol:
+		if _, isVar := b[template.Sym]; isVar {
+			return
+		}
+		if _, done := renames[template.Sym]; done {
+			return
+		}
+		val, ok := mod.Env.local(template.Sym)
+		if !ok {
+			return
+		}
+		if here, ok := env.Lookup(template.Sym); ok && here == val {
+			return
+		}
+		renames[template.Sym] = mod.Env.interpreter().moduleRef(mod, template.Sym, val)
+	case Pair:
+		for t := template; t.Type == Pair; t = t.Tail {
+			closeFreeNames(env, mod, t.Head, b, renames)
+			if t.Tail.Type != Pair {
+				closeFreeNames(env, mod, t.Tail, b, renames)
+			}
+		}
+	}
+}
+
+func expandTemplate(tmpl *Expr, b patternBindings, renames map[string]*Expr) *Expr {
+	switch tmpl.Type {
+	case Symbol:
+		if binding, ok := b[tmpl.Sym]; ok {
+			if binding.repeated {
+				panic(errorf(ErrSyntax, "syntax-rules", "%s is followed by ... in the pattern, so must be in the template", tmpl.Sym))
+			}
+			return binding.value
+		}
+		if renamed, ok := renames[tmpl.Sym]; ok {
+			return renamed
+		}
+		return tmpl
+	case Pair:
+		// (... ...) gives a literal ellipsis
+		if tmpl.Head.Type == Symbol && tmpl.Head.Sym == "..." && tmpl.Tail.Type == Pair {
+			return tmpl.Tail.Head
+		}
+
+		var items []*Expr
+		t := tmpl
+		for ; t.Type == Pair; t = t.Tail {
+			if isEllipsis(t.Tail) {
+				// x ... ... flattens two levels of matches, and so on
+				sub, depth := t.Head, 0
+				for isEllipsis(t.Tail) {
+					depth++
+					t = t.Tail
+				}
+				items = append(items, expandRepeated(sub, depth, b, renames)...)
+				continue
+			}
+			items = append(items, expandTemplate(t.Head, b, renames))
+		}
+
+		result := expandTemplate(t, b, renames)
+		for i := len(items) - 1; i >= 0; i-- {
+			result = pair(items[i], result)
+		}
+		return result
+	default:
+		return tmpl
+	}
+}
+
+// Expand sub once for each match of the repeated pattern variables in it,
+// going depth levels of ... deep
+func expandRepeated(sub *Expr, depth int, b patternBindings, renames map[string]*Expr) []*Expr {
+	var vars []string
+	n := -1
+	for _, v := range patternVars(sub, nil, nil) {
+		binding, ok := b[v]
+		if !ok || !binding.repeated {
+			continue
+		}
+		if n >= 0 && len(binding.items) != n {
+			panic(errorf(ErrSyntax, "syntax-rules", "pattern variables before ... matched different numbers of forms"))
+		}
+		n = len(binding.items)
+		vars = append(vars, v)
+	}
+	if len(vars) == 0 {
+		panic(errorf(ErrSyntax, "syntax-rules", "... in a template must follow a pattern variable from a ... in the pattern"))
+	}
+
+	var results []*Expr
+	for i := 0; i < n; i++ {
+		inner := make(patternBindings, len(b))
+		for k, v := range b {
+			inner[k] = v
+		}
+		for _, v := range vars {
+			inner[v] = b[v].items[i]
+		}
+		if depth > 1 {
+			results = append(results, expandRepeated(sub, depth-1, inner, renames)...)
+		} else {
+			results = append(results, expandTemplate(sub, inner, renames))
+		}
+	}
+	return results
+}
@@ -0,0 +1,214 @@
+package minilisp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// Converting between Go values and Lisp ones for the Go API. Going in:
+//
+//	nil                       nil
+//	bool                      true or false
+//	ints, uints               number, or a big integer if it doesn't fit
+//	*big.Int, *big.Rat        number or rational
+//	floats                    float
+//	string                    string
+//	slices and arrays         list
+//	maps                      hash
+//	structs, struct pointers  object, see bridge.go
+//	func(...any) (any, error) builtin getting converted arguments
+//	other funcs               builtin converting to its parameter types
+//	*Expr                     itself
+//
+// and coming out numbers are int, *big.Int, *big.Rat or float64, strings,
+// symbols and keywords (without the colon) are string, lists and vectors
+// are []any, hashes are map[string]any keyed like json-stringify, errors
+// are *EvalError, objects are the struct pointer and anything else, like
+// a lambda, stays an *Expr so it can be passed back in.
+
+// A Go function Lisp can call. Lisp errors it returns are raised as they
+// are; other errors become an error raised by the function.
+type Func = func(args ...any) (any, error)
+
+func fromGo(v any) (*Expr, error) {
+	switch v := v.(type) {
+	case nil:
+		return nilExpr, nil
+	case *Expr:
+		return v, nil
+	case *EvalError:
+		return v.toExpr(), nil
+	case *big.Int:
+		return makeBigInt(new(big.Int).Set(v)), nil
+	case *big.Rat:
+		return makeRat(new(big.Rat).Set(v)), nil
+	case Func:
+		return goFunc(v), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return makeBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return makeBigInt(big.NewInt(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return makeBigInt(new(big.Int).SetUint64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return makeFloat(rv.Float()), nil
+	case reflect.String:
+		return makeStr(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nilExpr, nil
+		}
+		items := make([]*Expr, rv.Len())
+		for i := range items {
+			item, err := fromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return list(items...), nil
+	case reflect.Map:
+		// Go map order is random, so sort the keys to give the hash a
+		// fixed order
+		var entries []hashEntry
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := fromGo(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := hashKey(key); !ok {
+				return nil, fmt.Errorf("can't use %s as a hash key", describeArg(key))
+			}
+			val, err := fromGo(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, hashEntry{key, val})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return keyLess(entries[i].Key, entries[j].Key)
+		})
+
+		hash := makeHash()
+		for _, e := range entries {
+			hash.HashTable.Set(e.Key, e.Val)
+		}
+		return hash, nil
+	case reflect.Struct:
+		// A copy, so the object doesn't share memory with the caller's value
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return makeObject(ptr), nil
+	case reflect.Func:
+		if rv.IsNil() {
+			return nilExpr, nil
+		}
+		return reflectFunc(rv), nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nilExpr, nil
+		}
+		if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Struct {
+			return makeObject(rv), nil
+		}
+		return fromGo(rv.Elem().Interface())
+	}
+	return nil, fmt.Errorf("can't convert %T to a Lisp value", v)
+}
+
+// Numbers by value, other keys by type then alphabetically
+func keyLess(a, b *Expr) bool {
+	if isNumber(a) && isNumber(b) {
+		return compareNums(a, b) < 0
+	}
+	ka, _ := hashKey(a)
+	kb, _ := hashKey(b)
+	return ka < kb
+}
+
+func toGo(e *Expr) any {
+	switch e.Type {
+	case Nil:
+		return nil
+	case Bool:
+		return e == trueExpr
+	case Number:
+		return e.Num
+	case Float:
+		return e.Float
+	case BigInt:
+		return new(big.Int).Set(e.Big)
+	case Rational:
+		return new(big.Rat).Set(e.Rat)
+	case String:
+		return e.Str
+	case Symbol, Keyword:
+		return e.Sym
+	case Pair:
+		if !isList(e) {
+			return e
+		}
+		items := listToSlice(e)
+		result := make([]any, len(items))
+		for i, item := range items {
+			result[i] = toGo(item)
+		}
+		return result
+	case Vector:
+		result := make([]any, len(e.Items))
+		for i, item := range e.Items {
+			result[i] = toGo(item)
+		}
+		return result
+	case Hash:
+		result := make(map[string]any, e.HashTable.Len())
+		for _, entry := range e.HashTable.Entries() {
+			result[jsonKey(entry.Key)] = toGo(entry.Val)
+		}
+		return result
+	case Error:
+		return newError(e)
+	case Object:
+		return e.Obj.Interface()
+	}
+	return e
+}
+
+// Wrap a Go function as a builtin. It takes any number of arguments; the
+// name is filled in when it's defined.
+func goFunc(fn Func) *Expr {
+	sig := &Signature{Min: 0, Max: -1, Params: []ArgType{anyArg}, Doc: "A Go function."}
+	return &Expr{Type: Builtin, procedure: &procedure{Sig: sig, Fn: func(args []*Expr) *Expr {
+		goArgs := make([]any, len(args))
+		for i, arg := range args {
+			goArgs[i] = toGo(arg)
+		}
+		result, err := fn(goArgs...)
+		if err != nil {
+			panic(goError(sig.Name, err))
+		}
+		expr, err := fromGo(result)
+		if err != nil {
+			panic(errorf(ErrType, sig.Name, "%s", err.Error()))
+		}
+		return expr
+	}}}
+}
+
+// An error returned by a Go function as a Lisp error. An *EvalError keeps
+// its kind; anything else is a plain error raised by the function.
+func goError(name string, err error) *Expr {
+	var lispErr *EvalError
+	if errors.As(err, &lispErr) {
+		return lispErr.toExpr()
+	}
+	return errorf(ErrGeneric, name, "%s", err.Error())
+}
@@ -0,0 +1,305 @@
+package minilisp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Modules. (import name) evaluates name.lisp in an environment of its own,
+// once, and binds the names it exports where the import is. A file says
+// what it exports with a module form at the top:
+//
+//	(module math (export square cube))
+//
+// Without one everything it defines is exported. Files are found relative
+// to the file doing the import or load, then in each directory of
+// MINILISP_PATH, then relative to the working directory.
+
+type Module struct {
+	Name     string
+	Path     string // absolute path of the file, or std:name.lisp, the key in the module cache
+	Env      *Env
+	Exports  []string // nil until a module form declares them
+	declared bool
+	loader   *evaluation      // the evaluation loading it, nil once it's loaded
+	done     chan struct{}    // closed when loading finishes, whether or not it worked
+	importer *Module          // the module that imported this one first, for cycle errors
+	refs     map[string]*Expr // see moduleRef
+}
+
+// A global name for the module's binding of name, for macros to use where
+// name means something else (see closeFreeNames). It's a gensym, so can't
+// be typed, and is bound to val again each time it's used in case the
+// module has changed it since.
+func (in *Interpreter) moduleRef(mod *Module, name string, val *Expr) *Expr {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	ref, ok := mod.refs[name]
+	if !ok {
+		if mod.refs == nil {
+			mod.refs = make(map[string]*Expr)
+		}
+		ref = in.gensym(name)
+		mod.refs[name] = ref
+	}
+	in.env.Define(ref.Sym, val)
+	return ref
+}
+
+// Where to look for files loaded or imported from a file in dir, in order
+func searchDirs(dir string) []string {
+	var dirs []string
+	if dir != "" {
+		dirs = append(dirs, dir)
+	}
+	for _, d := range filepath.SplitList(os.Getenv("MINILISP_PATH")) {
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	return append(dirs, ".")
+}
+
+// The directory of the file a form was read from, or "" if it wasn't read
+// from a file (the REPL, piped input, readStr)
+func sourceDir(pos *Position) string {
+	if pos == nil || pos.File == "" || strings.HasPrefix(pos.File, "<") || isStdPath(pos.File) {
+		return ""
+	}
+	return filepath.Dir(pos.File)
+}
+
+// Find name on the search path. Absolute paths are used as they are, and
+// std: ones come from the standard library.
+func (in *Interpreter) resolvePath(name string, from *Position) (string, bool) {
+	if isStdPath(name) {
+		return in.resolveStd(name)
+	}
+	if filepath.IsAbs(name) {
+		_, err := os.Stat(name)
+		return name, err == nil
+	}
+	for _, dir := range searchDirs(sourceDir(from)) {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// The module whose top level env is, or that env was created under
+func moduleOf(env *Env) *Module {
+	for e := env; e != nil; e = e.parent {
+		if e.module != nil {
+			return e.module
+		}
+	}
+	return nil
+}
+
+// (import name) or (import name :as alias). name is a symbol or string,
+// with or without .lisp, and may have directories: (import utils/strings).
+// Exports are bound under their own names, or as alias/name with :as.
+func evalImport(args *Expr, form *Expr, env *Env) *Expr {
+	if args == nilExpr {
+		panic(errorf(ErrArity, "import", "missing module name"))
+	}
+
+	var name string
+	switch args.Head.Type {
+	case Symbol:
+		name = args.Head.Sym
+	case String:
+		name = args.Head.Str
+	default:
+		panic(errorf(ErrType, "import", "module name must be a symbol or string, got %s", printExpr(args.Head)))
+	}
+
+	alias := ""
+	if rest := args.Tail; rest != nilExpr {
+		if rest.Head.Type != Keyword || rest.Head.Sym != "as" || rest.Tail == nilExpr || rest.Tail.Head.Type != Symbol || rest.Tail.Tail != nilExpr {
+			panic(errorf(ErrSyntax, "import", "expected (import name) or (import name :as alias)"))
+		}
+		alias = rest.Tail.Head.Sym
+	}
+
+	mod := importModule(name, form.Pos, env)
+	for _, export := range mod.Exports {
+		bound := export
+		if alias != "" {
+			bound = alias + "/" + export
+		}
+		env.Define(bound, mod.Env.bindings[export])
+		if doc, ok := mod.Env.docs[export]; ok {
+			env.SetDoc(bound, doc)
+		}
+	}
+	return nilExpr
+}
+
+// Load the module called name, or return it if it's loaded already
+func importModule(name string, from *Position, env *Env) *Module {
+	file := name
+	if filepath.Ext(file) != ".lisp" {
+		file += ".lisp"
+	}
+	in := env.interpreter()
+	path, ok := in.resolvePath(file, from)
+	if !ok && isStdPath(file) {
+		panic(errorf(ErrImport, "import", "can't find module %s in the standard library", name))
+	}
+	if !ok {
+		panic(errorf(ErrImport, "import", "can't find module %s (looked for %s in %s)", name, file, strings.Join(searchDirs(sourceDir(from)), ", ")))
+	}
+	if !isStdPath(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	in.checkRead("import", path)
+
+	importer := moduleOf(env)
+	run := env.evaluation()
+	in.mu.Lock()
+	mod, ok := in.modules[path]
+	if ok && mod.loader == nil {
+		in.mu.Unlock()
+		return mod
+	}
+	if ok {
+		// Another evaluation is loading it, so wait for that rather than
+		// loading it twice, unless it's waiting for this one
+		if waitsFor(mod, run) {
+			in.mu.Unlock()
+			panic(errorf(ErrImport, "import", "import cycle: %s", importCycle(importer, mod)))
+		}
+		run.importing = mod
+		in.mu.Unlock()
+		select {
+		case <-mod.done:
+		case <-run.ctx.Done():
+		}
+		in.mu.Lock()
+		run.importing = nil
+		in.mu.Unlock()
+		run.checkContext()
+		// If it failed it's been dropped from the cache, so this tries again
+		return importModule(name, from, env)
+	}
+	mod = &Module{
+		Name:     strings.TrimSuffix(filepath.Base(strings.TrimPrefix(path, stdPrefix)), ".lisp"),
+		Path:     path,
+		Env:      NewEnv(in.env),
+		loader:   run,
+		done:     make(chan struct{}),
+		importer: importer,
+	}
+	mod.Env.module = mod
+	mod.Env.run = run
+	in.modules[path] = mod
+	in.mu.Unlock()
+
+	// A module that fails to load isn't cached, so it can be fixed and
+	// imported again
+	defer func() {
+		r := recover()
+		in.mu.Lock()
+		if r != nil {
+			delete(in.modules, path)
+		}
+		mod.loader = nil
+		in.mu.Unlock()
+		close(mod.done)
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	content, err := readSourceFile(path)
+	if err != nil {
+		panic(errorf(ErrIO, "import", "cannot read file %s: %v", path, err))
+	}
+	for _, expr := range readSource(string(content), path) {
+		eval(expr, mod.Env)
+	}
+
+	if !mod.declared {
+		for name := range mod.Env.bindings {
+			mod.Exports = append(mod.Exports, name)
+		}
+		sort.Strings(mod.Exports)
+	}
+	for _, export := range mod.Exports {
+		if _, ok := mod.Env.bindings[export]; !ok {
+			panic(errorf(ErrImport, "import", "module %s exports %s but doesn't define it", mod.Name, export))
+		}
+	}
+
+	mod.Env.run = nil
+	return mod
+}
+
+// Would waiting for mod to load wait on run? It might be run loading it,
+// or an evaluation waiting in turn for a module run is loading. Called
+// with in.mu held.
+func waitsFor(mod *Module, run *evaluation) bool {
+	for m := mod; m != nil && m.loader != nil; m = m.loader.importing {
+		if m.loader == run {
+			return true
+		}
+	}
+	return false
+}
+
+// e.g. a -> b -> a, from the module that started loading mod back round to
+// the import of it in from
+func importCycle(from, mod *Module) string {
+	names := []string{mod.Name}
+	for m := from; m != nil && m != mod; m = m.importer {
+		names = append(names, m.Name)
+	}
+	// Built from the importing end, so reverse it and close the loop
+	for i, j := 1, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(append(names, mod.Name), " -> ")
+}
+
+// (module name (export sym ...)) at the top of a file names it and says
+// which of its definitions an import gets. Outside a module being imported,
+// like in a file run with load, it does nothing.
+func evalModule(args *Expr, env *Env) *Expr {
+	if args == nilExpr || args.Head.Type != Symbol {
+		panic(errorf(ErrSyntax, "module", "expected (module name (export ...))"))
+	}
+
+	var exports []string
+	for clause := args.Tail; clause != nilExpr; clause = clause.Tail {
+		c := clause.Head
+		if c.Type != Pair || c.Head.Type != Symbol || c.Head.Sym != "export" {
+			panic(errorf(ErrSyntax, "module", "expected (export name ...), got %s", printExpr(c)))
+		}
+		for _, name := range listToSlice(c.Tail) {
+			if name.Type != Symbol {
+				panic(errorf(ErrSyntax, "module", "exported names must be symbols, got %s", printExpr(name)))
+			}
+			exports = append(exports, name.Sym)
+		}
+	}
+
+	mod := env.module
+	if mod == nil {
+		return nilExpr
+	}
+	if mod.declared {
+		panic(errorf(ErrSyntax, "module", "module %s is already declared", mod.Name))
+	}
+	mod.Name = args.Head.Sym
+	mod.Exports = exports
+	mod.declared = true
+	return nilExpr
+}
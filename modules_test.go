@@ -0,0 +1,276 @@
+package minilisp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Write files, given as name -> content, into a fresh temp directory
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Evaluate input as if it was read from a file in dir
+func evalIn(dir, input string, env *Env) *Expr {
+	var result *Expr = nilExpr
+	for _, expr := range readSource(input, filepath.Join(dir, "main.lisp")) {
+		result = eval(expr, env)
+	}
+	return result
+}
+
+func expectImportError(t *testing.T, kind, msg string, fn func()) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("should panic")
+		}
+		err := recoverError(r)
+		if err.Kind != kind || errorMessage(err) != msg {
+			t.Errorf("got %s %q, want %s %q", err.Kind, errorMessage(err), kind, msg)
+		}
+	}()
+	fn()
+}
+
+func TestImport(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"math.lisp": `(module math (export square cube))
+(define helper (lambda (x n) (if (= n 0) 1 (* x (helper x (- n 1))))))
+(define square (lambda (x) "Square x." (helper x 2)))
+(define cube (lambda (x) (helper x 3)))`,
+		"plain.lisp":       `(define a 1) (define b 2)`,
+		"lib/strings.lisp": `(define shout (lambda (s) (string-upcase s)))`,
+	})
+	env := setupFullEnv()
+	evalIn(dir, "(import math)", env)
+	evalIn(dir, "(import math :as m)", env)
+	evalIn(dir, `(import "plain")`, env)
+	evalIn(dir, "(import lib/strings)", env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(square 3)", "9"},
+		{"(cube 2)", "8"},
+		{"(m/square 4)", "16"},
+		{"(doc 'square)", `"Square x."`},
+		{"(doc 'm/square)", `"Square x."`},
+		{"(+ a b)", "3"},
+		{`(shout "hi")`, `"HI"`},
+	}
+
+	for _, tt := range tests {
+		result := evalIn(dir, tt.input, env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	// Private helpers stay in the module
+	if _, ok := env.Lookup("helper"); ok {
+		t.Error("helper shouldn't be imported")
+	}
+}
+
+func TestImportLoadsOnce(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"counter.lisp": `(set! loads (+ loads 1)) (define value loads)`,
+		"a.lisp":       `(import counter)`,
+	})
+	env := setupFullEnv()
+	env.Define("loads", makeNum(0))
+
+	evalIn(dir, "(import counter)", env)
+	evalIn(dir, "(import counter :as c)", env)
+	evalIn(dir, "(import a)", env)
+
+	if val, _ := env.Lookup("loads"); val.Num != 1 {
+		t.Errorf("counter loaded %d times, want 1", val.Num)
+	}
+
+	// A separate environment gets its own copy
+	other := setupFullEnv()
+	other.Define("loads", makeNum(0))
+	evalIn(dir, "(import counter)", other)
+	if val, _ := other.Lookup("loads"); val.Num != 1 {
+		t.Errorf("counter loaded %d times in a new env, want 1", val.Num)
+	}
+}
+
+// Evaluations importing a module at the same time share one load, rather
+// than the later ones seeing it half loaded and reporting a cycle. Each
+// imports into a let, as defining globals at once isn't safe.
+func TestConcurrentImports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"slow.lisp": `(set! loads (+ loads 1))
+(define value (let loop ((i 0)) (if (< i 20000) (loop (+ i 1)) i)))`,
+	})
+	interp := New(WithoutStdlib())
+	interp.Define("loads", 0)
+
+	src := fmt.Sprintf("(let () (import %q) value)", filepath.Join(dir, "slow"))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := interp.Eval(context.Background(), src); err != nil || got != 20000 {
+				t.Errorf("value = %v, %v, want 20000", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := interp.Eval(context.Background(), "loads"); got != 1 {
+		t.Errorf("loads = %v, want 1", got)
+	}
+}
+
+func TestImportPaths(t *testing.T) {
+	libs := writeModules(t, map[string]string{
+		"shared.lisp":     `(define shared 1)`,
+		"pkg/outer.lisp":  `(import inner) (define outer (+ inner 1))`,
+		"pkg/inner.lisp":  `(define inner 10)`,
+		"pkg/loader.lisp": `(load "data.lisp")`,
+		"pkg/data.lisp":   `(define data 42)`,
+	})
+	t.Setenv("MINILISP_PATH", libs)
+
+	// Found on MINILISP_PATH, and inner next to outer rather than in the
+	// working directory
+	env := setupFullEnv()
+	evalIn(t.TempDir(), "(import shared) (import pkg/outer)", env)
+	if got := printExpr(eval(readStr("(+ shared outer)"), env)); got != "12" {
+		t.Errorf("(+ shared outer) = %s, want 12", got)
+	}
+
+	// load is relative to the file it's in too
+	evalIn(t.TempDir(), `(load "pkg/loader.lisp")`, env)
+	if val, ok := env.Lookup("data"); !ok || val.Num != 42 {
+		t.Errorf("data = %v, want 42", val)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.lisp":     `(module a (export x)) (import b) (define x 1)`,
+		"b.lisp":     `(module b (export y)) (import a) (define y 2)`,
+		"self.lisp":  `(import self)`,
+		"liar.lisp":  `(module liar (export missing)) (define present 1)`,
+		"twice.lisp": `(module twice (export x)) (module twice (export x)) (define x 1)`,
+		"bad.lisp":   `(define ok 1) (head nil)`,
+	})
+	env := setupFullEnv()
+
+	expectImportError(t, ErrImport, "import: import cycle: a -> b -> a", func() { evalIn(dir, "(import a)", env) })
+	expectImportError(t, ErrImport, "import: import cycle: self -> self", func() { evalIn(dir, "(import self)", env) })
+	expectImportError(t, ErrImport, "import: module liar exports missing but doesn't define it", func() { evalIn(dir, "(import liar)", env) })
+	expectImportError(t, ErrSyntax, "module: module twice is already declared", func() { evalIn(dir, "(import twice)", env) })
+	expectImportError(t, ErrType, "head: argument 1 must be a pair, got nil", func() { evalIn(dir, "(import bad)", env) })
+	expectImportError(t, ErrSyntax, "import: expected (import name) or (import name :as alias)", func() { evalIn(dir, "(import a :as)", env) })
+
+	defer func() {
+		if err := recoverError(recover()); err.Kind != ErrImport {
+			t.Errorf("kind = %s, want import-error", err.Kind)
+		}
+	}()
+	evalIn(dir, "(import nowhere)", env)
+}
+
+// Failed imports aren't cached, so fixing the file and importing again works
+func TestImportRetriesAfterFailure(t *testing.T) {
+	dir := writeModules(t, map[string]string{"flaky.lisp": `(head nil)`})
+	env := setupFullEnv()
+
+	func() {
+		defer func() { recover() }()
+		evalIn(dir, "(import flaky)", env)
+	}()
+
+	if err := os.WriteFile(filepath.Join(dir, "flaky.lisp"), []byte(`(define fixed true)`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	evalIn(dir, "(import flaky)", env)
+	if _, ok := env.Lookup("fixed"); !ok {
+		t.Error("fixed should be imported")
+	}
+}
+
+func TestModuleFormUnderLoad(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"m.lisp": `(module m (export a)) (define a 1) (define b 2)`,
+	})
+	env := setupFullEnv()
+	evalIn(dir, `(load "m.lisp")`, env)
+
+	// load runs the file in place, so everything is defined
+	for _, name := range []string{"a", "b"} {
+		if _, ok := env.Lookup(name); !ok {
+			t.Errorf("%s should be defined", name)
+		}
+	}
+}
+
+func TestStdLibKeepsHelpersPrivate(t *testing.T) {
+	env := setupFullEnv()
+	loadStdLib(env)
+
+	for _, name := range []string{"sum-helper", "attrs->string"} {
+		if _, ok := env.Lookup(name); ok {
+			t.Errorf("%s shouldn't leak out of the standard library", name)
+		}
+	}
+	if got := printExpr(eval(readStr("(sum 1 2 3)"), env)); got != "6" {
+		t.Errorf("(sum 1 2 3) = %s, want 6", got)
+	}
+}
+
+// Names a macro's template uses are looked up in the macro's module, even
+// when they're bound under another name, or something else, where it's used
+func TestImportMacrosWithAlias(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.lisp": `(module lib (export twice))
+(define helper (lambda (x) (* 2 x)))
+(define twice (syntax-rules () ((_ x) (helper x))))`,
+	})
+	env := setupFullEnv()
+	evalIn(dir, "(import std:macro :as m) (import lib :as l)", env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(m/-> 5 (* 2) (+ 3))", "13"},
+		{"(m/->> 5 (* 2) (- 3))", "-7"},
+		{"(m/cond ((= 1 2) 'a) ((= 1 1) 'b))", "b"},
+		{"(l/twice 4)", "8"},
+		// A local helper doesn't capture the module's
+		{"(let ((helper list)) (l/twice 5))", "10"},
+		{"(macroexpand-1 '(m/-> 5 (* 2)))", "(->#1 (* 5 2))"},
+	}
+
+	for _, tt := range tests {
+		result := evalIn(dir, tt.input, env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
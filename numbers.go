@@ -0,0 +1,362 @@
+package minilisp
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The numeric tower, lowest to highest. Arithmetic promotes both operands
+// to the higher of their two ranks, and exact results are demoted again
+// when they fit (a big int that fits in an int, a rational over 1).
+const (
+	rankInt = iota
+	rankBig
+	rankRat
+	rankFloat
+)
+
+func isNumber(e *Expr) bool {
+	switch e.Type {
+	case Number, BigInt, Rational, Float:
+		return true
+	}
+	return false
+}
+
+func numRank(e *Expr) int {
+	switch e.Type {
+	case BigInt:
+		return rankBig
+	case Rational:
+		return rankRat
+	case Float:
+		return rankFloat
+	default:
+		return rankInt
+	}
+}
+
+func toBig(e *Expr) *big.Int {
+	if e.Type == BigInt {
+		return e.Big
+	}
+	return big.NewInt(int64(e.Num))
+}
+
+func toRat(e *Expr) *big.Rat {
+	switch e.Type {
+	case Rational:
+		return e.Rat
+	case BigInt:
+		return new(big.Rat).SetInt(e.Big)
+	default:
+		return new(big.Rat).SetInt64(int64(e.Num))
+	}
+}
+
+func toFloat(e *Expr) float64 {
+	switch e.Type {
+	case Float:
+		return e.Float
+	case BigInt:
+		f, _ := new(big.Float).SetInt(e.Big).Float64()
+		return f
+	case Rational:
+		f, _ := e.Rat.Float64()
+		return f
+	default:
+		return float64(e.Num)
+	}
+}
+
+// Integer arithmetic that reports overflow instead of wrapping
+
+func addInt(a, b int) (int, bool) {
+	s := a + b
+	return s, (s > a) == (b > 0)
+}
+
+func subInt(a, b int) (int, bool) {
+	s := a - b
+	return s, (s < a) == (b > 0)
+}
+
+func mulInt(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	p := a * b
+	if p/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return p, false
+	}
+	return p, true
+}
+
+// Apply + - or * to two numbers
+func arith(op byte, a, b *Expr) *Expr {
+	rank := max(numRank(a), numRank(b))
+
+	if rank == rankInt {
+		var n int
+		var ok bool
+		switch op {
+		case '+':
+			n, ok = addInt(a.Num, b.Num)
+		case '-':
+			n, ok = subInt(a.Num, b.Num)
+		case '*':
+			n, ok = mulInt(a.Num, b.Num)
+		}
+		if ok {
+			return makeNum(n)
+		}
+		rank = rankBig // overflowed, redo it with big ints
+	}
+
+	switch rank {
+	case rankBig:
+		x, y, z := toBig(a), toBig(b), new(big.Int)
+		switch op {
+		case '+':
+			z.Add(x, y)
+		case '-':
+			z.Sub(x, y)
+		case '*':
+			z.Mul(x, y)
+		}
+		return makeBigInt(z)
+	case rankRat:
+		x, y, z := toRat(a), toRat(b), new(big.Rat)
+		switch op {
+		case '+':
+			z.Add(x, y)
+		case '-':
+			z.Sub(x, y)
+		case '*':
+			z.Mul(x, y)
+		}
+		return makeRat(z)
+	default:
+		x, y := toFloat(a), toFloat(b)
+		switch op {
+		case '+':
+			return makeFloat(x + y)
+		case '-':
+			return makeFloat(x - y)
+		default:
+			return makeFloat(x * y)
+		}
+	}
+}
+
+// Divide two numbers. Exact division stays exact, so (/ 7 2) is 7/2.
+func divide(name string, a, b *Expr) *Expr {
+	if isZero(b) {
+		panic(errorf(ErrArith, name, "division by zero"))
+	}
+
+	switch max(numRank(a), numRank(b)) {
+	case rankInt:
+		if a.Num%b.Num == 0 && !(a.Num == math.MinInt && b.Num == -1) {
+			return makeNum(a.Num / b.Num)
+		}
+		return makeRat(new(big.Rat).SetFrac(toBig(a), toBig(b)))
+	case rankBig, rankRat:
+		return makeRat(new(big.Rat).Quo(toRat(a), toRat(b)))
+	default:
+		return makeFloat(toFloat(a) / toFloat(b))
+	}
+}
+
+func isZero(e *Expr) bool {
+	switch e.Type {
+	case Float:
+		return e.Float == 0
+	case BigInt:
+		return e.Big.Sign() == 0
+	case Rational:
+		return e.Rat.Sign() == 0
+	default:
+		return e.Num == 0
+	}
+}
+
+// Compare two numbers, returning -1, 0 or 1
+func compareNums(a, b *Expr) int {
+	switch max(numRank(a), numRank(b)) {
+	case rankInt:
+		switch {
+		case a.Num < b.Num:
+			return -1
+		case a.Num > b.Num:
+			return 1
+		}
+		return 0
+	case rankBig:
+		return toBig(a).Cmp(toBig(b))
+	case rankRat:
+		return toRat(a).Cmp(toRat(b))
+	default:
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+}
+
+// Parse a numeric literal: 42, -7, 3.14, 1e10, 1/3 or an integer too big
+// for an int. ok is false if the text isn't a number.
+func parseNumber(s string) (*Expr, bool) {
+	body := strings.TrimLeft(s, "+-")
+	if body == "" || !(isDigit(body[0]) || (body[0] == '.' && len(body) > 1 && isDigit(body[1]))) {
+		return nil, false
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		return makeNum(n), true
+	}
+	if b, ok := new(big.Int).SetString(s, 10); ok {
+		return makeBigInt(b), true
+	}
+	if strings.Contains(s, "/") {
+		if r, ok := new(big.Rat).SetString(s); ok {
+			return makeRat(r), true
+		}
+		return nil, false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return makeFloat(f), true
+	}
+	return nil, false
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// Floats always print with a decimal point or exponent so they read back
+// as floats, e.g. 2.0 rather than 2
+func formatFloat(f float64) string {
+	var s string
+	if abs := math.Abs(f); abs == 0 || (abs >= 1e-6 && abs < 1e21) {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	} else {
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
+// Numeric builtins beyond the basic arithmetic in funcs.go
+
+func builtinQuotient(args []*Expr) *Expr {
+	a, b := integerArgs("quotient", args)
+	return makeBigInt(new(big.Int).Quo(a, b))
+}
+
+func builtinRemainder(args []*Expr) *Expr {
+	a, b := integerArgs("remainder", args)
+	return makeBigInt(new(big.Int).Rem(a, b))
+}
+
+// Like remainder but takes the sign of the divisor
+func builtinModulo(args []*Expr) *Expr {
+	a, b := integerArgs("modulo", args)
+	m := new(big.Int).Rem(a, b)
+	if m.Sign() != 0 && m.Sign() != b.Sign() {
+		m.Add(m, b)
+	}
+	return makeBigInt(m)
+}
+
+func integerArgs(name string, args []*Expr) (*big.Int, *big.Int) {
+	if isZero(args[1]) {
+		panic(errorf(ErrArith, name, "division by zero"))
+	}
+	return toBig(args[0]), toBig(args[1])
+}
+
+func builtinIntegerP(args []*Expr) *Expr {
+	return makeBool(args[0].Type == Number || args[0].Type == BigInt)
+}
+
+func builtinRationalP(args []*Expr) *Expr {
+	switch args[0].Type {
+	case Number, BigInt, Rational:
+		return trueExpr
+	}
+	return falseExpr
+}
+
+func builtinFloatP(args []*Expr) *Expr {
+	return makeBool(args[0].Type == Float)
+}
+
+func builtinToFloat(args []*Expr) *Expr {
+	return makeFloat(toFloat(args[0]))
+}
+
+func builtinFloor(args []*Expr) *Expr {
+	return roundNumber("floor", args, math.Floor, ratFloor)
+}
+
+func builtinCeiling(args []*Expr) *Expr {
+	return roundNumber("ceiling", args, math.Ceil, ratCeiling)
+}
+
+func builtinRound(args []*Expr) *Expr {
+	return roundNumber("round", args, math.Round, ratRound)
+}
+
+// floor, ceiling and round give exact integers for any number
+func roundNumber(name string, args []*Expr, floatMode func(float64) float64, ratMode func(*big.Rat) *big.Int) *Expr {
+	arg := args[0]
+
+	switch arg.Type {
+	case Float:
+		f := floatMode(arg.Float)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			panic(errorf(ErrArith, name, "cannot round %s", formatFloat(f)))
+		}
+		b, _ := big.NewFloat(f).Int(nil)
+		return makeBigInt(b)
+	case Rational:
+		return makeBigInt(ratMode(arg.Rat))
+	default:
+		return arg
+	}
+}
+
+func ratFloor(r *big.Rat) *big.Int {
+	// Quo truncates toward zero, so step down for negative fractions
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() < 0 {
+		q.Sub(q, big.NewInt(1))
+	}
+	return q
+}
+
+func ratCeiling(r *big.Rat) *big.Int {
+	q := ratFloor(r)
+	if r.IsInt() {
+		return q
+	}
+	return q.Add(q, big.NewInt(1))
+}
+
+// Round half away from zero, matching math.Round
+func ratRound(r *big.Rat) *big.Int {
+	if r.Sign() < 0 {
+		q := ratRound(new(big.Rat).Neg(r))
+		return q.Neg(q)
+	}
+	return ratFloor(new(big.Rat).Add(r, big.NewRat(1, 2)))
+}
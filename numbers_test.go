@@ -0,0 +1,241 @@
+package minilisp
+
+import "testing"
+
+func TestReadNumericLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantType ExprType
+		want     string
+	}{
+		{"42", Number, "42"},
+		{"-7", Number, "-7"},
+		{"+7", Number, "7"},
+		{"3.14", Float, "3.14"},
+		{"-0.5", Float, "-0.5"},
+		{".5", Float, "0.5"},
+		{"2.0", Float, "2.0"},
+		{"1e10", Float, "10000000000.0"},
+		{"1.5e-300", Float, "1.5e-300"},
+		{"1/3", Rational, "1/3"},
+		{"-2/4", Rational, "-1/2"},
+		{"4/2", Number, "2"},
+		{"123456789012345678901234567890", BigInt, "123456789012345678901234567890"},
+	}
+
+	for _, tt := range tests {
+		expr := readStr(tt.input)
+		if expr.Type != tt.wantType {
+			t.Errorf("readStr(%q) type = %v, want %v", tt.input, expr.Type, tt.wantType)
+		}
+		if got := printExpr(expr); got != tt.want {
+			t.Errorf("printExpr(readStr(%q)) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNumberLikeSymbols(t *testing.T) {
+	for _, input := range []string{"-", "+", "->", "->>", "1+", "inf", "nan", "..."} {
+		expr := readStr(input)
+		if expr.Type != Symbol {
+			t.Errorf("readStr(%q) type = %v, want Symbol", input, expr.Type)
+		}
+	}
+}
+
+func TestNumericTowerArithmetic(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(+ 1 2.5)", "3.5"},
+		{"(+ 1/3 1/6)", "1/2"},
+		{"(+ 1/2 1/2)", "1"},
+		{"(* 1/3 3)", "1"},
+		{"(+ 1/2 0.25)", "0.75"},
+		{"(- 1 1/3)", "2/3"},
+		{"(* 2 0.5)", "1.0"},
+		{"(+ 0.1 0.2)", "0.30000000000000004"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBigIntPromotion(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input    string
+		wantType ExprType
+		want     string
+	}{
+		{"(+ 9223372036854775807 1)", BigInt, "9223372036854775808"},
+		{"(- -9223372036854775808 1)", BigInt, "-9223372036854775809"},
+		{"(* 9223372036854775807 2)", BigInt, "18446744073709551614"},
+		{"(* 4294967296 4294967296)", BigInt, "18446744073709551616"},
+		// Results that fit in an int go back to plain numbers
+		{"(- (+ 9223372036854775807 1) 1)", Number, "9223372036854775807"},
+		{"(/ 18446744073709551616 4294967296)", Number, "4294967296"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if result.Type != tt.wantType {
+			t.Errorf("%s type = %v, want %v", tt.input, result.Type, tt.wantType)
+		}
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFactorialOfTwentyFive(t *testing.T) {
+	env := setupFullEnv()
+
+	eval(readStr(`(define fact (lambda (n) (if (= n 0) 1 (* n (fact (- n 1))))))`), env)
+	result := eval(readStr("(fact 25)"), env)
+
+	if got := printExpr(result); got != "15511210043330985984000000" {
+		t.Errorf("(fact 25) = %s, want 15511210043330985984000000", got)
+	}
+}
+
+func TestNumericComparison(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input    string
+		wantTrue bool
+	}{
+		{"(= 1 1.0)", true},
+		{"(= 1/2 0.5)", true},
+		{"(= 1/3 0.3)", false},
+		{"(< 1/3 0.34)", true},
+		{"(< 99999999999999999999 1)", false},
+		{"(>= 2.5 5/2)", true},
+		{"(< -1.5 -1)", true},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if isTrue := result == trueExpr; isTrue != tt.wantTrue {
+			t.Errorf("%s = %v, want %v", tt.input, isTrue, tt.wantTrue)
+		}
+	}
+}
+
+func TestIntegerDivisionBuiltins(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(quotient 7 2)", "3"},
+		{"(quotient -7 2)", "-3"},
+		{"(remainder 7 2)", "1"},
+		{"(remainder -7 2)", "-1"},
+		{"(modulo -7 2)", "1"},
+		{"(modulo 7 -2)", "-1"},
+		{"(floor 7/2)", "3"},
+		{"(floor -7/2)", "-4"},
+		{"(ceiling 7/2)", "4"},
+		{"(round 5/2)", "3"},
+		{"(round -5/2)", "-3"},
+		{"(round 2.4)", "2"},
+		{"(floor 1e20)", "100000000000000000000"},
+		{"(@float 1/4)", "0.25"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestArithmeticTypeError(t *testing.T) {
+	env := setupFullEnv()
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal(`(+ 1 "x") should panic`)
+		}
+		err := recoverError(r)
+		if err.Kind != ErrType {
+			t.Errorf("kind = %s, want type-error", err.Kind)
+		}
+		if got := errorMessage(err); got != `+: argument 2 must be a number, got string "x"` {
+			t.Errorf("message = %q", got)
+		}
+	}()
+
+	eval(readStr(`(+ 1 "x")`), env)
+}
+
+func TestJsonNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantType ExprType
+		want     string
+	}{
+		{`42`, Number, "42"},
+		{`19.99`, Float, "19.99"},
+		{`-0.000123`, Float, "-0.000123"},
+		{`1e3`, Float, "1000.0"},
+		{`12345678901234567890123`, BigInt, "12345678901234567890123"},
+	}
+
+	for _, tt := range tests {
+		result := builtinJsonParse([]*Expr{makeStr(tt.input)})
+		if result.Type != tt.wantType {
+			t.Errorf("@json %s type = %v, want %v", tt.input, result.Type, tt.wantType)
+		}
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("@json %s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestJsonNumberRoundTrip(t *testing.T) {
+	inputs := []string{
+		`{"price":19.99}`,
+		`[51.5074,-0.1278]`,
+		`[12345678901234567890123,1,2.5]`,
+	}
+
+	for _, input := range inputs {
+		parsed := builtinJsonParse([]*Expr{makeStr(input)})
+		result := builtinJsonStringify([]*Expr{parsed})
+		if result.Str != input {
+			t.Errorf("round trip of %s = %s", input, result.Str)
+		}
+	}
+}
+
+func TestToNumberParsesTower(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"3.14", "3.14"},
+		{"1/3", "1/3"},
+		{" 42 ", "42"},
+	}
+
+	for _, tt := range tests {
+		result := builtinToNumber([]*Expr{makeStr(tt.input)})
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("@number %q = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
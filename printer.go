@@ -1,9 +1,10 @@
-package main
+package minilisp
 
 import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 func printExpr(e *Expr) string {
@@ -26,10 +27,18 @@ func printExpr(e *Expr) string {
 		return printHash(e)
 	case Number:
 		return strconv.Itoa(e.Num)
+	case Float:
+		return formatFloat(e.Float)
+	case BigInt:
+		return e.Big.String()
+	case Rational:
+		return e.Rat.RatString()
 	case String:
-		return fmt.Sprintf("\"%s\"", e.Str)
+		return quoteString(e.Str)
 	case Symbol:
 		return e.Sym
+	case Keyword:
+		return ":" + e.Sym
 	case Builtin:
 		return "<builtin>"
 	case Lambda:
@@ -38,23 +47,26 @@ func printExpr(e *Expr) string {
 		return "<macro>"
 	case Pair:
 		return printList(e)
+	case Vector:
+		return printVector(e)
+	case Error:
+		return fmt.Sprintf("#<%s: %s>", e.Kind, errorMessage(e))
+	case Object:
+		return printObject(e)
 	default:
 		return "<unknown>"
 	}
 
 }
 
+// Hashes print in the {key value ...} literal syntax, in insertion order
 func printHash(e *Expr) string {
-	if len(e.HashTable) == 0 {
-		return "{}"
-	}
-
 	parts := []string{}
-	for k, v := range e.HashTable {
-		parts = append(parts, fmt.Sprintf("%q: %s", k, printExpr(v)))
+	for _, entry := range e.HashTable.Entries() {
+		parts = append(parts, printExpr(entry.Key), printExpr(entry.Val))
 	}
 
-	return "{" + strings.Join(parts, ", ") + "}"
+	return "{" + strings.Join(parts, " ") + "}"
 }
 
 func printList(e *Expr) string {
@@ -73,3 +85,42 @@ func printList(e *Expr) string {
 
 	return "(" + strings.Join(parts, " ") + ")"
 }
+
+func printVector(e *Expr) string {
+	parts := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		parts[i] = printExpr(item)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Quote a string using the escapes the reader understands, so printed
+// strings read back as the same string
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case 0:
+			sb.WriteString(`\0`)
+		default:
+			if unicode.IsControl(ch) {
+				fmt.Fprintf(&sb, "\\u{%x}", ch)
+			} else {
+				sb.WriteRune(ch)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
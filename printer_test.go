@@ -1,4 +1,4 @@
-package main
+package minilisp
 
 import "testing"
 
@@ -124,3 +124,25 @@ func TestPrintImproperList(t *testing.T) {
 		t.Errorf("printExpr((1 . 2)) = %q, want %q", got, want)
 	}
 }
+
+func TestPrintString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"hello", `"hello"`},
+		{"", `""`},
+		{"a\nb", `"a\nb"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"\x1b[0m", `"\u{1b}[0m"`},
+		{"café", `"café"`},
+	}
+
+	for _, tt := range tests {
+		got := printExpr(makeStr(tt.input))
+		if got != tt.want {
+			t.Errorf("printExpr(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
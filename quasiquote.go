@@ -0,0 +1,73 @@
+package minilisp
+
+// Expand a quasiquote template. depth is the quasiquote nesting level:
+// unquotes only evaluate at depth 1, deeper ones are rebuilt with their
+// level reduced so an inner quasiquote can expand them later.
+//
+//	`(a ,b ,@c)        → (a <b> <elements of c>)
+//	`(a `(b ,(c ,d)))  → (a (quasiquote (b (unquote (c <d>)))))
+func quasiquote(x *Expr, env *Env, depth int) *Expr {
+	if x.Type == Vector {
+		// `[a ,b ,@c] works like the list version
+		return makeVector(listToSlice(quasiquoteList(list(x.Items...), env, depth)))
+	}
+	if x.Type != Pair {
+		return x
+	}
+
+	if isForm(x, "unquote") {
+		if depth == 1 {
+			return eval(x.Tail.Head, env)
+		}
+		// Expanded as a list so ,,@x splices into the unquote form
+		return pair(x.Head, quasiquoteList(x.Tail, env, depth-1))
+	}
+	if isForm(x, "quasiquote") {
+		return pair(x.Head, quasiquoteList(x.Tail, env, depth+1))
+	}
+	if isForm(x, "unquote-splicing") && depth == 1 {
+		panic(errorf(ErrSyntax, "quasiquote", "unquote-splicing must be inside a list"))
+	}
+
+	return quasiquoteList(x, env, depth)
+}
+
+// Expand the elements of a list template, splicing in ,@ values
+func quasiquoteList(x *Expr, env *Env, depth int) *Expr {
+	var items []*Expr
+	for ; x.Type == Pair; x = x.Tail {
+		// `(a . ,b) reads as (a unquote b), so an unquote in the tail
+		// unquotes the rest of the list
+		if isForm(x, "unquote") {
+			break
+		}
+
+		item := x.Head
+		if isForm(item, "unquote-splicing") {
+			if depth == 1 {
+				spliced := eval(item.Tail.Head, env)
+				if spliced != nilExpr && spliced.Type != Pair {
+					panic(errorf(ErrType, "unquote-splicing", "expected a list, got %s", printExpr(spliced)))
+				}
+				items = append(items, listToSlice(spliced)...)
+				continue
+			}
+			items = append(items, pair(item.Head, quasiquoteList(item.Tail, env, depth-1)))
+			continue
+		}
+		items = append(items, quasiquote(item, env, depth))
+	}
+
+	// Anything left is the tail of an improper list
+	result := quasiquote(x, env, depth)
+	for i := len(items) - 1; i >= 0; i-- {
+		result = pair(items[i], result)
+	}
+	return result
+}
+
+// Is x a two element list starting with the symbol name, e.g. (unquote x)?
+func isForm(x *Expr, name string) bool {
+	return x.Type == Pair && x.Head.Type == Symbol && x.Head.Sym == name &&
+		x.Tail.Type == Pair && x.Tail.Tail == nilExpr
+}
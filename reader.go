@@ -1,13 +1,58 @@
-package main
+package minilisp
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// Source location of a form, used in error traces
+type Position struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (p *Position) String() string {
+	file := p.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d:%d", file, p.Line, p.Col)
+}
+
 type Reader struct {
-	input string
-	pos   int
+	input      string
+	pos        int
+	file       string
+	lineStarts []int // byte offset of each line, built on first use
+}
+
+// Line and column (both 1-based) of the current read position
+func (r *Reader) position() *Position {
+	if r.lineStarts == nil {
+		r.lineStarts = []int{0}
+		for i := 0; i < len(r.input); i++ {
+			if r.input[i] == '\n' {
+				r.lineStarts = append(r.lineStarts, i+1)
+			}
+		}
+	}
+
+	line := sort.Search(len(r.lineStarts), func(i int) bool {
+		return r.lineStarts[i] > r.pos
+	})
+	return &Position{File: r.file, Line: line, Col: r.pos - r.lineStarts[line-1] + 1}
+}
+
+// Syntax error at the current read position
+func (r *Reader) errorf(format string, args ...interface{}) *Expr {
+	err := errorf(ErrSyntax, "read", format, args...)
+	err.Pos = r.position()
+	return err
 }
 
 func (r *Reader) skipWhitespace() {
@@ -60,51 +105,133 @@ func (r *Reader) readExpr() *Expr {
 		return r.readStr()
 	}
 
-	// Quote sugar: 'x → (quote x)
-	if ch == '\'' {
+	// Quote sugar: 'x → (quote x), `x → (quasiquote x),
+	// ,x → (unquote x) and ,@x → (unquote-splicing x)
+	if ch == '\'' || ch == '`' || ch == ',' {
+		start := r.position()
 		r.next()
-		return list(makeSym("quote"), r.readExpr())
+		name := "quote"
+		switch {
+		case ch == '`':
+			name = "quasiquote"
+		case ch == ',' && r.peek() == '@':
+			r.next()
+			name = "unquote-splicing"
+		case ch == ',':
+			name = "unquote"
+		}
+		quoted := list(makeSym(name), r.readExpr())
+		quoted.Pos = start
+		return quoted
 	}
 
 	// List: (...)
 	if ch == '(' {
+		start := r.position()
 		r.next()
-		return r.readList()
+		lst := r.readList()
+		if lst.Type == Pair {
+			lst.Pos = start
+		}
+		return lst
 	}
 
-	// Error: unexpected closing paren
-	if ch == ')' {
-		panic("unexpected )")
+	// Vector: [...] or #[...]
+	if ch == '[' || (ch == '#' && r.pos+1 < len(r.input) && r.input[r.pos+1] == '[') {
+		if ch == '#' {
+			r.next()
+		}
+		r.next()
+		return r.readVector()
 	}
 
-	// Number: 42, -10
-	if unicode.IsDigit(rune(ch)) || (ch == '-' && r.pos+1 < len(r.input) && unicode.IsDigit(rune(r.input[r.pos+1]))) {
-		return r.readNumber()
+	// Hash: {key value ...} → (hash key value ...)
+	if ch == '{' {
+		start := r.position()
+		r.next()
+		h := pair(makeSym("hash"), r.readHashLiteral())
+		h.Pos = start
+		return h
 	}
 
+	// Error: unexpected closing paren or bracket
+	if ch == ')' || ch == ']' || ch == '}' {
+		panic(r.errorf("unexpected %c", ch))
+	}
+
+	// Number: 42, -10, 3.14, 1e10, 1/3
 	// Symbol: x, +, factorial
-	return r.readSymbol()
+	return r.readAtom()
 }
 
 func (r *Reader) readStr() *Expr {
 	r.next() // skip the opening quote
-	start := r.pos
+	var sb strings.Builder
 
 	for {
-		ch := r.peek()
-		if ch == 0 {
-			panic("unterminated string")
-		}
-		if ch == '"' {
-			break
+		ch := r.next()
+		switch ch {
+		case 0:
+			panic(r.errorf("unterminated string"))
+		case '"':
+			return makeStr(sb.String())
+		case '\\':
+			sb.WriteRune(r.readEscape())
+		default:
+			// Multi-byte UTF-8 sequences are copied through byte by byte
+			sb.WriteByte(ch)
 		}
-		// TODO - Handle escape sequences
+	}
+}
+
+// Read the rest of an escape sequence after the backslash:
+// \n \t \r \0 \\ \" \uXXXX or \u{X...}
+func (r *Reader) readEscape() rune {
+	ch := r.next()
+	switch ch {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	case '\\', '"':
+		return rune(ch)
+	case 'u':
+		return r.readUnicodeEscape()
+	case 0:
+		panic(r.errorf("unterminated string"))
+	default:
+		r.pos--
+		panic(r.errorf("unknown escape sequence \\%c", ch))
+	}
+}
+
+func (r *Reader) readUnicodeEscape() rune {
+	var digits string
+	if r.peek() == '{' {
 		r.next()
+		end := strings.IndexByte(r.input[r.pos:], '}')
+		if end < 0 {
+			panic(r.errorf("unterminated \\u{...} escape"))
+		}
+		digits = r.input[r.pos : r.pos+end]
+		r.pos += end + 1
+	} else {
+		if r.pos+4 > len(r.input) {
+			panic(r.errorf("\\u escape needs 4 hex digits"))
+		}
+		digits = r.input[r.pos : r.pos+4]
+		r.pos += 4
 	}
-	str := r.input[start:r.pos]
-	r.next()
-	return makeStr(str)
 
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || digits == "" || !utf8.ValidRune(rune(code)) {
+		panic(r.errorf("invalid unicode escape \\u%s", digits))
+	}
+	return rune(code)
 }
 
 func (r *Reader) readList() *Expr {
@@ -116,44 +243,77 @@ func (r *Reader) readList() *Expr {
 		return nilExpr
 	}
 
+	if r.peek() == 0 {
+		panic(r.errorf("unexpected end of input, missing )"))
+	}
+
 	// Read elements until )
+	start := r.position()
 	head := r.readExpr()
 	tail := r.readList()
-	return pair(head, tail)
+	cell := pair(head, tail)
+	cell.Pos = start
+	return cell
 }
 
-func (r *Reader) readNumber() *Expr {
-	start := r.pos
-
-	// Handle negative sign
-	if r.peek() == '-' {
-		r.next()
+func (r *Reader) readVector() *Expr {
+	items := []*Expr{}
+	for {
+		r.skipWhitespace()
+		switch r.peek() {
+		case ']':
+			r.next()
+			return makeVector(items)
+		case 0:
+			panic(r.errorf("unexpected end of input, missing ]"))
+		}
+		items = append(items, r.readExpr())
 	}
+}
 
-	// Read digits
-	for unicode.IsDigit(rune(r.peek())) {
-		r.next()
+func (r *Reader) readHashLiteral() *Expr {
+	var items []*Expr
+	for {
+		r.skipWhitespace()
+		switch r.peek() {
+		case '}':
+			if len(items)%2 != 0 {
+				panic(r.errorf("hash literal needs a value for every key"))
+			}
+			r.next()
+			return list(items...)
+		case 0:
+			panic(r.errorf("unexpected end of input, missing }"))
+		}
+		items = append(items, r.readExpr())
 	}
-
-	numStr := r.input[start:r.pos]
-	n, _ := strconv.Atoi(numStr)
-	return makeNum(n)
 }
 
-func (r *Reader) readSymbol() *Expr {
+func (r *Reader) readAtom() *Expr {
 	start := r.pos
 
 	// Read until whitespace or special character
 	for {
 		ch := r.peek()
-		if ch == 0 || unicode.IsSpace(rune(ch)) || ch == '(' || ch == ')' {
+		if ch == 0 || unicode.IsSpace(rune(ch)) || ch == '(' || ch == ')' || ch == '[' || ch == ']' || ch == '{' || ch == '}' || ch == ',' || ch == '`' {
 			break
 		}
 		r.next()
 	}
 
-	sym := r.input[start:r.pos]
-	return makeSym(sym)
+	token := r.input[start:r.pos]
+	if num, ok := parseNumber(token); ok {
+		return num
+	}
+	// # is kept for gensyms, so a name the user types is never one
+	if i := strings.IndexByte(token, '#'); i >= 0 {
+		r.pos = start + i
+		panic(r.errorf("# can't be used in a name"))
+	}
+	if len(token) > 1 && token[0] == ':' {
+		return makeKeyword(token[1:])
+	}
+	return makeSym(token)
 }
 
 // Helper function to read from a string
@@ -164,7 +324,12 @@ func readStr(s string) *Expr {
 
 // Read multiple expressions from input (used for loading files and piped input)
 func readMultipleExprs(input string) []*Expr {
-	r := &Reader{input: input}
+	return readSource(input, "")
+}
+
+// Read multiple expressions, recording file in the position of each form
+func readSource(input, file string) []*Expr {
+	r := &Reader{input: input, file: file}
 	var exprs []*Expr
 
 	for {
@@ -1,4 +1,4 @@
-package main
+package minilisp
 
 import "testing"
 
@@ -297,6 +297,80 @@ func TestReadMultipleStrings(t *testing.T) {
 	}
 }
 
+func TestReadStringEscapes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"tab\there"`, "tab\there"},
+		{`"\r\n"`, "\r\n"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"nul\0"`, "nul\x00"},
+		{`"caf\u00e9"`, "café"},
+		{`"\u{1F600}"`, "😀"},
+		{`"café"`, "café"},
+		{`"日本語"`, "日本語"},
+	}
+
+	for _, tt := range tests {
+		expr := readStr(tt.input)
+		if expr.Type != String {
+			t.Errorf("readStr(%q) type = %v, want String", tt.input, expr.Type)
+		}
+		if expr.Str != tt.want {
+			t.Errorf("readStr(%q) = %q, want %q", tt.input, expr.Str, tt.want)
+		}
+	}
+}
+
+func TestReadBadStringEscapes(t *testing.T) {
+	inputs := []string{
+		`"\q"`,
+		`"\u12"`,
+		`"\uZZZZ"`,
+		`"\u{110000}"`,
+		`"\u{}"`,
+		`"unterminated\"`,
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("readStr(%q) should panic", input)
+				}
+				if err := recoverError(r); err.Kind != ErrSyntax {
+					t.Errorf("readStr(%q) kind = %s, want syntax-error", input, err.Kind)
+				}
+			}()
+			readStr(input)
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	strs := []string{
+		"plain",
+		"line one\nline two",
+		`quotes "inside"`,
+		`C:\path\to`,
+		"tab\tand\rreturn",
+		"bell\a and nul\x00",
+		"ünïcödé 😀",
+	}
+
+	for _, s := range strs {
+		printed := printExpr(makeStr(s))
+		reread := readStr(printed)
+		if reread.Type != String || reread.Str != s {
+			t.Errorf("%q printed as %s read back as %q", s, printed, reread.Str)
+		}
+	}
+}
+
 func TestReadStringWithWhitespace(t *testing.T) {
 	tests := []struct {
 		input string
@@ -326,3 +400,114 @@ func TestReadStringWithWhitespace(t *testing.T) {
 		}
 	}
 }
+
+func TestReadPositions(t *testing.T) {
+	exprs := readSource("(define x 1)\n\n  (print\n    (+ x 1))", "test.lisp")
+	if len(exprs) != 2 {
+		t.Fatalf("readSource = %d expressions, want 2", len(exprs))
+	}
+
+	tests := []struct {
+		expr *Expr
+		want string
+	}{
+		{exprs[0], "test.lisp:1:1"},
+		{exprs[1], "test.lisp:3:3"},
+		{exprs[1].Tail, "test.lisp:4:5"},      // cell holding (+ x 1)
+		{exprs[1].Tail.Head, "test.lisp:4:5"}, // the (+ x 1) list itself
+	}
+
+	for _, tt := range tests {
+		if tt.expr.Pos == nil {
+			t.Errorf("%s has no position, want %s", printExpr(tt.expr), tt.want)
+			continue
+		}
+		if got := tt.expr.Pos.String(); got != tt.want {
+			t.Errorf("position of %s = %s, want %s", printExpr(tt.expr), got, tt.want)
+		}
+	}
+}
+
+func TestReadUnterminatedList(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("unterminated list should panic")
+		}
+		err := recoverError(r)
+		if err.Kind != ErrSyntax || err.Pos == nil {
+			t.Errorf("got %s at %v, want syntax-error with a position", err.Kind, err.Pos)
+		}
+	}()
+
+	readStr("(+ 1 (* 2 3)")
+}
+
+func TestReadQuasiquoteSugar(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"`x", "(quasiquote x)"},
+		{",x", "(unquote x)"},
+		{",@x", "(unquote-splicing x)"},
+		{"`(a ,b ,@c)", "(quasiquote (a (unquote b) (unquote-splicing c)))"},
+		{"`(a,b)", "(quasiquote (a (unquote b)))"},
+		{"``,,x", "(quasiquote (quasiquote (unquote (unquote x))))"},
+	}
+
+	for _, tt := range tests {
+		if got := printExpr(readStr(tt.input)); got != tt.want {
+			t.Errorf("readStr(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestReadVector(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"[1 2 3]", "[1 2 3]"},
+		{"#[1 2 3]", "[1 2 3]"},
+		{"[ ]", "[]"},
+		{"[a [b] (c d)]", "[a [b] (c d)]"},
+		{"(f [x]y)", "(f [x] y)"},
+		{"[\"a\" ; comment\n 1]", "[\"a\" 1]"},
+	}
+
+	for _, tt := range tests {
+		if got := printExpr(readStr(tt.input)); got != tt.want {
+			t.Errorf("read %q = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"[1 2", "]", "(1 ])"} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || recoverError(r).Kind != ErrSyntax {
+					t.Errorf("read %q = %v, want a syntax-error", input, r)
+				}
+			}()
+			readStr(input)
+		}()
+	}
+}
+
+// # is kept for gensyms
+func TestReadHashInName(t *testing.T) {
+	for _, input := range []string{"g#1", "tmp#", ":a#b", "(define x#2 1)"} {
+		t.Run(input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("readStr(%q) should panic", input)
+				}
+				if err := recoverError(r); err.Kind != ErrSyntax {
+					t.Errorf("readStr(%q) kind = %s, want syntax-error", input, err.Kind)
+				}
+			}()
+			readStr(input)
+		})
+	}
+}
@@ -1,9 +1,11 @@
-package main
+package minilisp
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -11,32 +13,61 @@ import (
 	"github.com/chzyer/readline"
 )
 
-func handleREPLCommand(cmd string, env *Env, rl *readline.Instance) {
-	switch cmd {
+// Lines starting with one of these are REPL commands. Anything else
+// starting with : is a keyword and gets evaluated.
+var replCommands = map[string]bool{
+	":help": true, ":env": true, ":e": true, ":history": true, ":h": true,
+	":clear": true, ":c": true, ":quit": true, ":q": true,
+	":doc": true, ":apropos": true,
+}
+
+func isREPLCommand(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && replCommands[fields[0]]
+}
+
+// Run a :command, returning false for :quit
+func (in *Interpreter) handleREPLCommand(cmd string, rl *readline.Instance) bool {
+	fields := strings.Fields(cmd)
+	switch fields[0] {
 	case ":help":
-		printHelp()
+		if len(fields) > 1 {
+			in.printUsage(fields[1:])
+		} else {
+			in.printHelp()
+		}
+	case ":doc":
+		in.showDoc(fields[1:])
+	case ":apropos":
+		in.showApropos(strings.Join(fields[1:], " "))
 	case ":env", ":e":
-		showEnvironment(env)
+		in.showEnvironment()
 	case ":history", ":h":
-		showHistory()
+		in.showHistory()
 	case ":clear", ":c":
 		readline.ClearScreen(rl)
 	case ":quit", ":q":
-		os.Exit(0)
-	default:
-		fmt.Printf("Unknown command: %s (try :help)\n", cmd)
+		return false
 	}
+	return true
 }
 
-func printHelp() {
-	fmt.Print(`
+func (in *Interpreter) printHelp() {
+	fmt.Fprint(in.stdout, `
 Available commands:
   :help, :h       - Show this help
+  :help name      - Show how to call a builtin
+  :doc name       - Show the signature and documentation of a name
+  :apropos text   - Find names whose name or documentation mentions text
   :env,  :e       - Show environment bindings
   :history        - Show command history
   :clear, :c      - Clear screen
   :quit, :q       - Exit REPL (or press Ctrl+D)
 
+Ctrl+C stops whatever is being evaluated.
+
+Any other line starting with : is read as a keyword, e.g. :name
+
 Keyboard shortcuts:
   Ctrl+A    - Move to beginning of line
   Ctrl+E    - Move to end of line
@@ -46,11 +77,39 @@ Keyboard shortcuts:
   ↑/↓       - Navigate command history
   Tab       - Autocomplete function names
 
+Builtins:
 `)
+	in.printColumns(in.builtinNames())
+	fmt.Fprintln(in.stdout)
+}
+
+// Usage of each named builtin, e.g. (hash-get hash key)
+func (in *Interpreter) printUsage(names []string) {
+	for _, name := range names {
+		if fn, ok := in.builtins[name]; ok {
+			fmt.Fprintln(in.stdout, fn.Sig.Usage())
+		} else {
+			fmt.Fprintf(in.stdout, "No builtin named %s\n", name)
+		}
+	}
+}
+
+// Print words indented and wrapped to fit a terminal
+func (in *Interpreter) printColumns(words []string) {
+	line := " "
+	for _, word := range words {
+		if len(line)+len(word)+1 > 78 {
+			fmt.Fprintln(in.stdout, line)
+			line = " "
+		}
+		line += " " + word
+	}
+	fmt.Fprintln(in.stdout, line)
 }
 
-func showEnvironment(env *Env) {
-	fmt.Println("\nCurrent environment:")
+func (in *Interpreter) showEnvironment() {
+	env := in.env
+	fmt.Fprintln(in.stdout, "\nCurrent environment:")
 
 	// Collect and sort bindings
 	names := make([]string, 0, len(env.bindings))
@@ -61,24 +120,69 @@ func showEnvironment(env *Env) {
 
 	// Print in columns
 	for _, name := range names {
-		val := env.bindings[name]
-		typeStr := string(val.Type)
-		fmt.Printf("  %-20s = <%s>\n", name, strings.ToLower(typeStr))
+		fmt.Fprintf(in.stdout, "  %-20s %s\n", name, callSignature(name, env.bindings[name]))
+	}
+	fmt.Fprintln(in.stdout)
+}
+
+// Signature and docstring of each name, e.g.
+//
+//	(hash-get hash key)
+//	  Value stored under key, or nil.
+func (in *Interpreter) showDoc(names []string) {
+	env := in.env
+	if len(names) == 0 {
+		fmt.Fprintln(in.stdout, "Usage: :doc name")
+		return
+	}
+	for _, name := range names {
+		val, ok := env.Lookup(name)
+		if !ok {
+			fmt.Fprintf(in.stdout, "No binding named %s\n", name)
+			continue
+		}
+		fmt.Fprintln(in.stdout, callSignature(name, val))
+		if doc, _ := lookupDoc(env, name); doc != "" {
+			for _, line := range strings.Split(doc, "\n") {
+				fmt.Fprintln(in.stdout, "  "+strings.TrimSpace(line))
+			}
+		} else {
+			fmt.Fprintln(in.stdout, "  No documentation.")
+		}
 	}
-	fmt.Println()
 }
 
-func showHistory() {
+// One line per name matching text, with the first line of its docstring
+func (in *Interpreter) showApropos(text string) {
+	env := in.env
+	if text == "" {
+		fmt.Fprintln(in.stdout, "Usage: :apropos text")
+		return
+	}
+	matches := apropos(env, text)
+	if len(matches) == 0 {
+		fmt.Fprintf(in.stdout, "Nothing mentions %s\n", text)
+		return
+	}
+	for _, name := range matches {
+		val, _ := env.Lookup(name)
+		doc, _ := lookupDoc(env, name)
+		doc, _, _ = strings.Cut(doc, "\n")
+		fmt.Fprintf(in.stdout, "  %-32s %s\n", callSignature(name, val), doc)
+	}
+}
+
+func (in *Interpreter) showHistory() {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Println("Could not find home directory")
+		fmt.Fprintln(in.stdout, "Could not find home directory")
 		return
 	}
 	historyFile := filepath.Join(homeDir, "minilisp_history")
 
 	content, err := os.ReadFile(historyFile)
 	if err != nil {
-		fmt.Println("No history available")
+		fmt.Fprintln(in.stdout, "No history available")
 		return
 	}
 
@@ -90,18 +194,18 @@ func showHistory() {
 		start = len(lines) - 20
 	}
 
-	fmt.Println("\nRecent history:")
+	fmt.Fprintln(in.stdout, "\nRecent history:")
 	count := 1
 	for _, line := range lines[start:] {
 		if line != "" {
-			fmt.Printf("%3d  %s\n", count, line)
+			fmt.Fprintf(in.stdout, "%3d  %s\n", count, line)
 			count++
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(in.stdout)
 }
 
-// Check if expression has balanced parentheses
+// Check if expression has balanced parentheses, brackets and braces
 func isCompleteExpr(input string) bool {
 	depth := 0
 	inString := false
@@ -111,62 +215,92 @@ func isCompleteExpr(input string) bool {
 		ch := input[i]
 
 		// Handle comments
-		if ch == ';' {
-			inComment = true
-		}
-		if ch == '\n' {
-			inComment = false
-		}
 		if inComment {
+			if ch == '\n' {
+				inComment = false
+			}
 			continue
 		}
 
-		// Handle strings
-		if ch == '"' {
-			inString = !inString
-		}
+		// Handle strings, skipping whatever follows a backslash
 		if inString {
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inString = false
+			}
 			continue
 		}
 
-		// Count parentheses
-		if ch == '(' {
+		switch ch {
+		case ';':
+			inComment = true
+		case '"':
+			inString = true
+		case '(', '[', '{':
 			depth++
-		} else if ch == ')' {
+		case ')', ']', '}':
 			depth--
 		}
 	}
 
-	return depth == 0
+	return depth == 0 && !inString
 }
 
-func createCompleter(env *Env) *readline.PrefixCompleter {
-	// Get all defined symbols from environment
+func (in *Interpreter) createCompleter() *readline.PrefixCompleter {
+	env := in.env
 	var items []readline.PrefixCompleterInterface
 
-	// Add REPL commands
+	// Add REPL commands, :help completing builtin names
+	var helpItems []readline.PrefixCompleterInterface
+	for _, name := range in.builtinNames() {
+		helpItems = append(helpItems, readline.PcItem(name))
+	}
+	var nameItems []readline.PrefixCompleterInterface
+	for _, name := range visibleNames(env) {
+		nameItems = append(nameItems, readline.PcItem(name))
+	}
 	items = append(items,
-		readline.PcItem(":help"),
+		readline.PcItem(":help", helpItems...),
+		readline.PcItem(":doc", nameItems...),
+		readline.PcItem(":apropos"),
 		readline.PcItem(":env"),
 		readline.PcItem(":history"),
 		readline.PcItem(":clear"),
 		readline.PcItem(":quit"),
 	)
 
-	// Add builtin functions and defined symbols
+	// Add builtins and everything else defined, like the standard library
+	names := map[string]bool{}
+	for _, name := range in.builtinNames() {
+		names[name] = true
+	}
 	for name := range env.bindings {
+		names[name] = true
+	}
+	for _, name := range sortedNames(names) {
 		items = append(items, readline.PcItem(name))
 	}
 
 	return readline.NewPrefixCompleter(items...)
 }
 
-func startREPL(env *Env) {
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Run the prompt until :quit, Ctrl+D or Ctrl+C at an empty prompt
+func (in *Interpreter) startREPL() error {
 	homeDIR, _ := os.UserHomeDir()
 	historyFile := filepath.Join(homeDIR, "minilisp_history")
 
 	// Create completer
-	completer := createCompleter(env)
+	completer := in.createCompleter()
 
 	repl, err := readline.NewEx(&readline.Config{
 		Prompt:            "> ",
@@ -175,14 +309,15 @@ func startREPL(env *Env) {
 		EOFPrompt:         "exit",
 		HistorySearchFold: true,
 		AutoComplete:      completer,
+		Stdout:            in.stdout,
 	})
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer repl.Close()
 
-	fmt.Println("MiniLisp - Type :help for commands")
+	fmt.Fprintln(in.stdout, "MiniLisp - Type :help for commands")
 
 	var buffer []string // Accumulate multi-line input
 
@@ -207,6 +342,8 @@ func startREPL(env *Env) {
 			continue
 		} else if err == io.EOF {
 			break
+		} else if err != nil {
+			return err
 		}
 
 		line = strings.TrimSpace(line)
@@ -224,8 +361,10 @@ func startREPL(env *Env) {
 		}
 
 		// Handle REPL commands (only when not in multi-line mode)
-		if strings.HasPrefix(line, ":") && len(buffer) == 0 {
-			handleREPLCommand(line, env, repl)
+		if isREPLCommand(line) && len(buffer) == 0 {
+			if !in.handleREPLCommand(line, repl) {
+				break
+			}
 			continue
 		}
 
@@ -241,19 +380,21 @@ func startREPL(env *Env) {
 		// Clear buffer and evaluate
 		buffer = nil
 
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					fmt.Printf("Error: %v\n", r)
-				}
-			}()
-
+		// Ctrl+C while it runs cancels the evaluation rather than
+		// killing the REPL
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = in.withContext(ctx, func(env *Env) {
 			expr := readStr(input)
 			if expr == nilExpr {
 				return
 			}
 			result := eval(expr, env)
-			printResult(result)
-		}()
+			in.printResult(result)
+		})
+		stop()
+		if err != nil {
+			fmt.Fprintln(in.stdout, FormatError(err))
+		}
 	}
+	return nil
 }
@@ -1,11 +1,12 @@
-package main
+package minilisp
 
-import "testing"
+import (
+	"io"
+	"testing"
+)
 
 func TestMultipleExpressions(t *testing.T) {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("*", makeBuiltin(builtinMul))
+	env := setupFullEnv()
 
 	input := `(define x 10) (define y 20) (+ x y)`
 	exprs := readMultipleExprs(input)
@@ -108,20 +109,49 @@ func TestCompleteProgram(t *testing.T) {
 	}
 }
 
-// Helper to setup full environment
-func setupFullEnv() *Env {
-	env := NewEnv(nil)
-	env.Define("+", makeBuiltin(builtinAdd))
-	env.Define("-", makeBuiltin(builtinSub))
-	env.Define("*", makeBuiltin(builtinMul))
-	env.Define("/", makeBuiltin(builtinDiv))
-	env.Define("=", makeBuiltin(builtinEq))
-	env.Define("<", makeBuiltin(builtinLt))
-	env.Define(">", makeBuiltin(builtinGt))
-	env.Define("pair", makeBuiltin(builtinPair))
-	env.Define("head", makeBuiltin(builtinHead))
-	env.Define("tail", makeBuiltin(builtinTail))
-	env.Define("null?", makeBuiltin(builtinNullP))
-	env.Define("print", makeBuiltin(builtinPrint))
-	return env
+func TestIsCompleteExpr(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{`(+ 1 2)`, true},
+		{`(+ 1`, false},
+		{`(print "a\"b")`, true},
+		{`(print "a\\")`, true},
+		{`(print "(")`, true},
+		{`(print "a;b")`, true},
+		{`(print "abc`, false},
+		{"(+ 1 ; )\n 2)", true},
+		{`[1 2`, false},
+		{`[1 (+ 1 1)]`, true},
+		{`{"a" 1`, false},
+		{`{"a" [1 2]}`, true},
+	}
+
+	for _, tt := range tests {
+		if got := isCompleteExpr(tt.input); got != tt.want {
+			t.Errorf("isCompleteExpr(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// :quit ends the REPL by returning, not by exiting the program
+func TestREPLCommands(t *testing.T) {
+	in := New(WithoutStdlib(), WithStdout(io.Discard))
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{":help", true},
+		{":doc map", true},
+		{":env", true},
+		{":quit", false},
+		{":q", false},
+	}
+
+	for _, tt := range tests {
+		if got := in.handleREPLCommand(tt.cmd, nil); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.cmd, got, tt.want)
+		}
+	}
 }
@@ -0,0 +1,173 @@
+package minilisp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Capability is something a sandboxed script has to be allowed to do
+type Capability string
+
+const (
+	CapFSRead    Capability = "fs-read"    // load and import files
+	CapFSWrite   Capability = "fs-write"   // no builtins write files yet
+	CapNetClient Capability = "net-client" // fetch
+	CapNetServer Capability = "net-server" // http-server
+	CapProcess   Capability = "process"    // no builtins start processes yet
+)
+
+var capabilities = []Capability{CapFSRead, CapFSWrite, CapNetClient, CapNetServer, CapProcess}
+
+// ParseCapability checks name is one of the capabilities, e.g. net-client
+func ParseCapability(name string) (Capability, error) {
+	for _, c := range capabilities {
+		if string(c) == name {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown capability %q", name)
+}
+
+// Sandbox restricts what scripts can reach outside the interpreter, for
+// running code you don't trust. Builtins needing a capability that isn't
+// allowed are still defined, but raise a capability-error when called.
+// The standard library can always be imported, and Go functions given to
+// Define are trusted.
+type Sandbox struct {
+	Allow      []Capability
+	LoadRoot   string   // if set, load and import only read files under this directory
+	FetchHosts []string // if set, the only hosts fetch reaches, "*.example.com" allowing subdomains
+}
+
+// WithSandbox runs every script in the interpreter in the sandbox. Without
+// one, scripts can do anything the builtins can.
+func WithSandbox(s Sandbox) Option {
+	return func(in *Interpreter) { in.sandbox = &s }
+}
+
+// Is c allowed? Everything is when there's no sandbox.
+func (s *Sandbox) allows(c Capability) bool {
+	if s == nil {
+		return true
+	}
+	for _, allowed := range s.Allow {
+		if allowed == c {
+			return true
+		}
+	}
+	return false
+}
+
+func capabilityError(origin, format string, args ...interface{}) *Expr {
+	return errorf(ErrCapability, origin, "capability denied: "+format, args...)
+}
+
+// Stand in for a builtin the sandbox doesn't allow
+func deniedBuiltin(name string, c Capability) func([]*Expr) *Expr {
+	return func([]*Expr) *Expr {
+		panic(capabilityError(name, "%s is not allowed", c))
+	}
+}
+
+// Panic with a capability-error unless origin (load or import) may read
+// the file at path. Files in the standard library are always allowed.
+func (in *Interpreter) checkRead(origin, path string) {
+	s := in.sandbox
+	if s == nil || isStdPath(path) {
+		return
+	}
+	if !s.allows(CapFSRead) {
+		panic(capabilityError(origin, "%s is not allowed", CapFSRead))
+	}
+	if s.LoadRoot != "" && !insideDir(s.LoadRoot, path) {
+		panic(capabilityError(origin, "%s is outside %s", path, s.LoadRoot))
+	}
+}
+
+// Is path inside dir once both are absolute and symlinks are followed?
+func insideDir(dir, path string) bool {
+	dir, err := realPath(dir)
+	if err != nil {
+		return false
+	}
+	path, err = realPath(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func realPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// Is fetch allowed to reach host?
+func (s *Sandbox) allowsHost(host string) bool {
+	if s == nil || len(s.FetchHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range s.FetchHosts {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Returned by CheckRedirect when a redirect leaves the allowed hosts
+type hostDeniedError struct{ host string }
+
+func (e *hostDeniedError) Error() string {
+	return "host " + e.host + " is not allowed"
+}
+
+// The client fetch uses, which won't follow redirects to hosts the sandbox
+// doesn't allow
+func (in *Interpreter) fetchClient() *http.Client {
+	s := in.sandbox
+	if s == nil || len(s.FetchHosts) == 0 {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !s.allowsHost(req.URL.Hostname()) {
+				return &hostDeniedError{req.URL.Hostname()}
+			}
+			// Go's default
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// Panic with a capability-error unless fetch may reach u
+func (in *Interpreter) checkFetch(u *url.URL) {
+	if !in.sandbox.allowsHost(u.Hostname()) {
+		panic(capabilityError("fetch", "host %s is not allowed", u.Hostname()))
+	}
+}
+
+// Turn a redirect to a host that isn't allowed into a capability-error
+func checkRedirectDenied(err error) {
+	var denied *hostDeniedError
+	if errors.As(err, &denied) {
+		panic(capabilityError("fetch", "%s", denied.Error()))
+	}
+}
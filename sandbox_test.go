@@ -0,0 +1,163 @@
+package minilisp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Evaluate input in a sandboxed interpreter, returning the error kind and
+// message, or "" and the printed result
+func evalSandboxed(t *testing.T, s Sandbox, input string) (string, string) {
+	t.Helper()
+	interp := New(WithoutStdlib(), WithSandbox(s))
+	got, err := interp.Eval(context.Background(), input)
+	var lispErr *EvalError
+	if errors.As(err, &lispErr) {
+		return lispErr.Kind, lispErr.Error()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, _ := fromGo(got)
+	return "", printExpr(expr)
+}
+
+func TestSandboxDeniesBuiltins(t *testing.T) {
+	tests := []struct {
+		allow []Capability
+		input string
+		want  string
+	}{
+		{nil, `(fetch "http://example.com")`, "fetch: capability denied: net-client is not allowed"},
+		{nil, "(http-server 8080 (lambda (r) {}))", "http-server: capability denied: net-server is not allowed"},
+		{[]Capability{CapNetClient}, "(http-server 8080 (lambda (r) {}))", "http-server: capability denied: net-server is not allowed"},
+		// Arguments are still checked first
+		{nil, "(fetch 1)", "fetch: argument 1 must be a string, got number 1"},
+	}
+
+	for _, tt := range tests {
+		_, msg := evalSandboxed(t, Sandbox{Allow: tt.allow}, tt.input)
+		if msg != tt.want {
+			t.Errorf("%s = %q, want %q", tt.input, msg, tt.want)
+		}
+	}
+
+	// Denied builtins are still there to be documented
+	interp := New(WithoutStdlib(), WithSandbox(Sandbox{}))
+	if got, _ := interp.Eval(context.Background(), "(doc fetch)"); got != "Body of an HTTP GET of the URL." {
+		t.Errorf("(doc fetch) = %v", got)
+	}
+}
+
+func TestSandboxLoadRoot(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"root/ok.lisp":  "(define loaded 1)",
+		"root/lib.lisp": "(module lib (export x)) (define x 2)",
+		"secret.lisp":   "(define secret 3)",
+	})
+	root := filepath.Join(dir, "root")
+	os.Symlink(filepath.Join(dir, "secret.lisp"), filepath.Join(root, "link.lisp"))
+
+	sandbox := Sandbox{Allow: []Capability{CapFSRead}, LoadRoot: root}
+	tests := []struct {
+		input string
+		kind  string
+		want  string
+	}{
+		{`(load "` + root + `/ok.lisp") loaded`, "", "1"},
+		{`(import "` + root + `/lib") x`, "", "2"},
+		{`(load "` + root + `/../secret.lisp")`, ErrCapability, "load: capability denied: " + root + "/../secret.lisp is outside " + root},
+		{`(load "` + root + `/link.lisp")`, ErrCapability, "load: capability denied: " + root + "/link.lisp is outside " + root},
+		{`(import "` + dir + `/secret")`, ErrCapability, "import: capability denied: " + dir + "/secret.lisp is outside " + root},
+		// The standard library is always there
+		{"(import std:functions) (sum 1 2)", "", "3"},
+	}
+
+	for _, tt := range tests {
+		kind, msg := evalSandboxed(t, sandbox, tt.input)
+		if kind != tt.kind || msg != tt.want {
+			t.Errorf("%s = %s %q, want %s %q", tt.input, kind, msg, tt.kind, tt.want)
+		}
+	}
+
+	// Without fs-read nothing can be loaded
+	if _, msg := evalSandboxed(t, Sandbox{LoadRoot: root}, `(load "`+root+`/ok.lisp")`); msg != "load: capability denied: fs-read is not allowed" {
+		t.Errorf("load without fs-read = %q", msg)
+	}
+}
+
+func TestSandboxFetchHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			// Same server, under a name that isn't allowed
+			http.Redirect(w, r, strings.Replace("http://"+r.Host, "127.0.0.1", "localhost", 1)+"/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		hosts []string
+		path  string
+		want  string
+	}{
+		{nil, "/", `"hello"`},
+		{[]string{"127.0.0.1"}, "/", `"hello"`},
+		{[]string{"example.com"}, "/", "fetch: capability denied: host 127.0.0.1 is not allowed"},
+		{[]string{"127.0.0.1"}, "/away", "fetch: capability denied: host localhost is not allowed"},
+	}
+
+	for _, tt := range tests {
+		s := Sandbox{Allow: []Capability{CapNetClient}, FetchHosts: tt.hosts}
+		_, msg := evalSandboxed(t, s, `(fetch "`+server.URL+tt.path+`")`)
+		if msg != tt.want {
+			t.Errorf("fetch %s with hosts %v = %q, want %q", tt.path, tt.hosts, msg, tt.want)
+		}
+	}
+}
+
+func TestAllowsHost(t *testing.T) {
+	s := &Sandbox{FetchHosts: []string{"api.github.com", "*.Example.com"}}
+	tests := map[string]bool{
+		"api.github.com":   true,
+		"API.GitHub.com":   true,
+		"github.com":       false,
+		"a.example.com":    true,
+		"a.b.example.com":  true,
+		"example.com":      false,
+		"evil-example.com": false,
+	}
+	for host, want := range tests {
+		if got := s.allowsHost(host); got != want {
+			t.Errorf("allowsHost(%s) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestNoSandboxAllowsEverything(t *testing.T) {
+	var s *Sandbox
+	for _, c := range capabilities {
+		if !s.allows(c) {
+			t.Errorf("no sandbox should allow %s", c)
+		}
+	}
+	if !s.allowsHost("anywhere.com") {
+		t.Error("no sandbox should allow any host")
+	}
+}
+
+func TestParseCapability(t *testing.T) {
+	if c, err := ParseCapability("net-client"); err != nil || c != CapNetClient {
+		t.Errorf("net-client = %v, %v", c, err)
+	}
+	if _, err := ParseCapability("root"); err == nil || err.Error() != `unknown capability "root"` {
+		t.Errorf("root = %v", err)
+	}
+}
@@ -2,9 +2,11 @@
 ; Common Functions for MiniLisp
 ; ============================================
 
-; Factorial function
+(module functions (export factorial sum))
+
 (define factorial
   (lambda (n)
+    "n! for a non-negative integer n."
     (if (= n 0)
         1
         (* n (factorial (- n 1))))))
@@ -18,4 +20,5 @@
 
 (define sum
   (lambda (&rest nums)
+    "Sum of the arguments."
     (sum-helper nums 0)))
\ No newline at end of file
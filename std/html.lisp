@@ -1,6 +1,9 @@
-; Convert list to string (helper for HTML building)
+; HTML builders
+(module html (export list->string html-element when-html <div> <h1> <p> <button>))
+
 (define list->string
   (lambda (lst)
+    "The strings in a list joined together."
     (string-join lst "")))
 
 ; Build attribute string from hash
@@ -8,40 +11,31 @@
   (lambda (attrs)
     (if (= attrs nil)
         ""
-        (begin
-          (define keys (hash-keys attrs))
-          (define pairs
-            (map (lambda (key)
-                   (string-append key "=" (string-append (hash-get attrs key))))
-                 keys))
+        (let* ((keys (hash-keys attrs))
+               (pairs
+                (map (lambda (key)
+                       (string-append (@string key) "=" (string-append (hash-get attrs key))))
+                     keys)))
           (string-join pairs " ")))))
 
-; Core function: create HTML element with attributes
-; Signature: (html-element tag attrs content)
 (define html-element
   (lambda (tag attrs content)
-    (define attr-str (attrs->string attrs))
-    (define open-tag
-      (if (= attrs nil)
-          (string-append "<" tag ">")
-          (string-append "<" tag " " attr-str ">")))
-
-    (string-append open-tag content "</" tag ">")))
+    "An HTML element with a hash of attributes, or nil, around content."
+    (let ((open-tag
+           (if (= attrs nil)
+               (string-append "<" tag ">")
+               (string-append "<" tag " " (attrs->string attrs) ">"))))
+      (string-append open-tag content "</" tag ">"))))
 
 
 ; Helper to detect if first arg is a hash (attrs)
 (define hash?
   (lambda (x)
-    (if (= x nil)
-        nil
-        (if (= (string? x) true) nil
-            (if (= (number? x) true) nil
-                (if (= (list? x) true) nil
-                    true))))))
+    (not (or (= x nil) (string? x) (number? x) (list? x) (vector? x) (bool? x) (keyword? x)))))
 
-; Conditionally render a section of HTML (think v-if)                   
 (define when-html
   (lambda (condition content)
+    "content if condition is true, otherwise an empty string (think v-if)."
           (if condition content "")))
 
 (define <div>
@@ -2,6 +2,13 @@
 ; Macro Library for MiniLisp
 ; ============================================
 
+(module macro (export define-syntax -> ->> when cond))
+
+; Define a syntax-rules macro
+; Example: (define-syntax unless (syntax-rules () ((_ test body ...) (if test nil (begin body ...)))))
+(defmacro define-syntax (name rules)
+  `(define ,name ,rules))
+
 ; ============================================
 ; Thread Macros
 ; ============================================
@@ -9,39 +16,20 @@
 ; Thread-first macro (->)
 ; Threads value through multiple forms, inserting as FIRST argument
 ; Example: (-> 5 (* 2) (+ 3)) expands to (+ (* 5 2) 3)
-(defmacro -> (value &rest forms)
-  (if (= forms nil)
-      value
-      (if (= (tail forms) nil)
-          ; Single form - thread value as first arg
-          (pair (head (head forms))
-                (pair value (tail (head forms))))
-          ; Multiple forms - recurse
-          (pair '->
-                (pair (pair (head (head forms))
-                           (pair value (tail (head forms))))
-                      (tail forms))))))
-
-; Helper function for ->> macro
-(define append-at-end
-  (lambda (form val)
-    (if (= form nil)
-        (pair val nil)
-        (pair (head form) (append-at-end (tail form) val)))))
+(define-syntax ->
+  (syntax-rules ()
+    ((_ value) value)
+    ((_ value (f args ...) form ...) (-> (f value args ...) form ...))
+    ((_ value f form ...) (-> (f value) form ...))))
 
 ; Thread-last macro (->>)
 ; Threads value through multiple forms, inserting as LAST argument
 ; Example: (->> 5 (* 2) (+ 3)) expands to (+ 3 (* 2 5))
-(defmacro ->> (value &rest forms)
-  (if (= forms nil)
-      value
-      (if (= (tail forms) nil)
-          ; Single form - append value at end
-          (append-at-end (head forms) value)
-          ; Multiple forms - recurse
-          (pair '->>
-                (pair (append-at-end (head forms) value)
-                      (tail forms))))))
+(define-syntax ->>
+  (syntax-rules ()
+    ((_ value) value)
+    ((_ value (f args ...) form ...) (->> (f args ... value) form ...))
+    ((_ value f form ...) (->> (f value) form ...))))
 
 ; ============================================
 ; Control Flow Macros
@@ -49,31 +37,17 @@
 
 ; When macro - conditional execution without else branch
 ; Example: (when true (print 42))
-(defmacro when (test body)
-  (pair 'if (pair test (pair body (pair 'nil nil)))))
+(define-syntax when
+  (syntax-rules ()
+    ((_ test body ...) (if test (begin body ...) nil))))
 
 ; Cond macro - multi-way conditional
 ; Takes multiple (test expr...) pairs and returns the result of the first true test
 ; Supports multiple expressions per clause
 ; Example: (cond ((= x 0) 100) ((< x 0) 200) (true 300))
 ; Example: (cond ((ok? r) (print "ok") (unwrap r)) ((err? r) (print "err")))
-(defmacro cond (&rest clauses)
-  (if (= clauses nil)
-      nil
-      (pair 'if
-            (pair (head (head clauses))
-                  (pair (if (= (tail (tail (head clauses))) nil)
-                            ; Single expression
-                            (head (tail (head clauses)))
-                            ; Multiple expressions - wrap in begin
-                            (pair 'begin (tail (head clauses))))
-                        (pair (pair 'cond (tail clauses))
-                              nil))))))
-
-; Map function - applies a function to each element of a list
-(define map
-  (lambda (f lst)
-    (if (null? lst)
-        nil
-        (pair (f (head lst))
-              (map f (tail lst))))))
\ No newline at end of file
+(define-syntax cond
+  (syntax-rules ()
+    ((_) nil)
+    ((_ (test body ...) clause ...)
+     (if test (begin body ...) (cond clause ...)))))
\ No newline at end of file
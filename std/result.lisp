@@ -1,40 +1,43 @@
-; Create an Ok result containing a value
+; Result type: (ok value) or (err error)
+(module result (export ok err ok? err? unwrap unwrap-err unwrap-or))
+
 (define ok
   (lambda (value)
-    (hash "type" "ok" "value" value)))
+    "Create an Ok result containing a value."
+    {:type :ok :value value}))
 
-; Create an Error result containing an error message
 (define err
   (lambda (error)
-    (hash "type" "err" "error" error)))
+    "Create an Err result containing an error message."
+    {:type :err :error error}))
 
-; Check if a result is Ok
 (define ok?
   (lambda (result)
-    (= (hash-get result "type") "ok")))
+    "Check if a result is Ok."
+    (= (:type result) :ok)))
 
-; Check if a result is an Error
 (define err?
   (lambda (result)
-    (= (hash-get result "type") "err")))
+    "Check if a result is an Err."
+    (= (:type result) :err)))
 
-; Unwrap a result value (panics on error)
 (define unwrap
   (lambda (result)
+    "The value of an Ok result, or the error of an Err."
     (if (ok? result)
-        (hash-get result "value")
-        (hash-get result "error"))))
+        (:value result)
+        (:error result))))
 
-; Get error message from an Err result
 (define unwrap-err
   (lambda (result)
-    (hash-get result "error")))
+    "The error message of an Err result."
+    (:error result)))
 
-; Unwrap a result, returning the value or a default
 ; Example: (unwrap-or (ok 42) 0) returns 42
 ; Example: (unwrap-or (err "failed") 0) returns 0
 (define unwrap-or
   (lambda (result default)
+    "The value of an Ok result, or default for an Err."
     (if (ok? result)
-        (hash-get result "value")
+        (:value result)
         default)))
@@ -0,0 +1,66 @@
+package minilisp
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The standard library is compiled into the binary, so it works from any
+// directory. load and import reach it with a std: prefix:
+//
+//	(import std:result)
+//	(load "std:macro.lisp")
+//
+// An interpreter with a stdlibDir reads it from that directory instead, for
+// working on the standard library without rebuilding.
+
+//go:embed std/*.lisp
+var stdFS embed.FS
+
+const stdPrefix = "std:"
+
+func isStdPath(name string) bool {
+	return strings.HasPrefix(name, stdPrefix)
+}
+
+// Find a std: file, e.g. std:macro.lisp. Paths into the embedded library
+// keep their std: prefix; ones in stdlibDir are ordinary file paths.
+func (in *Interpreter) resolveStd(name string) (string, bool) {
+	file := strings.TrimPrefix(name, stdPrefix)
+	if in.stdlibDir != "" {
+		path := filepath.Join(in.stdlibDir, filepath.FromSlash(file))
+		info, err := os.Stat(path)
+		return path, err == nil && !info.IsDir()
+	}
+	info, err := stdFS.Open("std/" + file)
+	if err != nil {
+		return "", false
+	}
+	info.Close()
+	return stdPrefix + file, true
+}
+
+// Read a file found by resolvePath, from the embedded library or from disk
+func readSourceFile(path string) ([]byte, error) {
+	if isStdPath(path) {
+		return stdFS.ReadFile("std/" + strings.TrimPrefix(path, stdPrefix))
+	}
+	return os.ReadFile(path)
+}
+
+// Import the standard library modules into env. Their helpers, like
+// sum-helper, stay inside the modules.
+func loadStdLib(env *Env) {
+	// Load macros (thread macros, when, cond)
+	eval(readStr(`(import std:macro)`), env)
+
+	// Load functions (factorial, sum)
+	eval(readStr(`(import std:functions)`), env)
+
+	// Result type
+	eval(readStr(`(import std:result)`), env)
+
+	eval(readStr(`(import std:html)`), env)
+}
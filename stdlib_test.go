@@ -0,0 +1,84 @@
+package minilisp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The standard library shouldn't depend on the working directory
+func TestStdLibFromAnyDirectory(t *testing.T) {
+	t.Chdir(t.TempDir())
+	env := setupFullEnv()
+	loadStdLib(env)
+	eval(readStr(`(load "std:macro.lisp")`), env)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(-> 5 (* 2) (+ 3))", "13"},
+		{"(sum 1 2 3)", "6"},
+		{"(unwrap-or (err 1) 0)", "0"},
+		{`(<p> "hi")`, `"<p>hi</p>"`},
+		{"(cond (false 1) (true 2))", "2"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestStdImportAlias(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr(`(import std:result :as r)`), env)
+
+	if got := printExpr(eval(readStr("(r/unwrap (r/ok 1))"), env)); got != "1" {
+		t.Errorf("(r/unwrap (r/ok 1)) = %s, want 1", got)
+	}
+	if _, ok := env.Lookup("ok"); ok {
+		t.Error("ok should only be bound as r/ok")
+	}
+}
+
+func TestStdlibDir(t *testing.T) {
+	dir := t.TempDir()
+	src := `(module functions (export sum)) (define sum (lambda (&rest xs) "dev"))`
+	if err := os.WriteFile(filepath.Join(dir, "functions.lisp"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := setupFullEnv()
+	env.interpreter().stdlibDir = dir
+	eval(readStr(`(import std:functions)`), env)
+	if got := printExpr(eval(readStr("(sum 1 2)"), env)); got != `"dev"` {
+		t.Errorf("(sum 1 2) = %s, want \"dev\"", got)
+	}
+}
+
+func TestMissingStdModule(t *testing.T) {
+	env := setupFullEnv()
+	expectImportError(t, ErrImport, "import: can't find module std:nope in the standard library", func() {
+		eval(readStr(`(import std:nope)`), env)
+	})
+}
+
+// Everything in std/ should be built in
+func TestStdLibIsEmbedded(t *testing.T) {
+	files, err := filepath.Glob("std/*.lisp")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no std files: %v", err)
+	}
+	for _, file := range files {
+		onDisk, _ := os.ReadFile(file)
+		embedded, err := readSourceFile(stdPrefix + filepath.Base(file))
+		if err != nil {
+			t.Errorf("%s isn't embedded: %v", file, err)
+		} else if string(embedded) != string(onDisk) {
+			t.Errorf("embedded %s differs from the file", file)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package minilisp
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// String builtins. Lengths and indexes count characters (runes), not
+// bytes, so (string-length "héllo") is 5.
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func builtinStringLength(args []*Expr) *Expr {
+	return makeNum(utf8.RuneCountInString(args[0].Str))
+}
+
+// (substring s start [end]), end defaults to the end of the string
+func builtinSubstring(args []*Expr) *Expr {
+	for i, arg := range args[1:] {
+		checkInteger("substring", i+1, arg)
+	}
+
+	runes := []rune(args[0].Str)
+	start, end := args[1].Num, len(runes)
+	if len(args) == 3 {
+		end = args[2].Num
+	}
+	if start < 0 || end > len(runes) || start > end {
+		panic(errorf(ErrValue, "substring", "range %d to %d out of bounds for string of length %d", start, end, len(runes)))
+	}
+	return makeStr(string(runes[start:end]))
+}
+
+// (string-split s sep), an empty separator splits into characters
+func builtinStringSplit(args []*Expr) *Expr {
+	parts := strings.Split(args[0].Str, args[1].Str)
+	items := make([]*Expr, len(parts))
+	for i, part := range parts {
+		items[i] = makeStr(part)
+	}
+	return list(items...)
+}
+
+// Character index of the first occurrence of sub, or nil if there isn't one
+func builtinStringIndex(args []*Expr) *Expr {
+	i := strings.Index(args[0].Str, args[1].Str)
+	if i < 0 {
+		return nilExpr
+	}
+	return makeNum(utf8.RuneCountInString(args[0].Str[:i]))
+}
+
+// (string-replace s old new) replaces every occurrence
+func builtinStringReplace(ctx context.Context, env *Env, args []*Expr) *Expr {
+	s, from, to := args[0].Str, args[1].Str, args[2].Str
+	n := int64(len(s)) + int64(strings.Count(s, from))*int64(len(to)-len(from))
+	env.evaluation().reserve(0, n)
+	return makeStr(strings.ReplaceAll(s, from, to))
+}
+
+func builtinStringUpcase(args []*Expr) *Expr {
+	return makeStr(strings.ToUpper(args[0].Str))
+}
+
+func builtinStringDowncase(args []*Expr) *Expr {
+	return makeStr(strings.ToLower(args[0].Str))
+}
+
+// Trims whitespace from both ends
+func builtinStringTrim(args []*Expr) *Expr {
+	return makeStr(strings.TrimSpace(args[0].Str))
+}
+
+func builtinStringContainsP(args []*Expr) *Expr {
+	return makeBool(strings.Contains(args[0].Str, args[1].Str))
+}
+
+// List of one character strings
+func builtinStringToList(ctx context.Context, env *Env, args []*Expr) *Expr {
+	env.evaluation().reserve(int64(utf8.RuneCountInString(args[0].Str)), int64(len(args[0].Str)))
+
+	var items []*Expr
+	for _, ch := range args[0].Str {
+		items = append(items, makeStr(string(ch)))
+	}
+	return list(items...)
+}
@@ -0,0 +1,75 @@
+package minilisp
+
+import "testing"
+
+func TestStringLibrary(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`(string-length "hello")`, "5"},
+		{`(string-length "héllo")`, "5"},
+		{`(string-length "日本語")`, "3"},
+		{`(string-length "")`, "0"},
+		{`(substring "hello world" 6)`, `"world"`},
+		{`(substring "hello world" 0 5)`, `"hello"`},
+		{`(substring "日本語です" 1 3)`, `"本語"`},
+		{`(substring "abc" 3)`, `""`},
+		{`(string-split "a,b,,c" ",")`, `("a" "b" "" "c")`},
+		{`(string-split "héllo" "")`, `("h" "é" "l" "l" "o")`},
+		{`(string-split "no-sep" ",")`, `("no-sep")`},
+		{`(string-index "hello" "l")`, "2"},
+		{`(string-index "日本語" "語")`, "2"},
+		{`(string-index "hello" "z")`, "nil"},
+		{`(string-replace "a-b-c" "-" "+")`, `"a+b+c"`},
+		{`(string-upcase "héllo")`, `"HÉLLO"`},
+		{`(string-downcase "ÉCOLE")`, `"école"`},
+		{`(string-trim "  \t padded \n")`, `"padded"`},
+		{`(string-contains? "hello world" "o w")`, "true"},
+		{`(string-contains? "hello" "xyz")`, "false"},
+		{`(string->list "aé😀")`, `("a" "é" "😀")`},
+		{`(string->list "")`, "nil"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestStringLibraryErrors(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{`(string-length 42)`, ErrType},
+		{`(string-length "a" "b")`, ErrArity},
+		{`(substring "abc" 2 1)`, ErrValue},
+		{`(substring "abc" 0 4)`, ErrValue},
+		{`(substring "abc" -1)`, ErrValue},
+		{`(substring "abc" "0")`, ErrType},
+		{`(string-split "abc")`, ErrArity},
+		{`(string-replace "abc" "a" 1)`, ErrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package minilisp
+
+import "context"
+
+// Vector builtins. Vectors are indexed from 0 and changed in place by
+// vector-set! and vector-push, unlike lists which are never mutated.
+
+func checkInteger(name string, i int, arg *Expr) {
+	// Only integers small enough to be an index or count
+	if arg.Type != Number {
+		panic(argError(name, i, "an integer", arg))
+	}
+}
+
+// The index argument, checked against the vector's length
+func vectorIndex(name string, v, idx *Expr) int {
+	checkInteger(name, 1, idx)
+	if idx.Num < 0 || idx.Num >= len(v.Items) {
+		panic(errorf(ErrValue, name, "index %d out of bounds for vector of length %d", idx.Num, len(v.Items)))
+	}
+	return idx.Num
+}
+
+func builtinVector(args []*Expr) *Expr {
+	return makeVector(append([]*Expr{}, args...))
+}
+
+func builtinVectorP(args []*Expr) *Expr {
+	return makeBool(args[0].Type == Vector)
+}
+
+func builtinVectorLength(args []*Expr) *Expr {
+	return makeNum(len(args[0].Items))
+}
+
+func builtinVectorRef(args []*Expr) *Expr {
+	return args[0].Items[vectorIndex("vector-ref", args[0], args[1])]
+}
+
+// (vector-set! v i x) replaces element i and returns the vector
+func builtinVectorSet(args []*Expr) *Expr {
+	args[0].Items[vectorIndex("vector-set!", args[0], args[1])] = args[2]
+	return args[0]
+}
+
+// (vector-push v x ...) appends to the end and returns the vector
+func builtinVectorPush(ctx context.Context, env *Env, args []*Expr) *Expr {
+	env.evaluation().grow(args[0], int64(len(args)-1), 0)
+	args[0].Items = append(args[0].Items, args[1:]...)
+	return args[0]
+}
+
+// (vector-slice v start [end]) copies out a new vector, end defaults to
+// the length
+func builtinVectorSlice(args []*Expr) *Expr {
+	for i, arg := range args[1:] {
+		checkInteger("vector-slice", i+1, arg)
+	}
+
+	items := args[0].Items
+	start, end := args[1].Num, len(items)
+	if len(args) == 3 {
+		end = args[2].Num
+	}
+	if start < 0 || end > len(items) || start > end {
+		panic(errorf(ErrValue, "vector-slice", "range %d to %d out of bounds for vector of length %d", start, end, len(items)))
+	}
+	return makeVector(append([]*Expr{}, items[start:end]...))
+}
+
+func builtinVectorToList(args []*Expr) *Expr {
+	return list(args[0].Items...)
+}
+
+func builtinListToVector(ctx context.Context, env *Env, args []*Expr) *Expr {
+	items := listToSlice(args[0])
+	env.evaluation().reserve(int64(len(items)), 0)
+	return makeVector(append([]*Expr{}, items...))
+}
@@ -0,0 +1,127 @@
+package minilisp
+
+import "testing"
+
+func TestVectors(t *testing.T) {
+	env := setupFullEnv()
+	env.Define("x", makeNum(5))
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"[1 2 3]", "[1 2 3]"},
+		{"#[1 2 3]", "[1 2 3]"},
+		{"[]", "[]"},
+		{"[x (+ x 1) [x]]", "[5 6 [5]]"},
+		{"'[x (+ x 1)]", "[x (+ x 1)]"},
+		{"`[1 ,x ,@(list 2 3)]", "[1 5 2 3]"},
+		{`(vector 1 "a" nil)`, `[1 "a" nil]`},
+		{"(vector? [1])", "true"},
+		{"(vector? (list 1))", "false"},
+		{"(vector-length [])", "0"},
+		{"(vector-length [1 2 3])", "3"},
+		{"(vector-ref [10 20 30] 2)", "30"},
+		{"(vector-set! [1 2 3] 1 'b)", "[1 b 3]"},
+		{"(vector-push [1] 2 3)", "[1 2 3]"},
+		{"(vector-slice [0 1 2 3 4] 1 3)", "[1 2]"},
+		{"(vector-slice [0 1 2 3 4] 3)", "[3 4]"},
+		{"(vector-slice [0 1] 2)", "[]"},
+		{"(vector->list [1 2 3])", "(1 2 3)"},
+		{"(vector->list [])", "nil"},
+		{"(list->vector (list 1 2))", "[1 2]"},
+		{"(list->vector nil)", "[]"},
+		{"(= [1 [2 3]] (vector 1 (vector 2 3)))", "true"},
+		{"(= [1 2] [1 2 3])", "false"},
+		{"(= [1 2] (list 1 2))", "false"},
+	}
+
+	for _, tt := range tests {
+		result := eval(readStr(tt.input), env)
+		if got := printExpr(result); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestVectorLiteralIsFreshEachTime(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr("(define make (lambda () [1]))"), env)
+	eval(readStr("(vector-push (make) 2)"), env)
+
+	if got := printExpr(eval(readStr("(make)"), env)); got != "[1]" {
+		t.Errorf("(make) = %s after pushing onto an earlier result, want [1]", got)
+	}
+}
+
+func TestVectorMutationIsShared(t *testing.T) {
+	env := setupFullEnv()
+	eval(readStr("(define v [])"), env)
+	eval(readStr("(define w v)"), env)
+	eval(readStr("(vector-push v 1)"), env)
+	eval(readStr("(vector-set! w 0 'a)"), env)
+
+	if got := printExpr(eval(readStr("v"), env)); got != "[a]" {
+		t.Errorf("v = %s, want [a]", got)
+	}
+}
+
+func TestVectorErrors(t *testing.T) {
+	env := setupFullEnv()
+
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{"(vector-ref [1 2] 2)", ErrValue},
+		{"(vector-ref [1 2] -1)", ErrValue},
+		{`(vector-ref [1 2] "0")`, ErrType},
+		{"(vector-ref (list 1 2) 0)", ErrType},
+		{"(vector-set! [] 0 1)", ErrValue},
+		{"(vector-push [1])", ErrArity},
+		{"(vector-slice [1 2] 1 3)", ErrValue},
+		{"(vector-slice [1 2] 2 1)", ErrValue},
+		{"(vector-length 1)", ErrType},
+		{"(list->vector [1])", ErrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("%s should panic", tt.input)
+				}
+				if err := recoverError(r); err.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", tt.input, err.Kind, tt.kind)
+				}
+			}()
+			eval(readStr(tt.input), env)
+		})
+	}
+}
+
+func TestJsonVectors(t *testing.T) {
+	tests := []struct {
+		args []*Expr
+		want string
+	}{
+		{[]*Expr{makeStr(`[1, [2], {"a": [3]}]`)}, `(1 (2) {"a" (3)})`},
+		{[]*Expr{makeStr(`[1, [2], {"a": [3]}]`), makeSym("list")}, `(1 (2) {"a" (3)})`},
+		{[]*Expr{makeStr(`[1, [2], {"a": [3]}]`), makeSym("vector")}, `[1 [2] {"a" [3]}]`},
+		{[]*Expr{makeStr(`[]`), makeSym("vector")}, `[]`},
+	}
+
+	for _, tt := range tests {
+		if got := printExpr(builtinJsonParse(tt.args)); got != tt.want {
+			t.Errorf("@json %s = %s, want %s", tt.args[0].Str, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{`[]`, `[1,[2,3],"x"]`, `{"items":[true,null]}`} {
+		parsed := builtinJsonParse([]*Expr{makeStr(input), makeSym("vector")})
+		if result := builtinJsonStringify([]*Expr{parsed}); result.Str != input {
+			t.Errorf("round trip of %s = %s", input, result.Str)
+		}
+	}
+}
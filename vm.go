@@ -0,0 +1,401 @@
+package minilisp
+
+// Backend is what runs an interpreter's code
+type Backend int
+
+const (
+	BytecodeVM Backend = iota // compile to bytecode for a stack VM, the default
+	TreeWalker                // walk the forms with eval
+)
+
+// WithBackend picks what runs the interpreter's code. Both give the same
+// results and errors; the tree walker is slower but simpler to follow.
+func WithBackend(b Backend) Option {
+	return func(in *Interpreter) { in.backend = b }
+}
+
+// A call in progress. Like one call of eval, it remembers the lambdas it
+// tail called for error traces.
+type frame struct {
+	code    *code
+	pc      int
+	env     *Env
+	base    int       // where the frame's values start on the stack
+	callees []*Expr   // see recordTailCall
+	applied *Expr     // the lambda, when a builtin called it with applyProc
+	outer   *Position // where errors point if the code's forms have no position
+}
+
+// Where an error in the frame points
+func (f *frame) position() *Position {
+	if f.pc > 0 {
+		if pos := f.code.pos[f.pc-1]; pos != nil {
+			return pos
+		}
+	}
+	return f.outer
+}
+
+// The VM runs compiled code with a stack of values and a stack of frames,
+// so calls in Lisp don't nest calls in Go. A VM runs one form or one call
+// from a builtin; special forms eval leaves to Go code, like try, run
+// theirs on a VM of their own.
+type vm struct {
+	run    *evaluation
+	stack  []*Expr
+	frames []frame
+}
+
+// Run code compiled for env
+func runCode(c *code, env *Env) *Expr {
+	m := &vm{run: env.evaluation(), stack: make([]*Expr, 0, 16)}
+	defer m.unwind()
+	m.push(frame{code: c, env: env})
+	m.run.step()
+	return m.loop()
+}
+
+// Call lambda fn with arguments that are already evaluated, for applyProc
+func callCompiled(env *Env, fn *Expr, args []*Expr) *Expr {
+	m := &vm{run: env.evaluation(), stack: make([]*Expr, 0, 16)}
+	defer m.unwind()
+	m.push(frame{applied: fn})
+	p := protoOf(fn)
+	c := p.compiled(fn.Env)
+	f := m.top()
+	f.env = m.bind(fn, p, args)
+	f.code = c
+	return m.loop()
+}
+
+func (m *vm) top() *frame {
+	return &m.frames[len(m.frames)-1]
+}
+
+func (m *vm) push(f frame) {
+	m.frames = append(m.frames, f)
+	m.run.enter()
+}
+
+// Give an error unwinding out of the VM the position and trace eval would
+func (m *vm) unwind() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := recoverError(r)
+	if len(m.frames) > 0 && err.Pos == nil {
+		err.Pos = m.top().position()
+	}
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		f := &m.frames[i]
+		for j := len(f.callees) - 1; j >= 0; j-- {
+			err.Trace = append(err.Trace, frameName(f.callees[j]))
+		}
+		if f.applied != nil {
+			err.Trace = append(err.Trace, frameName(f.applied))
+		}
+		m.run.leave()
+	}
+	panic(err)
+}
+
+// A new environment for a call of fn, with its parameters bound to args
+func (m *vm) bind(fn *Expr, p *proto, args []*Expr) *Env {
+	env := newFrame(fn.Env, p.scope)
+	env.run = m.run
+	if !p.simple {
+		bindArgs(env, fn, args)
+		return env
+	}
+	if len(args) < p.arity {
+		panic(errorf(ErrArity, "", "not enough arguments"))
+	}
+	if len(args) > p.arity {
+		panic(errorf(ErrArity, "", "too many arguments"))
+	}
+	copy(env.slots, args)
+	return env
+}
+
+// Call a builtin or keyword
+func (m *vm) apply(env *Env, fn *Expr, args []*Expr) *Expr {
+	switch fn.Type {
+	case Builtin:
+		return callBuiltin(env, fn, args)
+	case Keyword:
+		return keywordGet(fn, args)
+	default:
+		panic(errorf(ErrType, "", "not a function: %s", printExpr(fn)))
+	}
+}
+
+func (m *vm) loop() *Expr {
+	f := m.top()
+	for {
+		c := f.code
+		in := c.instrs[f.pc]
+		f.pc++
+
+		switch in.op {
+		case opConst:
+			m.stack = append(m.stack, c.consts[in.a])
+		case opLocal:
+			m.stack = append(m.stack, local(f.env, int(in.a), int(in.b)))
+		case opGlobal:
+			m.stack = append(m.stack, global(f.env, c.consts[in.a].Sym, int(in.b)))
+		case opSetLocal:
+			setLocal(f.env, int(in.a), int(in.b), m.stack[len(m.stack)-1])
+		case opSetGlobal:
+			sym := c.consts[in.a].Sym
+			if !f.env.Set(sym, m.stack[len(m.stack)-1]) {
+				panic(errorf(ErrUnbound, "set!", "unbound symbol: %s", sym))
+			}
+		case opDefine:
+			sym, val := c.consts[in.a].Sym, m.stack[len(m.stack)-1]
+			if (val.Type == Lambda || val.Type == Macro) && val.Name == "" {
+				val.Name = sym
+			}
+			f.env.Define(sym, val)
+			if doc := c.consts[in.b].Str; doc != "" {
+				f.env.SetDoc(sym, doc)
+			}
+		case opShadow:
+			// A module's top level is its own, so hiding a global there
+			// is on purpose
+			sym := c.consts[in.b].Sym
+			if f.env.module == nil && f.env.Shadows(sym) {
+				f.env.interpreter().warnShadow(c.consts[in.a], sym)
+			}
+		case opPop:
+			m.stack = m.stack[:len(m.stack)-1]
+		case opJump:
+			f.pc = int(in.a)
+		case opJumpFalse:
+			val := m.stack[len(m.stack)-1]
+			m.stack = m.stack[:len(m.stack)-1]
+			if !isTruthy(val) {
+				f.pc = int(in.a)
+			}
+		case opAnd, opOr:
+			if isTruthy(m.stack[len(m.stack)-1]) == (in.op == opOr) {
+				f.pc = int(in.a)
+			} else {
+				m.stack = m.stack[:len(m.stack)-1]
+			}
+		case opNot:
+			m.stack[len(m.stack)-1] = makeBool(!isTruthy(m.stack[len(m.stack)-1]))
+		case opVector:
+			start := len(m.stack) - int(in.a)
+			items := make([]*Expr, in.a)
+			copy(items, m.stack[start:])
+			m.stack = append(m.stack[:start], makeVector(items))
+		case opClosure:
+			p := c.protos[in.a]
+			fn := makeLambda(p.params, p.body, f.env, Lambda)
+			fn.Doc = p.doc
+			fn.proto.Store(p)
+			m.stack = append(m.stack, fn)
+		case opMacro:
+			val := m.stack[len(m.stack)-1]
+			if val.Type != Macro {
+				continue
+			}
+			m.stack = m.stack[:len(m.stack)-1]
+			site := c.macros[in.a]
+			expanded := site.expand(val, f.env)
+			m.run.step()
+			if site.tail {
+				m.stack = m.stack[:f.base]
+				f.code, f.pc = expanded, 0
+			} else {
+				// Run the expansion like a call, carrying on after the
+				// call it replaces
+				f.pc = int(in.b)
+				m.push(frame{code: expanded, env: f.env, base: len(m.stack), outer: f.outer})
+				f = m.top()
+			}
+		case opCall:
+			start := len(m.stack) - int(in.a) - 1
+			fn := m.stack[start]
+			m.run.step()
+			if fn.Type != Lambda {
+				args := make([]*Expr, in.a)
+				copy(args, m.stack[start+1:])
+				result := m.apply(f.env, fn, args)
+				m.stack = append(m.stack[:start], result)
+				continue
+			}
+
+			p := protoOf(fn)
+			body := p.compiled(fn.Env)
+			outer := c.outer[f.pc-1]
+			if outer == nil {
+				outer = f.outer
+			}
+			// Until the arguments are bound, errors point at the call
+			m.push(frame{code: c, pc: f.pc, callees: []*Expr{fn}, base: start, outer: outer})
+			f = m.top()
+			f.env = m.bind(fn, p, m.stack[start+1:])
+			f.code, f.pc = body, 0
+			m.stack = m.stack[:start]
+		case opTailCall:
+			start := len(m.stack) - int(in.a) - 1
+			fn := m.stack[start]
+			m.run.step()
+			if fn.Type != Lambda {
+				args := make([]*Expr, in.a)
+				copy(args, m.stack[start+1:])
+				result := m.apply(f.env, fn, args)
+				if f = m.ret(result); f == nil {
+					return result
+				}
+				continue
+			}
+
+			f.callees = recordTailCall(f.callees, fn)
+			p := protoOf(fn)
+			body := p.compiled(fn.Env)
+			env := m.bind(fn, p, m.stack[start+1:])
+			m.stack = m.stack[:f.base]
+			f.env, f.code, f.pc = env, body, 0
+		case opReturn:
+			result := m.stack[len(m.stack)-1]
+			if f = m.ret(result); f == nil {
+				return result
+			}
+		case opEnter:
+			f.env = newFrame(f.env, c.scopes[in.a])
+		case opBind:
+			start := len(m.stack) - int(in.b)
+			for i, val := range m.stack[start:] {
+				b := c.binds[int(in.a)+i]
+				if b.slot >= 0 {
+					f.env.slots[b.slot] = val
+				} else {
+					bindPattern(f.env, b.pattern, val, b.origin)
+				}
+			}
+			m.stack = m.stack[:start]
+		case opLeave:
+			for i := 0; i < int(in.a); i++ {
+				f.env = f.env.parent
+			}
+		case opNamedLet:
+			named := c.named[in.a]
+			start := len(m.stack) - named.n
+
+			// The loop lambda can see itself, but the inits can't see it
+			loopEnv := newFrame(f.env, named.scope)
+			loop := makeLambda(named.proto.params, named.proto.body, loopEnv, Lambda)
+			loop.Name = named.name
+			loop.proto.Store(named.proto)
+			loopEnv.slots[0] = loop
+			body := named.proto.compiled(loopEnv)
+
+			// Starting the loop isn't a call in traces
+			if in.b == 1 {
+				env := m.bind(loop, named.proto, m.stack[start:])
+				m.stack = m.stack[:f.base]
+				f.env, f.code, f.pc = env, body, 0
+				continue
+			}
+			outer := c.outer[f.pc-1]
+			if outer == nil {
+				outer = f.outer
+			}
+			m.push(frame{code: c, pc: f.pc, base: start, outer: outer})
+			f = m.top()
+			f.env = m.bind(loop, named.proto, m.stack[start:])
+			f.code, f.pc = body, 0
+			m.stack = m.stack[:start]
+		case opForm:
+			m.stack = append(m.stack, evalForm(c.consts[in.a], f.env))
+		case opRaise:
+			err := c.consts[in.a]
+			panic(makeError(err.Kind, err.Origin, err.Str, err.Payload))
+		}
+	}
+}
+
+// Return result from the top frame, giving the frame to carry on with or
+// nil if that was the last
+func (m *vm) ret(result *Expr) *frame {
+	base := m.top().base
+	m.frames = m.frames[:len(m.frames)-1]
+	m.run.leave()
+	if len(m.frames) == 0 {
+		return nil
+	}
+	m.stack = append(m.stack[:base], result)
+	return m.top()
+}
+
+// The value of slot i of the environment depth frames out from env. The
+// frames in between can't have a slot with its name, but something could
+// have defined it in their bindings since, and an unset slot means the
+// name isn't bound there yet.
+func local(env *Env, depth, i int) *Expr {
+	target := env
+	defined := false
+	for ; depth > 0; depth-- {
+		defined = defined || target.bindings != nil
+		target = target.parent
+	}
+	if val := target.slots[i]; val != nil && !defined {
+		return val
+	}
+
+	name := target.scope.names[i]
+	for e := env; e != target; e = e.parent {
+		if val, ok := e.bindings[name]; ok {
+			return val
+		}
+	}
+	if val := target.slots[i]; val != nil {
+		return val
+	}
+	return lookup(target.parent, name)
+}
+
+func setLocal(env *Env, depth, i int, val *Expr) {
+	target := env
+	for ; depth > 0; depth-- {
+		target = target.parent
+	}
+
+	name := target.scope.names[i]
+	for e := env; e != target; e = e.parent {
+		if _, ok := e.bindings[name]; ok {
+			e.bindings[name] = val
+			return
+		}
+	}
+	if target.slots[i] != nil {
+		target.slots[i] = val
+		return
+	}
+	if !target.parent.Set(name, val) {
+		panic(errorf(ErrUnbound, "set!", "unbound symbol: %s", name))
+	}
+}
+
+// Look sym up from env, skipping the slots of the first static frames,
+// which the compiler knows don't have it
+func global(env *Env, sym string, static int) *Expr {
+	for ; static > 0; static-- {
+		if val, ok := env.bindings[sym]; ok {
+			return val
+		}
+		env = env.parent
+	}
+	return lookup(env, sym)
+}
+
+func lookup(env *Env, sym string) *Expr {
+	val, ok := env.Lookup(sym)
+	if !ok {
+		panic(errorf(ErrUnbound, "", "unbound symbol: %s", sym))
+	}
+	return val
+}
@@ -0,0 +1,131 @@
+package minilisp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A test of the evaluator, which both backends have to pass
+type backendTest struct {
+	name string
+	test func(t *testing.T, backend Backend)
+}
+
+var backends = []struct {
+	name    string
+	backend Backend
+}{{"vm", BytecodeVM}, {"tree-walker", TreeWalker}}
+
+// Run each test on the VM and again on the tree walker, so the two have to
+// agree
+func runOnBackends(t *testing.T, tests []backendTest) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) { tt.test(t, b.backend) })
+			}
+		})
+	}
+}
+
+func TestBackends(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(define fact (lambda (n) (if (= n 0) 1 (* n (fact (- n 1)))))) (fact 20)", "2432902008176640000"},
+		{"(define loop (lambda (n acc) (if (= n 0) acc (loop (- n 1) (+ acc 1))))) (loop 100000 0)", "100000"},
+		{"(let loop ((i 0) (acc nil)) (if (= i 3) acc (loop (+ i 1) (pair i acc))))", "(2 1 0)"},
+		{"(let* ((x 1) (f (lambda () x)) (x 2)) (list x (f)))", "(2 1)"},
+		{"(letrec ((even? (lambda (n) (if (= n 0) true (odd? (- n 1))))) (odd? (lambda (n) (if (= n 0) false (even? (- n 1)))))) (even? 1001))", "false"},
+		{"(define x 1) (define f (lambda () (define y (+ x 1)) (set! x y) (list x y))) (f)", "(2 2)"},
+		{"(define g (lambda (a) (let () (if true (define a 5)) a))) (g 1)", "5"},
+		{"(define h (lambda ((a b) &rest c) (list a b c))) (h '(1 2) 3 4)", "(1 2 (3 4))"},
+		{"(define k (lambda (x) (and x (or false x)))) (list (k 1) (k false))", "(1 false)"},
+		{"(define m (lambda (v) (cond ((= v 1) 'one) (true 'other)))) (list (m 1) (m 2))", "(one other)"},
+		{"(define c (lambda (n) (when (> n 0) (c (- n 1))))) (c 100000)", "nil"},
+		{"[1 (+ 1 1) (not nil)]", "[1 2 true]"},
+		{"(try (throw 'value-error \"no\") (catch (e) (error-message e)))", `"no"`},
+	}
+
+	for _, backend := range []Backend{BytecodeVM, TreeWalker} {
+		for _, tt := range tests {
+			interp := New(WithBackend(backend))
+			var result *Expr
+			for _, form := range readSource(tt.input, "") {
+				result = eval(form, interp.env)
+			}
+			if got := printExpr(result); got != tt.want {
+				t.Errorf("backend %d: %s = %s, want %s", backend, tt.input, got, tt.want)
+			}
+		}
+	}
+}
+
+// Both backends point errors at the same place and unwind through the same
+// frames
+func TestBackendErrors(t *testing.T) {
+	src := `(define inner (lambda (x) (head x)))
+(define outer (lambda (x)
+  (+ 1 (inner x))))
+(define loop (lambda (n) (if (= n 0) (outer 1) (loop (- n 1)))))
+(map (lambda (n) (loop n)) (list 3))`
+
+	var errs []*EvalError
+	for _, backend := range []Backend{BytecodeVM, TreeWalker} {
+		interp := New(WithoutStdlib(), WithBackend(backend))
+		err := interp.Run(context.Background(), src, "t.lisp", func(err error) {
+			errs = append(errs, err.(*EvalError))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v", errs)
+	}
+	vm, tree := errs[0], errs[1]
+	if vm.Pos != tree.Pos || strings.Join(vm.Trace, " ") != strings.Join(tree.Trace, " ") {
+		t.Errorf("vm error at %s %v, tree walker at %s %v", vm.Pos, vm.Trace, tree.Pos, tree.Trace)
+	}
+	if tree.Pos != "t.lisp:1:27" {
+		t.Errorf("pos = %s", tree.Pos)
+	}
+}
+
+// Both backends expand a macro call every time it runs, so a macro with
+// side effects, or one that looks at globals, does the same on each
+func TestMacroWithSideEffects(t *testing.T) {
+	var results [][]any
+	for _, backend := range []Backend{BytecodeVM, TreeWalker} {
+		interp := New(WithoutStdlib(), WithBackend(backend))
+		interp.Eval(context.Background(), `
+(define expansions 0)
+(defmacro twice (x) (set! expansions (+ expansions 1)) (list 'begin x x))
+(define f (lambda (n) (twice n)))
+(define mode 1)
+(defmacro pick () (if (= mode 1) ''one ''two))
+(define g (lambda () (pick)))`)
+
+		var got []any
+		for _, src := range []string{"(f 1)", "(f 2)", "(f 3)", "expansions", "(g)", "(set! mode 2)", "(g)"} {
+			result, err := interp.Eval(context.Background(), src)
+			if err != nil {
+				t.Fatalf("backend %d: %s: %v", backend, src, err)
+			}
+			got = append(got, result)
+		}
+		results = append(results, got)
+	}
+
+	vm, tree := fmt.Sprint(results[0]), fmt.Sprint(results[1])
+	if vm != tree {
+		t.Errorf("vm gave %s, tree walker %s", vm, tree)
+	}
+	if want := "[1 2 3 3 one 2 two]"; tree != want {
+		t.Errorf("tree walker gave %s, want %s", tree, want)
+	}
+}